@@ -0,0 +1,362 @@
+// Package sqirvy provides adaptive concurrency limits from provider rate-limit headers.
+//
+// This file implements AdaptiveLimiter, which limits the number of concurrent
+// requests to each provider. The limit is halved when a provider returns a rate
+// limit or overload response, and grows back one request at a time while the
+// provider's remaining-requests and remaining-tokens headers show headroom.
+// Retry-after and reset headers pause new requests until the provider is ready.
+// Clients created by NewClient with WithAdaptiveLimiter feed the limiter.
+package sqirvy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AdaptiveConfig configures an AdaptiveLimiter. Zero fields use the defaults.
+type AdaptiveConfig struct {
+	Initial int // initial concurrency per provider (default 4)
+	Min     int // minimum concurrency (default 1)
+	Max     int // maximum concurrency (default 32)
+	// DecreaseWindow is the time after a decrease of the limit during which further
+	// rate limit and overload responses do not decrease it again, unless a request
+	// succeeded in between (default 1s). Requests in flight that fail together
+	// halve the limit once.
+	DecreaseWindow time.Duration
+}
+
+// LimitState is a snapshot of the adaptive limit of a provider.
+type LimitState struct {
+	Provider          string
+	Concurrency       int       // current concurrency limit
+	InFlight          int       // requests in progress
+	Waiting           int       // requests waiting for a slot
+	RemainingRequests int64     // last remaining-requests header, -1 if unknown
+	RemainingTokens   int64     // last remaining-tokens header, -1 if unknown
+	PausedUntil       time.Time // new requests wait until this time after a retry-after or exhausted limit
+	Throttled         int       // rate limit and overload responses seen
+	Updated           time.Time // time of the last observed response
+}
+
+// adaptiveState is the limit state of one provider
+type adaptiveState struct {
+	LimitState
+	successes int             // successful responses since the last change of the limit
+	decreased time.Time       // time of the last decrease of the limit
+	succeeded bool            // a response succeeded since the last decrease
+	waiters   []chan struct{} // queued callers, in arrival order
+	timer     *time.Timer     // wakes waiters when a pause ends
+}
+
+// AdaptiveLimiter limits concurrent requests per provider, adapting the limit to
+// the provider's rate-limit responses. It is safe for concurrent use.
+type AdaptiveLimiter struct {
+	config AdaptiveConfig
+	mu     sync.Mutex
+	states map[string]*adaptiveState
+	now    func() time.Time
+}
+
+// NewAdaptiveLimiter creates an AdaptiveLimiter.
+func NewAdaptiveLimiter(config AdaptiveConfig) *AdaptiveLimiter {
+	if config.Min <= 0 {
+		config.Min = 1
+	}
+	if config.Max <= 0 {
+		config.Max = 32
+	}
+	if config.Initial <= 0 {
+		config.Initial = 4
+	}
+	if config.DecreaseWindow <= 0 {
+		config.DecreaseWindow = time.Second
+	}
+	config.Initial = max(config.Min, min(config.Max, config.Initial))
+	return &AdaptiveLimiter{config: config, states: make(map[string]*adaptiveState), now: time.Now}
+}
+
+// state returns the state of a provider, creating it if needed. The caller must hold l.mu.
+func (l *AdaptiveLimiter) state(provider string) *adaptiveState {
+	s, ok := l.states[provider]
+	if !ok {
+		s = &adaptiveState{LimitState: LimitState{
+			Provider:          provider,
+			Concurrency:       l.config.Initial,
+			RemainingRequests: -1,
+			RemainingTokens:   -1,
+		}}
+		l.states[provider] = s
+	}
+	return s
+}
+
+// State returns the current limit state of a provider.
+func (l *AdaptiveLimiter) State(provider string) LimitState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := l.state(provider)
+	snapshot := s.LimitState
+	snapshot.Waiting = len(s.waiters)
+	return snapshot
+}
+
+// States returns the limit state of every provider seen so far, sorted by provider.
+func (l *AdaptiveLimiter) States() []LimitState {
+	l.mu.Lock()
+	var providers []string
+	for provider := range l.states {
+		providers = append(providers, provider)
+	}
+	l.mu.Unlock()
+
+	sort.Strings(providers)
+	var states []LimitState
+	for _, provider := range providers {
+		states = append(states, l.State(provider))
+	}
+	return states
+}
+
+// Acquire waits for a request slot for the provider. Callers are served in arrival
+// order. The returned function releases the slot and must be called when the
+// request is done. It returns an error if the context is done first.
+func (l *AdaptiveLimiter) Acquire(ctx context.Context, provider string) (func(), error) {
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("request context error %w", ctx.Err())
+	}
+
+	l.mu.Lock()
+	s := l.state(provider)
+	release := func() { l.release(provider) }
+	if len(s.waiters) == 0 && s.InFlight < s.Concurrency && !l.now().Before(s.PausedUntil) {
+		s.InFlight++
+		l.mu.Unlock()
+		return release, nil
+	}
+	ready := make(chan struct{})
+	s.waiters = append(s.waiters, ready)
+	l.dispatch(s)
+	l.mu.Unlock()
+
+	select {
+	case <-ready:
+		return release, nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for i, w := range s.waiters {
+			if w == ready {
+				s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+				return nil, fmt.Errorf("request context error %w", ctx.Err())
+			}
+		}
+		// the slot was granted as the context ended, pass it on
+		s.InFlight--
+		l.dispatch(s)
+		return nil, fmt.Errorf("request context error %w", ctx.Err())
+	}
+}
+
+// release frees a request slot
+func (l *AdaptiveLimiter) release(provider string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := l.state(provider)
+	s.InFlight--
+	l.dispatch(s)
+}
+
+// dispatch grants free slots to waiting callers in order. If requests are paused,
+// it schedules itself for the end of the pause. The caller must hold l.mu.
+func (l *AdaptiveLimiter) dispatch(s *adaptiveState) {
+	if wait := s.PausedUntil.Sub(l.now()); wait > 0 {
+		if len(s.waiters) > 0 && s.timer == nil {
+			s.timer = time.AfterFunc(wait, func() {
+				l.mu.Lock()
+				defer l.mu.Unlock()
+				s.timer = nil
+				l.dispatch(s)
+			})
+		}
+		return
+	}
+	for len(s.waiters) > 0 && s.InFlight < s.Concurrency {
+		s.InFlight++
+		close(s.waiters[0])
+		s.waiters = s.waiters[1:]
+	}
+}
+
+// Observe updates the limit of a provider from an http response status and headers.
+// Rate limit and overload responses halve the concurrency, at most once per
+// DecreaseWindow while no request succeeds, and retry-after or an
+// exhausted remaining-requests count pause new requests. Successful responses with
+// headroom grow the concurrency by one after each window of Concurrency successes.
+func (l *AdaptiveLimiter) Observe(provider string, status int, header http.Header) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	s := l.state(provider)
+	s.Updated = now
+
+	headers := parseRateLimitHeaders(header, now)
+	if headers.remainingRequests >= 0 {
+		s.RemainingRequests = headers.remainingRequests
+	}
+	if headers.remainingTokens >= 0 {
+		s.RemainingTokens = headers.remainingTokens
+	}
+	if headers.retryAt.After(s.PausedUntil) {
+		s.PausedUntil = headers.retryAt
+	}
+
+	switch {
+	case status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable || status == 529:
+		s.Throttled++
+		s.successes = 0
+		if s.decreased.IsZero() || s.succeeded || now.Sub(s.decreased) >= l.config.DecreaseWindow {
+			s.Concurrency = max(l.config.Min, s.Concurrency/2)
+			s.decreased, s.succeeded = now, false
+		}
+	case status >= 200 && status < 300:
+		s.succeeded = true
+		if headers.remainingRequests == 0 && headers.requestsResetAt.After(s.PausedUntil) {
+			s.PausedUntil = headers.requestsResetAt
+		}
+		// grow only while the provider reports room for more concurrent requests
+		headroom := (headers.remainingRequests < 0 || headers.remainingRequests > int64(2*s.Concurrency)) &&
+			headers.remainingTokens != 0
+		if !headroom {
+			s.successes = 0
+			break
+		}
+		s.successes++
+		if s.successes >= s.Concurrency && s.Concurrency < l.config.Max {
+			s.Concurrency++
+			s.successes = 0
+		}
+	}
+	l.dispatch(s)
+}
+
+// rateLimitHeaders holds the values parsed from provider rate-limit headers
+type rateLimitHeaders struct {
+	remainingRequests int64     // -1 if not reported
+	remainingTokens   int64     // -1 if not reported
+	retryAt           time.Time // from retry-after, zero if not reported
+	requestsResetAt   time.Time // when the request limit resets, zero if not reported
+}
+
+// parseRateLimitHeaders reads the Anthropic and OpenAI style rate-limit headers.
+// OpenAI compatible providers such as DeepSeek use the OpenAI headers.
+func parseRateLimitHeaders(header http.Header, now time.Time) rateLimitHeaders {
+	h := rateLimitHeaders{remainingRequests: -1, remainingTokens: -1}
+
+	integer := func(names ...string) int64 {
+		for _, name := range names {
+			if v, err := strconv.ParseInt(strings.TrimSpace(header.Get(name)), 10, 64); err == nil {
+				return v
+			}
+		}
+		return -1
+	}
+	h.remainingRequests = integer("anthropic-ratelimit-requests-remaining", "x-ratelimit-remaining-requests")
+	h.remainingTokens = integer("anthropic-ratelimit-tokens-remaining", "x-ratelimit-remaining-tokens")
+
+	if ms := integer("retry-after-ms"); ms >= 0 {
+		h.retryAt = now.Add(time.Duration(ms) * time.Millisecond)
+	} else if v := strings.TrimSpace(header.Get("retry-after")); v != "" {
+		if secs, err := strconv.ParseFloat(v, 64); err == nil {
+			h.retryAt = now.Add(time.Duration(secs * float64(time.Second)))
+		} else if t, err := http.ParseTime(v); err == nil {
+			h.retryAt = t
+		}
+	}
+
+	// anthropic reports an RFC 3339 time, openai a duration such as "1s" or "6m0s"
+	if v := header.Get("anthropic-ratelimit-requests-reset"); v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			h.requestsResetAt = t
+		}
+	} else if v := header.Get("x-ratelimit-reset-requests"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			h.requestsResetAt = now.Add(d)
+		}
+	}
+	return h
+}
+
+// adaptiveTransport reports each provider response to an AdaptiveLimiter
+type adaptiveTransport struct {
+	provider string
+	limiter  *AdaptiveLimiter
+	next     http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *adaptiveTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	t.limiter.Observe(t.provider, resp.StatusCode, resp.Header)
+	return resp, nil
+}
+
+// AdaptiveClient wraps a Client and holds an AdaptiveLimiter slot for each query.
+type AdaptiveClient struct {
+	client   Client
+	provider string
+	limiter  *AdaptiveLimiter
+}
+
+// Ensure AdaptiveClient implements the Client and Querier interfaces
+var (
+	_ Client  = (*AdaptiveClient)(nil)
+	_ Querier = (*AdaptiveClient)(nil)
+)
+
+// NewAdaptiveClient wraps client with the limiter slots of provider. The limiter
+// only adapts to responses it observes; use NewClient with WithAdaptiveLimiter to
+// also install the http transport that reports provider responses.
+func NewAdaptiveClient(client Client, provider string, limiter *AdaptiveLimiter) *AdaptiveClient {
+	return &AdaptiveClient{client: client, provider: provider, limiter: limiter}
+}
+
+// QueryText waits for a request slot and sends the query to the wrapped client.
+func (c *AdaptiveClient) QueryText(ctx context.Context, system string, prompts []string, model string, options Options) (string, error) {
+	return queryText(ctx, c, system, prompts, model, options)
+}
+
+// Query implements the Querier interface.
+func (c *AdaptiveClient) Query(ctx context.Context, req Request) (*Response, error) {
+	return c.intercept(ctx, req, ClientHandler(c.client))
+}
+
+// intercept implements the middleware of the client, sending requests to next
+func (c *AdaptiveClient) intercept(ctx context.Context, req Request, next Handler) (*Response, error) {
+	release, err := c.limiter.Acquire(ctx, c.provider)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return next(ctx, req)
+}
+
+// AdaptiveMiddleware returns the middleware of an AdaptiveClient: it holds a limiter
+// slot for each request.
+func AdaptiveMiddleware(provider string, limiter *AdaptiveLimiter) Middleware {
+	return NewAdaptiveClient(nil, provider, limiter).intercept
+}
+
+// Close closes the wrapped client.
+func (c *AdaptiveClient) Close() error {
+	return c.client.Close()
+}
@@ -0,0 +1,187 @@
+package sqirvy
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmh2000/sqirvy-llmclient/sqirvytest"
+)
+
+func TestParseRateLimitHeaders(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		header        map[string]string
+		wantRequests  int64
+		wantTokens    int64
+		wantRetryAt   time.Time
+		wantRequestAt time.Time
+	}{
+		{name: "None", header: nil, wantRequests: -1, wantTokens: -1},
+		{
+			name: "Anthropic",
+			header: map[string]string{
+				"anthropic-ratelimit-requests-remaining": "10",
+				"anthropic-ratelimit-tokens-remaining":   "20000",
+				"anthropic-ratelimit-requests-reset":     "2025-01-01T00:00:30Z",
+				"retry-after":                            "5",
+			},
+			wantRequests: 10, wantTokens: 20000,
+			wantRetryAt:   now.Add(5 * time.Second),
+			wantRequestAt: now.Add(30 * time.Second),
+		},
+		{
+			name: "OpenAI",
+			header: map[string]string{
+				"x-ratelimit-remaining-requests": "99",
+				"x-ratelimit-remaining-tokens":   "149000",
+				"x-ratelimit-reset-requests":     "1m0s",
+				"retry-after-ms":                 "250",
+			},
+			wantRequests: 99, wantTokens: 149000,
+			wantRetryAt:   now.Add(250 * time.Millisecond),
+			wantRequestAt: now.Add(time.Minute),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tt.header {
+				header.Set(k, v)
+			}
+			got := parseRateLimitHeaders(header, now)
+			if got.remainingRequests != tt.wantRequests || got.remainingTokens != tt.wantTokens {
+				t.Errorf("remaining = %d requests, %d tokens", got.remainingRequests, got.remainingTokens)
+			}
+			if !got.retryAt.Equal(tt.wantRetryAt) || !got.requestsResetAt.Equal(tt.wantRequestAt) {
+				t.Errorf("retryAt = %v, requestsResetAt = %v", got.retryAt, got.requestsResetAt)
+			}
+		})
+	}
+}
+
+func TestAdaptiveLimiter_Observe(t *testing.T) {
+	limiter := NewAdaptiveLimiter(AdaptiveConfig{Initial: 8, Min: 1, Max: 9})
+
+	limiter.Observe(Anthropic, http.StatusTooManyRequests, http.Header{})
+	if got := limiter.State(Anthropic); got.Concurrency != 4 || got.Throttled != 1 {
+		t.Errorf("after 429 state = %+v, want concurrency 4", got)
+	}
+
+	// a window of successes with headroom grows the limit by one
+	for i := 0; i < 4; i++ {
+		limiter.Observe(Anthropic, http.StatusOK, http.Header{"Anthropic-Ratelimit-Requests-Remaining": {"100"}})
+	}
+	if got := limiter.State(Anthropic); got.Concurrency != 5 || got.RemainingRequests != 100 {
+		t.Errorf("after successes state = %+v, want concurrency 5", got)
+	}
+
+	// no headroom, no growth
+	for i := 0; i < 10; i++ {
+		limiter.Observe(Anthropic, http.StatusOK, http.Header{"Anthropic-Ratelimit-Requests-Remaining": {"3"}})
+	}
+	if got := limiter.State(Anthropic); got.Concurrency != 5 {
+		t.Errorf("without headroom concurrency = %d, want 5", got.Concurrency)
+	}
+
+	limiter.Observe(Anthropic, 529, http.Header{"Retry-After": {"30"}})
+	if got := limiter.State(Anthropic); got.Concurrency != 2 || !got.PausedUntil.After(time.Now()) {
+		t.Errorf("after 529 state = %+v, want concurrency 2 and a pause", got)
+	}
+}
+
+func TestAdaptiveLimiter_ConcurrentThrottles(t *testing.T) {
+	limiter := NewAdaptiveLimiter(AdaptiveConfig{Initial: 16, Min: 1, Max: 32})
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	// requests in flight that fail together halve the limit once
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.Observe(Anthropic, http.StatusTooManyRequests, http.Header{})
+		}()
+	}
+	wg.Wait()
+	if got := limiter.State(Anthropic); got.Concurrency != 8 || got.Throttled != 8 {
+		t.Errorf("after concurrent 429s state = %+v, want concurrency 8", got)
+	}
+
+	// after the window the limit is halved again
+	now = now.Add(time.Second)
+	limiter.Observe(Anthropic, http.StatusTooManyRequests, http.Header{})
+	if got := limiter.State(Anthropic).Concurrency; got != 4 {
+		t.Errorf("after the window concurrency = %d, want 4", got)
+	}
+}
+
+func TestAdaptiveLimiter_Acquire(t *testing.T) {
+	limiter := NewAdaptiveLimiter(AdaptiveConfig{Initial: 1})
+
+	release, err := limiter.Acquire(context.Background(), Mock)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Acquire(ctx, Mock); err == nil {
+		t.Error("Acquire() error = nil with no free slot")
+	}
+
+	done := make(chan error)
+	go func() {
+		r, err := limiter.Acquire(context.Background(), Mock)
+		if err == nil {
+			r()
+		}
+		done <- err
+	}()
+	release()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Acquire() error = %v after release", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Acquire() did not return after release")
+	}
+	if got := limiter.State(Mock); got.InFlight != 0 || got.Waiting != 0 {
+		t.Errorf("state = %+v, want no requests", got)
+	}
+}
+
+func TestNewClient_WithAdaptiveLimiter(t *testing.T) {
+	srv := sqirvytest.NewAnthropicServer(t)
+	srv.Setenv(t)
+	limiter := NewAdaptiveLimiter(AdaptiveConfig{Initial: 4})
+
+	client, err := NewClient(Anthropic, WithAdaptiveLimiter(limiter))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close()
+
+	srv.Enqueue(sqirvytest.Reply{Text: "ok", Header: map[string]string{"anthropic-ratelimit-requests-remaining": "42"}})
+	if _, err := client.QueryText(context.Background(), assistant, []string{"hello"}, "claude-3-5-haiku-20241022", Options{}); err != nil {
+		t.Fatalf("QueryText() error = %v", err)
+	}
+	if got := limiter.State(Anthropic); got.RemainingRequests != 42 {
+		t.Errorf("RemainingRequests = %d, want 42", got.RemainingRequests)
+	}
+
+	srv.ReplyRateLimit(time.Second)
+	if _, err := client.QueryText(context.Background(), assistant, []string{"hello"}, "claude-3-5-haiku-20241022", Options{}); err == nil {
+		t.Fatal("QueryText() error = nil, want rate limit error")
+	}
+	got := limiter.State(Anthropic)
+	if got.Concurrency != 2 || got.Throttled != 1 || !got.PausedUntil.After(time.Now()) {
+		t.Errorf("state = %+v, want concurrency 2 and a pause", got)
+	}
+}
@@ -27,7 +27,9 @@ var _ Client = (*AnthropicClient)(nil)
 //
 // The Anthropic API key is retrieved from the ANTHROPIC_API_KEY environment variable.
 // Ensure this variable is set before calling this function.
-func NewAnthropicClient() (*AnthropicClient, error) {
+func NewAnthropicClient(opts ...ClientOption) (*AnthropicClient, error) {
+	config := newClientConfig(opts)
+
 	// require api key
 	apiKey := os.Getenv("ANTHROPIC_API_KEY")
 	if apiKey == "" {
@@ -43,8 +45,16 @@ func NewAnthropicClient() (*AnthropicClient, error) {
 		return nil, fmt.Errorf("ANTHROPIC_BASE_URL environment variable not set")
 	}
 
+	// langchaingo expects the base url to include the api version
+	if !strings.HasSuffix(baseUrl, "/v1") {
+		baseUrl = strings.TrimSuffix(baseUrl, "/") + "/v1"
+	}
+
+	llmOptions := []anthropic.Option{anthropic.WithBaseURL(baseUrl)}
+	llmOptions = append(llmOptions, anthropic.WithHTTPClient(providerHTTPClient(Anthropic, config.httpClient)))
+
 	// Note: langchaingo's anthropic client uses the API key from the environment variable by default.
-	llm, err := anthropic.New()
+	llm, err := anthropic.New(llmOptions...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Anthropic client (check API key and network): %w", err)
 	}
@@ -61,16 +71,23 @@ func NewAnthropicClient() (*AnthropicClient, error) {
 // It returns the generated text or an error if the query fails or the model is invalid.
 // Request timeouts are handled by the input context
 func (c *AnthropicClient) QueryText(ctx context.Context, system string, prompts []string, model string, options Options) (string, error) {
+	return queryText(ctx, c, system, prompts, model, options)
+}
+
+// Query implements the Querier interface. It works like QueryText and also
+// returns the stop reason and token usage reported by Anthropic.
+func (c *AnthropicClient) Query(ctx context.Context, req Request) (*Response, error) {
 	// validate the model
-	provider, err := GetProviderName(model)
+	provider, err := GetProviderName(req.Model)
 	if err != nil || provider != Anthropic {
-		return "", fmt.Errorf("invalid or unsupported Anthropic model: %s", model)
+		return nil, fmt.Errorf("invalid or unsupported Anthropic model: %s", req.Model)
 	}
 
 	// scale the temperature
+	options := req.Options
 	options.Temperature = options.Temperature * c.temperatureScale
-	options.MaxTokens = GetMaxTokens(model)
-	return queryTextLangChain(ctx, c.llm, system, prompts, model, options)
+	options.MaxTokens = GetMaxTokens(req.Model)
+	return queryLangChain(ctx, c.llm, Anthropic, req.System, req.History, req.Prompts, req.Model, options)
 }
 
 // Close implements the Close method for the Client interface.
@@ -0,0 +1,251 @@
+// Package sqirvy provides Anthropic Message Batches support.
+//
+// This file implements BatchJobClient for the Anthropic Message Batches API.
+package sqirvy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// anthropicAPIVersion is the Anthropic API version sent with batch requests
+const anthropicAPIVersion = "2023-06-01"
+
+// AnthropicBatchClient implements the BatchJobClient interface for Anthropic Message Batches.
+type AnthropicBatchClient struct {
+	http batchHTTP
+}
+
+// Ensure AnthropicBatchClient implements the BatchJobClient interface
+var _ BatchJobClient = (*AnthropicBatchClient)(nil)
+
+// NewAnthropicBatchClient creates a new instance of AnthropicBatchClient.
+// It uses the ANTHROPIC_API_KEY and ANTHROPIC_BASE_URL environment variables,
+// like NewAnthropicClient.
+func NewAnthropicBatchClient(opts ...ClientOption) (*AnthropicBatchClient, error) {
+	config := newClientConfig(opts)
+
+	apiKey := os.Getenv("ANTHROPIC_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("ANTHROPIC_API_KEY environment variable not set")
+	}
+	baseURL := os.Getenv("ANTHROPIC_BASE_URL")
+	if baseURL == "" {
+		return nil, fmt.Errorf("ANTHROPIC_BASE_URL environment variable not set")
+	}
+	if !strings.HasSuffix(baseURL, "/v1") {
+		baseURL = strings.TrimSuffix(baseURL, "/") + "/v1"
+	}
+
+	httpClient := config.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &AnthropicBatchClient{http: batchHTTP{
+		client:  httpClient,
+		baseURL: baseURL,
+		header: http.Header{
+			"X-Api-Key":         {apiKey},
+			"Anthropic-Version": {anthropicAPIVersion},
+		},
+	}}, nil
+}
+
+// anthropicBatch is the Message Batches api batch object
+type anthropicBatch struct {
+	ID               string `json:"id"`
+	ProcessingStatus string `json:"processing_status"`
+	RequestCounts    struct {
+		Processing int `json:"processing"`
+		Succeeded  int `json:"succeeded"`
+		Errored    int `json:"errored"`
+		Canceled   int `json:"canceled"`
+		Expired    int `json:"expired"`
+	} `json:"request_counts"`
+	CreatedAt  time.Time  `json:"created_at"`
+	EndedAt    *time.Time `json:"ended_at"`
+	ResultsURL string     `json:"results_url"`
+}
+
+// job converts the batch object to a BatchJob
+func (b anthropicBatch) job() *BatchJob {
+	c := b.RequestCounts
+	job := &BatchJob{
+		ID:        b.ID,
+		Provider:  Anthropic,
+		CreatedAt: b.CreatedAt,
+		Counts: BatchJobCounts{
+			Total:      c.Processing + c.Succeeded + c.Errored + c.Canceled + c.Expired,
+			Processing: c.Processing,
+			Succeeded:  c.Succeeded,
+			Failed:     c.Errored + c.Canceled + c.Expired,
+		},
+	}
+	if b.EndedAt != nil {
+		job.EndedAt = *b.EndedAt
+	}
+	switch b.ProcessingStatus {
+	case "canceling":
+		job.Status = BatchJobCancelling
+	case "ended":
+		job.Status = BatchJobEnded
+		if c.Canceled > 0 && c.Succeeded+c.Errored == 0 {
+			job.Status = BatchJobCancelled
+		} else if c.Expired > 0 && c.Succeeded+c.Errored == 0 {
+			job.Status = BatchJobExpired
+		}
+	default:
+		job.Status = BatchJobInProgress
+	}
+	return job
+}
+
+// anthropicBatchRequest is one request of a Message Batches job
+type anthropicBatchRequest struct {
+	CustomID string `json:"custom_id"`
+	Params   struct {
+		Model       string        `json:"model"`
+		MaxTokens   int64         `json:"max_tokens"`
+		System      string        `json:"system,omitempty"`
+		Temperature float32       `json:"temperature"`
+		Messages    []chatMessage `json:"messages"`
+	} `json:"params"`
+}
+
+// SubmitBatch creates a Message Batches job for the requests.
+func (c *AnthropicBatchClient) SubmitBatch(ctx context.Context, requests []BatchJobRequest) (*BatchJob, error) {
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("batch requests cannot be empty")
+	}
+
+	var body struct {
+		Requests []anthropicBatchRequest `json:"requests"`
+	}
+	for _, r := range requests {
+		if len(r.Prompts) == 0 {
+			return nil, fmt.Errorf("prompts cannot be empty for batch request %s", r.CustomID)
+		}
+		var br anthropicBatchRequest
+		br.CustomID = r.CustomID
+		br.Params.Model = r.Model
+		br.Params.MaxTokens = batchMaxTokens(r.Request)
+		br.Params.System = r.System
+		br.Params.Temperature = r.Options.Temperature
+		for _, message := range r.History {
+			br.Params.Messages = append(br.Params.Messages, chatMessage{Role: message.Role, Content: message.Text})
+		}
+		// consecutive user prompts are sent as one message, as the api requires alternating roles
+		br.Params.Messages = append(br.Params.Messages, chatMessage{Role: "user", Content: strings.Join(r.Prompts, "\n\n")})
+		body.Requests = append(body.Requests, br)
+	}
+
+	var batch anthropicBatch
+	if err := c.http.do(ctx, http.MethodPost, "/messages/batches", body, &batch); err != nil {
+		return nil, fmt.Errorf("failed to submit batch: %w", err)
+	}
+	return batch.job(), nil
+}
+
+// get returns the batch object
+func (c *AnthropicBatchClient) get(ctx context.Context, id string) (anthropicBatch, error) {
+	var batch anthropicBatch
+	if err := c.http.do(ctx, http.MethodGet, "/messages/batches/"+id, nil, &batch); err != nil {
+		return batch, fmt.Errorf("failed to get batch %s: %w", id, err)
+	}
+	return batch, nil
+}
+
+// GetBatch returns the current state of a Message Batches job.
+func (c *AnthropicBatchClient) GetBatch(ctx context.Context, id string) (*BatchJob, error) {
+	batch, err := c.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return batch.job(), nil
+}
+
+// CancelBatch requests cancellation of a Message Batches job.
+func (c *AnthropicBatchClient) CancelBatch(ctx context.Context, id string) (*BatchJob, error) {
+	var batch anthropicBatch
+	if err := c.http.do(ctx, http.MethodPost, "/messages/batches/"+id+"/cancel", nil, &batch); err != nil {
+		return nil, fmt.Errorf("failed to cancel batch %s: %w", id, err)
+	}
+	return batch.job(), nil
+}
+
+// anthropicBatchResult is one line of the Message Batches results file
+type anthropicBatchResult struct {
+	CustomID string `json:"custom_id"`
+	Result   struct {
+		Type    string `json:"type"` // succeeded, errored, canceled or expired
+		Message struct {
+			Model   string `json:"model"`
+			Content []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"content"`
+			StopReason string `json:"stop_reason"`
+			Usage      Usage  `json:"usage"`
+		} `json:"message"`
+		Error struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"error"`
+	} `json:"result"`
+}
+
+// BatchResults returns the results of an ended Message Batches job.
+func (c *AnthropicBatchClient) BatchResults(ctx context.Context, id string) ([]BatchJobResult, error) {
+	batch, err := c.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if batch.ResultsURL == "" {
+		return nil, fmt.Errorf("batch %s has no results yet (status %s)", id, batch.ProcessingStatus)
+	}
+
+	data, err := c.http.send(ctx, http.MethodGet, batch.ResultsURL, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get results of batch %s: %w", id, err)
+	}
+
+	var results []BatchJobResult
+	for _, line := range splitJSONLines(data) {
+		var r anthropicBatchResult
+		if err := json.Unmarshal(line, &r); err != nil {
+			return nil, fmt.Errorf("invalid result in batch %s: %w", id, err)
+		}
+		result := BatchJobResult{CustomID: r.CustomID}
+		switch r.Result.Type {
+		case "succeeded":
+			m := r.Result.Message
+			var text strings.Builder
+			for _, part := range m.Content {
+				if part.Type == "text" {
+					text.WriteString(part.Text)
+				}
+			}
+			result.Response = &Response{
+				Text:       text.String(),
+				Provider:   Anthropic,
+				Model:      m.Model,
+				StopReason: m.StopReason,
+				Usage:      m.Usage,
+			}
+		case "errored":
+			e := r.Result.Error.Error
+			result.Error = fmt.Sprintf("%s: %s", e.Type, e.Message)
+		default:
+			result.Error = r.Result.Type
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,103 @@
+// Package sqirvy provides concurrent batch queries.
+//
+// This file implements BatchQuery, which sends many requests through any Client
+// with a bounded number of workers. Results are returned in input order, each
+// with its own error, so one failed request does not abort the batch.
+package sqirvy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// default number of concurrent requests of a batch
+const batchWorkersDefault = 4
+
+// BatchOptions configures BatchQuery.
+type BatchOptions struct {
+	// Workers is the number of requests sent concurrently (default 4)
+	Workers int
+	// OnProgress, if set, is called after each request completes with the number of
+	// completed requests, the total, and the result. Calls are not concurrent.
+	OnProgress func(done, total int, result BatchResult)
+}
+
+// BatchResult is the result of one request of a batch.
+type BatchResult struct {
+	Index    int           // index of the request in the batch
+	Request  Request       // the request
+	Response *Response     // the response, nil if Err is set
+	Err      error         // the error of this request
+	Duration time.Duration // time taken by the request
+}
+
+// BatchQuery sends the requests through the client using opts.Workers concurrent
+// workers and returns one result per request, in input order. Errors of single
+// requests are reported in their results and do not stop the batch.
+//
+// If the context is cancelled, no new requests are started, requests in progress
+// end with the context error, and requests that were not started get an error
+// result. BatchQuery then returns the results along with the context error.
+func BatchQuery(ctx context.Context, client Client, requests []Request, opts BatchOptions) ([]BatchResult, error) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = batchWorkersDefault
+	}
+	workers = min(workers, max(1, len(requests)))
+
+	results := make([]BatchResult, len(requests))
+	started := make([]bool, len(requests))
+
+	var mu sync.Mutex // serializes progress callbacks
+	done := 0
+	finish := func(result BatchResult) {
+		results[result.Index] = result
+		mu.Lock()
+		defer mu.Unlock()
+		done++
+		if opts.OnProgress != nil {
+			opts.OnProgress(done, len(requests), result)
+		}
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				start := time.Now()
+				resp, err := Query(ctx, client, requests[i])
+				finish(BatchResult{Index: i, Request: requests[i], Response: resp, Err: err, Duration: time.Since(start)})
+			}
+		}()
+	}
+
+dispatch:
+	for i := range requests {
+		select {
+		case indexes <- i:
+			started[i] = true
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	// the batch stopped only if the context ended before every request was started
+	stopped := false
+	for i, ok := range started {
+		if !ok {
+			stopped = true
+			results[i] = BatchResult{Index: i, Request: requests[i], Err: fmt.Errorf("request context error %w", ctx.Err())}
+		}
+	}
+	if !stopped {
+		return results, nil
+	}
+	return results, fmt.Errorf("batch stopped: %w", ctx.Err())
+}
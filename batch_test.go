@@ -0,0 +1,110 @@
+package sqirvy
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBatchQuery(t *testing.T) {
+	client := NewMockClientWithResponses(
+		MockResponse{Match: "fail", Error: "overloaded"},
+		MockResponse{Match: "slow", Text: "slow", LatencyMS: 30},
+	)
+	prompts := []string{"slow", "one", "fail", "two", "three"}
+	var requests []Request
+	for _, p := range prompts {
+		requests = append(requests, Request{System: assistant, Prompts: []string{p}, Model: "mock"})
+	}
+
+	var calls atomic.Int32
+	last := 0
+	results, err := BatchQuery(context.Background(), client, requests, BatchOptions{
+		Workers: 2,
+		OnProgress: func(done, total int, result BatchResult) {
+			calls.Add(1)
+			if done != last+1 || total != len(prompts) {
+				t.Errorf("OnProgress(%d, %d) after %d", done, total, last)
+			}
+			last = done
+		},
+	})
+	if err != nil {
+		t.Fatalf("BatchQuery() error = %v", err)
+	}
+	if int(calls.Load()) != len(prompts) {
+		t.Errorf("OnProgress called %d times, want %d", calls.Load(), len(prompts))
+	}
+
+	for i, result := range results {
+		if result.Index != i {
+			t.Errorf("results[%d].Index = %d", i, result.Index)
+		}
+		if prompts[i] == "fail" {
+			if result.Err == nil {
+				t.Errorf("results[%d].Err = nil, want error", i)
+			}
+			continue
+		}
+		want := prompts[i]
+		if result.Err != nil || result.Response.Text != want {
+			t.Errorf("results[%d] = %+v, want %q", i, result, want)
+		}
+	}
+}
+
+func TestBatchQuery_Cancel(t *testing.T) {
+	client := NewMockClientWithResponses(MockResponse{Text: "ok", LatencyMS: 50})
+	var requests []Request
+	for i := 0; i < 10; i++ {
+		requests = append(requests, Request{Prompts: []string{fmt.Sprint(i)}, Model: "mock"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	results, err := BatchQuery(ctx, client, requests, BatchOptions{Workers: 2})
+	if err == nil {
+		t.Fatal("BatchQuery() error = nil, want context error")
+	}
+	if len(results) != len(requests) {
+		t.Fatalf("BatchQuery() returned %d results, want %d", len(results), len(requests))
+	}
+	for i, result := range results {
+		if result.Err == nil {
+			t.Errorf("results[%d].Err = nil after cancel", i)
+		}
+	}
+	if got := len(client.Requests()); got > 4 {
+		t.Errorf("client received %d requests after cancel, want at most 4", got)
+	}
+}
+
+func TestBatchQuery_CancelAfterLast(t *testing.T) {
+	client := NewMockClientWithResponses(MockResponse{Text: "ok"})
+	requests := []Request{
+		{Prompts: []string{"a"}, Model: "mock"},
+		{Prompts: []string{"b"}, Model: "mock"},
+	}
+
+	// the context ends after every request finished
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results, err := BatchQuery(ctx, client, requests, BatchOptions{
+		Workers: 2,
+		OnProgress: func(done, total int, result BatchResult) {
+			if done == total {
+				cancel()
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("BatchQuery() error = %v, want nil when every request finished", err)
+	}
+	for i, result := range results {
+		if result.Err != nil {
+			t.Errorf("results[%d].Err = %v", i, result.Err)
+		}
+	}
+}
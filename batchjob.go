@@ -0,0 +1,248 @@
+// Package sqirvy provides asynchronous provider batch jobs.
+//
+// This file defines the common job and result types for the discounted batch
+// APIs of Anthropic (Message Batches) and OpenAI (Batch API). A batch job is
+// submitted once, processed by the provider within hours, and its results are
+// fetched when the job has ended.
+package sqirvy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// BatchJobStatus is the processing status of a provider batch job.
+type BatchJobStatus string
+
+const (
+	BatchJobInProgress BatchJobStatus = "in_progress" // the provider is processing the requests
+	BatchJobCancelling BatchJobStatus = "cancelling"  // a cancel was requested
+	BatchJobEnded      BatchJobStatus = "ended"       // processing ended, results are available
+	BatchJobCancelled  BatchJobStatus = "cancelled"   // the job was cancelled, partial results may be available
+	BatchJobFailed     BatchJobStatus = "failed"      // the job failed, e.g. invalid input
+	BatchJobExpired    BatchJobStatus = "expired"     // the job did not complete in time, partial results may be available
+)
+
+// Done reports whether the job has stopped processing.
+func (s BatchJobStatus) Done() bool {
+	switch s {
+	case BatchJobEnded, BatchJobCancelled, BatchJobFailed, BatchJobExpired:
+		return true
+	}
+	return false
+}
+
+// BatchJobRequest is one request of a provider batch job.
+type BatchJobRequest struct {
+	CustomID string // caller id of the request, unique within the job
+	Request
+}
+
+// BatchJobCounts counts the requests of a batch job by outcome.
+type BatchJobCounts struct {
+	Total      int `json:"total"`
+	Processing int `json:"processing"`
+	Succeeded  int `json:"succeeded"`
+	Failed     int `json:"failed"`
+}
+
+// BatchJob describes a provider batch job.
+type BatchJob struct {
+	ID        string         `json:"id"`
+	Provider  string         `json:"provider"`
+	Status    BatchJobStatus `json:"status"`
+	Counts    BatchJobCounts `json:"counts"`
+	CreatedAt time.Time      `json:"created_at"`
+	EndedAt   time.Time      `json:"ended_at,omitzero"`
+}
+
+// BatchJobResult is the result of one request of a batch job.
+type BatchJobResult struct {
+	CustomID string    `json:"custom_id"`
+	Response *Response `json:"response,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// BatchJobClient submits and manages provider batch jobs.
+type BatchJobClient interface {
+	// SubmitBatch creates a batch job for the requests
+	SubmitBatch(ctx context.Context, requests []BatchJobRequest) (*BatchJob, error)
+	// GetBatch returns the current state of a batch job
+	GetBatch(ctx context.Context, id string) (*BatchJob, error)
+	// CancelBatch requests cancellation of a batch job
+	CancelBatch(ctx context.Context, id string) (*BatchJob, error)
+	// BatchResults returns the results of a batch job that is done
+	BatchResults(ctx context.Context, id string) ([]BatchJobResult, error)
+}
+
+// NewBatchJobClient creates a batch job client for the provider. Anthropic and OpenAI
+// are supported and use the same environment variables as NewAnthropicClient and
+// NewOpenAIClient. Only WithHTTPClient applies to batch job clients.
+func NewBatchJobClient(provider string, opts ...ClientOption) (BatchJobClient, error) {
+	switch provider {
+	case Anthropic:
+		client, err := NewAnthropicBatchClient(opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create batch client for provider %s: %w", provider, err)
+		}
+		return client, nil
+	case OpenAI:
+		client, err := NewOpenAIBatchClient(opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create batch client for provider %s: %w", provider, err)
+		}
+		return client, nil
+	default:
+		return nil, fmt.Errorf("batch jobs are not supported for provider: %s", provider)
+	}
+}
+
+// BatchJobProvider returns the provider of a batch job id, based on the id prefixes
+// used by the providers. It returns an error for an unrecognized id.
+func BatchJobProvider(id string) (string, error) {
+	switch {
+	case strings.HasPrefix(id, "msgbatch_"):
+		return Anthropic, nil
+	case strings.HasPrefix(id, "batch_"):
+		return OpenAI, nil
+	}
+	return "", fmt.Errorf("unrecognized batch job id: %s", id)
+}
+
+// WaitBatch polls a batch job every interval until it is done or the context ends.
+func WaitBatch(ctx context.Context, client BatchJobClient, id string, interval time.Duration) (*BatchJob, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		job, err := client.GetBatch(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if job.Status.Done() {
+			return job, nil
+		}
+		select {
+		case <-ctx.Done():
+			return job, fmt.Errorf("request context error %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// chatMessage is a text message of an Anthropic or OpenAI batch request
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// batchHTTP sends json requests to a provider batch api
+type batchHTTP struct {
+	client  *http.Client
+	baseURL string
+	header  http.Header
+}
+
+// do sends a request with an optional json body and decodes a json response into out.
+// body may also be an io.Reader with contentType set in header.
+func (h *batchHTTP) do(ctx context.Context, method, path string, body any, out any) error {
+	data, err := h.send(ctx, method, path, body, nil)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// send sends a request and returns the response body. An error is returned for non-2xx responses.
+func (h *batchHTTP) send(ctx context.Context, method, path string, body any, header http.Header) ([]byte, error) {
+	var reader io.Reader
+	contentType := ""
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		reader = b
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+
+	url := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		url = h.baseURL + path
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, v := range h.header {
+		req.Header[k] = v
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// same form as the langchaingo errors, so ClassifyError recognizes the status
+		return nil, fmt.Errorf("API returned unexpected status code: %d: %s", resp.StatusCode, apiErrorMessage(data))
+	}
+	return data, nil
+}
+
+// apiErrorMessage returns the message of an Anthropic or OpenAI error response body
+func apiErrorMessage(body []byte) string {
+	var e struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &e) == nil && e.Error.Message != "" {
+		return e.Error.Message
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// splitJSONLines returns the non-empty lines of a JSONL document
+func splitJSONLines(data []byte) [][]byte {
+	var lines [][]byte
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// batchMaxTokens returns the max tokens for a batch request, the model limit if not set
+func batchMaxTokens(req Request) int64 {
+	if req.Options.MaxTokens > 0 {
+		return req.Options.MaxTokens
+	}
+	return GetMaxTokens(req.Model)
+}
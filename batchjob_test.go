@@ -0,0 +1,237 @@
+package sqirvy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBatchJobProvider(t *testing.T) {
+	tests := []struct {
+		id      string
+		want    string
+		wantErr bool
+	}{
+		{"msgbatch_013Zva2CMHLNnXjNJJKqJ2EF", Anthropic, false},
+		{"batch_abc123", OpenAI, false},
+		{"job-1", "", true},
+	}
+	for _, tt := range tests {
+		got, err := BatchJobProvider(tt.id)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("BatchJobProvider(%q) = %q, %v, want %q", tt.id, got, err, tt.want)
+		}
+	}
+}
+
+func TestNewBatchJobClient_Unsupported(t *testing.T) {
+	if _, err := NewBatchJobClient(Gemini); err == nil {
+		t.Errorf("NewBatchJobClient(%q) error = nil, want error", Gemini)
+	}
+}
+
+func TestAnthropicBatchClient(t *testing.T) {
+	var submitted struct {
+		Requests []anthropicBatchRequest `json:"requests"`
+	}
+	status := "in_progress"
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	batch := func() map[string]any {
+		b := map[string]any{
+			"id":                "msgbatch_1",
+			"processing_status": status,
+			"created_at":        "2026-10-18T10:00:00Z",
+			"request_counts":    map[string]int{"processing": 2},
+		}
+		if status == "ended" {
+			b["request_counts"] = map[string]int{"succeeded": 1, "errored": 1}
+			b["ended_at"] = "2026-10-18T11:00:00Z"
+			b["results_url"] = server.URL + "/v1/messages/batches/msgbatch_1/results"
+		}
+		return b
+	}
+	mux.HandleFunc("POST /v1/messages/batches", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "test-key" || r.Header.Get("Anthropic-Version") == "" {
+			t.Errorf("missing api headers: %v", r.Header)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&submitted); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		json.NewEncoder(w).Encode(batch())
+	})
+	mux.HandleFunc("GET /v1/messages/batches/msgbatch_1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(batch())
+	})
+	mux.HandleFunc("GET /v1/messages/batches/msgbatch_1/results", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"custom_id":"a","result":{"type":"succeeded","message":{"model":"claude-sonnet-4-20250514","content":[{"type":"text","text":"hello"}],"stop_reason":"end_turn","usage":{"input_tokens":10,"output_tokens":2}}}}
+{"custom_id":"b","result":{"type":"errored","error":{"type":"error","error":{"type":"invalid_request_error","message":"bad prompt"}}}}
+`)
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+	t.Setenv("ANTHROPIC_API_KEY", "test-key")
+	t.Setenv("ANTHROPIC_BASE_URL", server.URL)
+
+	client, err := NewBatchJobClient(Anthropic)
+	if err != nil {
+		t.Fatalf("NewBatchJobClient() error = %v", err)
+	}
+	ctx := context.Background()
+	job, err := client.SubmitBatch(ctx, []BatchJobRequest{
+		{CustomID: "a", Request: Request{System: assistant, Prompts: []string{"hi"}, Model: "claude-sonnet-4-20250514"}},
+		{CustomID: "b", Request: Request{Prompts: []string{"x", "y"}, Model: "claude-sonnet-4-20250514", Options: Options{MaxTokens: 100}}},
+	})
+	if err != nil {
+		t.Fatalf("SubmitBatch() error = %v", err)
+	}
+	if job.ID != "msgbatch_1" || job.Status != BatchJobInProgress || job.Counts.Total != 2 {
+		t.Errorf("SubmitBatch() = %+v", job)
+	}
+	if len(submitted.Requests) != 2 {
+		t.Fatalf("submitted %d requests, want 2", len(submitted.Requests))
+	}
+	if p := submitted.Requests[0].Params; p.System != assistant || p.MaxTokens != GetMaxTokens(p.Model) {
+		t.Errorf("submitted params = %+v", p)
+	}
+	if p := submitted.Requests[1].Params; p.MaxTokens != 100 || len(p.Messages) != 1 || p.Messages[0].Content != "x\n\ny" {
+		t.Errorf("submitted params = %+v", p)
+	}
+
+	if _, err := client.BatchResults(ctx, job.ID); err == nil {
+		t.Errorf("BatchResults() error = nil before the batch ended")
+	}
+
+	status = "ended"
+	job, err = WaitBatch(ctx, client, job.ID, time.Millisecond)
+	if err != nil {
+		t.Fatalf("WaitBatch() error = %v", err)
+	}
+	if job.Status != BatchJobEnded || job.Counts.Succeeded != 1 || job.Counts.Failed != 1 || job.EndedAt.IsZero() {
+		t.Errorf("WaitBatch() = %+v", job)
+	}
+
+	results, err := client.BatchResults(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("BatchResults() error = %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("BatchResults() returned %d results, want 2", len(results))
+	}
+	if r := results[0]; r.CustomID != "a" || r.Response == nil || r.Response.Text != "hello" || r.Response.Usage.OutputTokens != 2 {
+		t.Errorf("results[0] = %+v", r)
+	}
+	if r := results[1]; r.CustomID != "b" || r.Response != nil || !strings.Contains(r.Error, "bad prompt") {
+		t.Errorf("results[1] = %+v", r)
+	}
+}
+
+func TestOpenAIBatchClient(t *testing.T) {
+	var input string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /files", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		if r.FormValue("purpose") != "batch" {
+			t.Errorf("purpose = %q, want batch", r.FormValue("purpose"))
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			t.Fatalf("FormFile() error = %v", err)
+		}
+		data, _ := io.ReadAll(file)
+		input = string(data)
+		io.WriteString(w, `{"id":"file-in"}`)
+	})
+	mux.HandleFunc("POST /batches", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["input_file_id"] != "file-in" || body["endpoint"] != openaiBatchEndpoint {
+			t.Errorf("create batch body = %v", body)
+		}
+		io.WriteString(w, `{"id":"batch_1","status":"validating","created_at":1760781600,"request_counts":{"total":0}}`)
+	})
+	mux.HandleFunc("GET /batches/batch_1", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"id":"batch_1","status":"completed","created_at":1760781600,"completed_at":1760785200,
+			"output_file_id":"file-out","error_file_id":"file-err","request_counts":{"total":2,"completed":1,"failed":1}}`)
+	})
+	mux.HandleFunc("POST /batches/batch_1/cancel", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"id":"batch_1","status":"cancelling","created_at":1760781600}`)
+	})
+	mux.HandleFunc("GET /files/file-out/content", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"custom_id":"a","response":{"status_code":200,"body":{"model":"gpt-5","choices":[{"message":{"content":"hello"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":2}}}}`+"\n")
+	})
+	mux.HandleFunc("GET /files/file-err/content", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"custom_id":"b","response":{"status_code":400,"body":{"error":{"message":"bad prompt"}}}}`+"\n")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	t.Setenv("OPENAI_BASE_URL", server.URL)
+
+	client, err := NewBatchJobClient(OpenAI)
+	if err != nil {
+		t.Fatalf("NewBatchJobClient() error = %v", err)
+	}
+	ctx := context.Background()
+	job, err := client.SubmitBatch(ctx, []BatchJobRequest{
+		{CustomID: "a", Request: Request{System: assistant, Prompts: []string{"hi"}, Model: "gpt-5", Options: Options{Temperature: 0.5}}},
+		{CustomID: "b", Request: Request{Prompts: []string{"x"}, Model: "gpt-5"}},
+	})
+	if err != nil {
+		t.Fatalf("SubmitBatch() error = %v", err)
+	}
+	if job.ID != "batch_1" || job.Status != BatchJobInProgress {
+		t.Errorf("SubmitBatch() = %+v", job)
+	}
+
+	lines := splitJSONLines([]byte(input))
+	if len(lines) != 2 {
+		t.Fatalf("uploaded %d lines, want 2", len(lines))
+	}
+	var line openaiBatchLine
+	if err := json.Unmarshal(lines[0], &line); err != nil {
+		t.Fatalf("invalid input line: %v", err)
+	}
+	if line.CustomID != "a" || line.URL != openaiBatchEndpoint || len(line.Body.Messages) != 2 ||
+		line.Body.Messages[0].Role != "system" || line.Body.Temperature != 0.5*openai_temperature_scale {
+		t.Errorf("input line = %+v", line)
+	}
+
+	job, err = client.GetBatch(ctx, "batch_1")
+	if err != nil {
+		t.Fatalf("GetBatch() error = %v", err)
+	}
+	if job.Status != BatchJobEnded || job.Counts.Succeeded != 1 || job.Counts.Failed != 1 || job.EndedAt.IsZero() {
+		t.Errorf("GetBatch() = %+v", job)
+	}
+
+	results, err := client.BatchResults(ctx, "batch_1")
+	if err != nil {
+		t.Fatalf("BatchResults() error = %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("BatchResults() returned %d results, want 2", len(results))
+	}
+	if r := results[0]; r.CustomID != "a" || r.Response == nil || r.Response.Text != "hello" || r.Response.Usage.InputTokens != 10 {
+		t.Errorf("results[0] = %+v", r)
+	}
+	if r := results[1]; r.CustomID != "b" || !strings.Contains(r.Error, "bad prompt") {
+		t.Errorf("results[1] = %+v", r)
+	}
+
+	job, err = client.CancelBatch(ctx, "batch_1")
+	if err != nil || job.Status != BatchJobCancelling {
+		t.Errorf("CancelBatch() = %+v, %v", job, err)
+	}
+
+	if _, err := client.GetBatch(ctx, "batch_missing"); ClassifyError(err) != ErrorInvalidRequest {
+		t.Errorf("GetBatch() of unknown batch error = %v, want invalid request", err)
+	}
+}
@@ -0,0 +1,290 @@
+// Package sqirvy provides a circuit breaker per provider.
+//
+// This file implements CircuitBreaker, which stops sending requests to a
+// provider after repeated failures. A closed circuit passes requests through.
+// After FailureThreshold consecutive failures the circuit opens and requests
+// fail fast with a CircuitOpenError. After the cool-down window the circuit is
+// half-open: a limited number of probe requests are allowed, and the circuit
+// closes if they succeed or opens again if they fail.
+package sqirvy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a provider circuit.
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"    // requests pass through
+	CircuitOpen     CircuitState = "open"      // requests fail fast
+	CircuitHalfOpen CircuitState = "half_open" // probe requests test the provider
+)
+
+// ErrCircuitOpen is matched by errors.Is for every CircuitOpenError.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitOpenError is returned for requests rejected by an open circuit, or by a
+// half-open circuit with all probes in progress.
+type CircuitOpenError struct {
+	Provider string
+	RetryAt  time.Time // when the circuit becomes half-open, zero if it is half-open
+	// HalfOpen is set when the circuit is half-open. It may close as soon as a probe
+	// succeeds, so the request can be retried soon.
+	HalfOpen bool
+}
+
+// Error implements the error interface.
+func (e *CircuitOpenError) Error() string {
+	if e.HalfOpen {
+		return fmt.Sprintf("circuit breaker is half-open for provider %s, waiting for probe requests", e.Provider)
+	}
+	return fmt.Sprintf("circuit breaker is open for provider %s until %s", e.Provider, e.RetryAt.Format(time.RFC3339))
+}
+
+// Is reports whether target is ErrCircuitOpen.
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// BreakerConfig configures a CircuitBreaker. Zero fields use the defaults.
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens a circuit (default 5)
+	FailureThreshold int
+	// CoolDown is how long a circuit stays open before it becomes half-open (default 30s)
+	CoolDown time.Duration
+	// HalfOpenRequests is the number of probe requests allowed while half-open (default 1)
+	HalfOpenRequests int
+	// IsFailure reports whether an error counts as a provider failure. The default is
+	// IsRetryable: rate limits, overloads, timeouts and server errors. Other errors,
+	// such as invalid requests, do not count. Requests of a CircuitBreakerClient that
+	// end because their own context is canceled or times out never count.
+	IsFailure func(error) bool
+	// OnStateChange, if set, is called after a circuit changes state
+	OnStateChange func(provider string, from, to CircuitState)
+}
+
+// circuit is the state of one provider
+type circuit struct {
+	state    CircuitState
+	failures int       // consecutive failures while closed
+	openedAt time.Time // when the circuit last opened
+	probes   int       // probe requests in progress while half-open
+}
+
+// CircuitBreaker tracks a circuit per provider. It is safe for concurrent use.
+type CircuitBreaker struct {
+	config   BreakerConfig
+	mu       sync.Mutex
+	circuits map[string]*circuit
+	now      func() time.Time
+}
+
+// NewCircuitBreaker creates a CircuitBreaker with all circuits closed.
+func NewCircuitBreaker(config BreakerConfig) *CircuitBreaker {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 5
+	}
+	if config.CoolDown <= 0 {
+		config.CoolDown = 30 * time.Second
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = 1
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = IsRetryable
+	}
+	return &CircuitBreaker{config: config, circuits: make(map[string]*circuit), now: time.Now}
+}
+
+// circuit returns the circuit of a provider, creating it if needed. The caller must hold b.mu.
+func (b *CircuitBreaker) circuit(provider string) *circuit {
+	c, ok := b.circuits[provider]
+	if !ok {
+		c = &circuit{state: CircuitClosed}
+		b.circuits[provider] = c
+	}
+	return c
+}
+
+// transition changes the state of a circuit and returns a function that runs the
+// state change hook. The caller must hold b.mu and run the function after unlocking.
+func (b *CircuitBreaker) transition(provider string, c *circuit, to CircuitState) func() {
+	from := c.state
+	if from == to {
+		return func() {}
+	}
+	c.state = to
+	switch to {
+	case CircuitOpen:
+		c.openedAt = b.now()
+	case CircuitClosed:
+		c.failures = 0
+	}
+	c.probes = 0
+	hook := b.config.OnStateChange
+	return func() {
+		if hook != nil {
+			hook(provider, from, to)
+		}
+	}
+}
+
+// State returns the state of a provider circuit.
+func (b *CircuitBreaker) State(provider string) CircuitState {
+	b.mu.Lock()
+	c := b.circuit(provider)
+	notify := func() {}
+	if c.state == CircuitOpen && !b.now().Before(c.openedAt.Add(b.config.CoolDown)) {
+		notify = b.transition(provider, c, CircuitHalfOpen)
+	}
+	state := c.state
+	b.mu.Unlock()
+	notify()
+	return state
+}
+
+// Allow reports whether a request to the provider may be sent. If it may, the
+// returned function must be called with the result of the request. If the circuit
+// is open, or half-open with all probes in progress, Allow returns a *CircuitOpenError.
+func (b *CircuitBreaker) Allow(provider string) (func(error), error) {
+	b.mu.Lock()
+	c := b.circuit(provider)
+	notify := func() {}
+	if c.state == CircuitOpen && !b.now().Before(c.openedAt.Add(b.config.CoolDown)) {
+		notify = b.transition(provider, c, CircuitHalfOpen)
+	}
+
+	var err error
+	switch c.state {
+	case CircuitOpen:
+		err = &CircuitOpenError{Provider: provider, RetryAt: c.openedAt.Add(b.config.CoolDown)}
+	case CircuitHalfOpen:
+		if c.probes >= b.config.HalfOpenRequests {
+			err = &CircuitOpenError{Provider: provider, HalfOpen: true}
+		} else {
+			c.probes++
+		}
+	}
+	state := c.state
+	b.mu.Unlock()
+	notify()
+
+	if err != nil {
+		return nil, err
+	}
+	return func(result error) { b.done(provider, state, result) }, nil
+}
+
+// errRequestContextDone is the result of a request that ended because its context
+// was done, which is neither a success nor a failure of the provider
+var errRequestContextDone = errors.New("request context done")
+
+// done records the result of a request allowed in the given state
+func (b *CircuitBreaker) done(provider string, allowedIn CircuitState, result error) {
+	b.mu.Lock()
+	c := b.circuit(provider)
+	if errors.Is(result, errRequestContextDone) {
+		// the request says nothing about the provider, only its probe slot is released
+		if c.state == CircuitHalfOpen && allowedIn == CircuitHalfOpen {
+			c.probes = max(0, c.probes-1)
+		}
+		b.mu.Unlock()
+		return
+	}
+	failed := result != nil && b.config.IsFailure(result)
+	notify := func() {}
+
+	switch c.state {
+	case CircuitClosed:
+		if !failed {
+			c.failures = 0
+			break
+		}
+		c.failures++
+		if c.failures >= b.config.FailureThreshold {
+			notify = b.transition(provider, c, CircuitOpen)
+		}
+	case CircuitHalfOpen:
+		if allowedIn != CircuitHalfOpen {
+			// a request sent before the circuit opened
+			break
+		}
+		c.probes = max(0, c.probes-1)
+		if failed {
+			notify = b.transition(provider, c, CircuitOpen)
+		} else if result == nil {
+			notify = b.transition(provider, c, CircuitClosed)
+		}
+	}
+	b.mu.Unlock()
+	notify()
+}
+
+// Reset closes the circuit of a provider.
+func (b *CircuitBreaker) Reset(provider string) {
+	b.mu.Lock()
+	notify := b.transition(provider, b.circuit(provider), CircuitClosed)
+	b.mu.Unlock()
+	notify()
+}
+
+// CircuitBreakerClient wraps a Client with the circuit of a provider.
+type CircuitBreakerClient struct {
+	client   Client
+	provider string
+	breaker  *CircuitBreaker
+}
+
+// Ensure CircuitBreakerClient implements the Client and Querier interfaces
+var (
+	_ Client  = (*CircuitBreakerClient)(nil)
+	_ Querier = (*CircuitBreakerClient)(nil)
+)
+
+// NewCircuitBreakerClient wraps client with the circuit of provider in breaker.
+func NewCircuitBreakerClient(client Client, provider string, breaker *CircuitBreaker) *CircuitBreakerClient {
+	return &CircuitBreakerClient{client: client, provider: provider, breaker: breaker}
+}
+
+// QueryText sends the query to the wrapped client unless the circuit is open.
+func (c *CircuitBreakerClient) QueryText(ctx context.Context, system string, prompts []string, model string, options Options) (string, error) {
+	return queryText(ctx, c, system, prompts, model, options)
+}
+
+// Query implements the Querier interface.
+func (c *CircuitBreakerClient) Query(ctx context.Context, req Request) (*Response, error) {
+	return c.intercept(ctx, req, ClientHandler(c.client))
+}
+
+// intercept implements the middleware of the client, sending requests to next
+func (c *CircuitBreakerClient) intercept(ctx context.Context, req Request, next Handler) (*Response, error) {
+	done, err := c.breaker.Allow(c.provider)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := next(ctx, req)
+	if err != nil && ctx.Err() != nil {
+		// a request that failed because its own context was canceled or timed out
+		// does not count as a provider failure
+		done(errRequestContextDone)
+	} else {
+		done(err)
+	}
+	return resp, err
+}
+
+// CircuitBreakerMiddleware returns the middleware of a CircuitBreakerClient: it fails
+// requests fast while the circuit of provider is open.
+func CircuitBreakerMiddleware(provider string, breaker *CircuitBreaker) Middleware {
+	return NewCircuitBreakerClient(nil, provider, breaker).intercept
+}
+
+// Close closes the wrapped client.
+func (c *CircuitBreakerClient) Close() error {
+	return c.client.Close()
+}
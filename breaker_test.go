@@ -0,0 +1,151 @@
+package sqirvy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var mu sync.Mutex
+	var changes []string
+	breaker := NewCircuitBreaker(BreakerConfig{
+		FailureThreshold: 2,
+		CoolDown:         time.Minute,
+		OnStateChange: func(provider string, from, to CircuitState) {
+			mu.Lock()
+			defer mu.Unlock()
+			changes = append(changes, string(from)+"->"+string(to))
+		},
+	})
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+
+	overloaded := errors.New("API returned unexpected status code: 529: Overloaded")
+	invalid := errors.New("API returned unexpected status code: 400: bad request")
+
+	steps := []struct {
+		name      string
+		advance   time.Duration
+		result    error // result of the request, if allowed
+		wantOpen  bool  // whether Allow is rejected
+		wantState CircuitState
+	}{
+		{name: "Invalid request does not count", result: invalid, wantState: CircuitClosed},
+		{name: "First failure", result: overloaded, wantState: CircuitClosed},
+		{name: "Second failure opens", result: overloaded, wantState: CircuitOpen},
+		{name: "Open fails fast", wantOpen: true, wantState: CircuitOpen},
+		{name: "Failed probe reopens", advance: time.Minute, result: overloaded, wantState: CircuitOpen},
+		{name: "Successful probe closes", advance: time.Minute, result: nil, wantState: CircuitClosed},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		done, err := breaker.Allow(Mock)
+		if step.wantOpen {
+			var openErr *CircuitOpenError
+			if !errors.As(err, &openErr) || !errors.Is(err, ErrCircuitOpen) {
+				t.Errorf("%s: Allow() error = %v, want CircuitOpenError", step.name, err)
+			}
+		} else if err != nil {
+			t.Fatalf("%s: Allow() error = %v", step.name, err)
+		} else {
+			done(step.result)
+		}
+		if got := breaker.State(Mock); got != step.wantState {
+			t.Errorf("%s: State() = %s, want %s", step.name, got, step.wantState)
+		}
+	}
+
+	want := "closed->open,open->half_open,half_open->open,open->half_open,half_open->closed"
+	if got := strings.Join(changes, ","); got != want {
+		t.Errorf("state changes = %s, want %s", got, want)
+	}
+}
+
+func TestCircuitBreaker_HalfOpenProbes(t *testing.T) {
+	breaker := NewCircuitBreaker(BreakerConfig{FailureThreshold: 1, CoolDown: time.Millisecond})
+	done, _ := breaker.Allow(Mock)
+	done(context.DeadlineExceeded)
+	time.Sleep(2 * time.Millisecond)
+
+	probe, err := breaker.Allow(Mock)
+	if err != nil {
+		t.Fatalf("Allow() error = %v, want a probe", err)
+	}
+	_, err = breaker.Allow(Mock)
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) || !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Allow() error = %v while the probe is in progress", err)
+	}
+	if !openErr.HalfOpen || !openErr.RetryAt.IsZero() {
+		t.Errorf("Allow() error = %+v, want half-open without RetryAt", openErr)
+	}
+	probe(nil)
+	if got := breaker.State(Mock); got != CircuitClosed {
+		t.Errorf("State() = %s, want closed", got)
+	}
+}
+
+func TestNewClient_WithCircuitBreaker(t *testing.T) {
+	t.Setenv("MOCK_FIXTURE", "")
+	t.Setenv("MOCK_RECORD", "")
+
+	breaker := NewCircuitBreaker(BreakerConfig{FailureThreshold: 1})
+	client, err := NewClient(Mock, WithCircuitBreaker(breaker))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if _, err := client.QueryText(context.Background(), assistant, []string{"hello"}, "mock", Options{}); err != nil {
+		t.Fatalf("QueryText() error = %v", err)
+	}
+
+	done, _ := breaker.Allow(Mock)
+	done(errors.New("overloaded"))
+	_, err = client.QueryText(context.Background(), assistant, []string{"hello"}, "mock", Options{})
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("QueryText() error = %v, want ErrCircuitOpen", err)
+	}
+	if !ShouldFallback(err) {
+		t.Error("ShouldFallback() = false for an open circuit")
+	}
+}
+
+func TestCircuitBreakerClient_CallerDeadline(t *testing.T) {
+	breaker := NewCircuitBreaker(BreakerConfig{FailureThreshold: 1, CoolDown: time.Minute})
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+	client := NewCircuitBreakerClient(NewMockClientWithResponses(MockResponse{Text: "slow", LatencyMS: 200}), Mock, breaker)
+
+	query := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := client.Query(ctx, Request{System: assistant, Prompts: []string{"hello"}, Model: "mock"})
+		return err
+	}
+
+	// the caller's own deadline is not a provider failure
+	if err := query(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Query() error = %v, want context.DeadlineExceeded", err)
+	}
+	if got := breaker.State(Mock); got != CircuitClosed {
+		t.Errorf("State() = %s after the caller's deadline, want %s", got, CircuitClosed)
+	}
+
+	// a probe that ends with the caller's deadline frees its slot
+	done, _ := breaker.Allow(Mock)
+	done(errors.New("overloaded"))
+	now = now.Add(time.Minute)
+	if err := query(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("probe Query() error = %v, want context.DeadlineExceeded", err)
+	}
+	if got := breaker.State(Mock); got != CircuitHalfOpen {
+		t.Errorf("State() = %s after a canceled probe, want %s", got, CircuitHalfOpen)
+	}
+	if _, err := breaker.Allow(Mock); err != nil {
+		t.Errorf("Allow() error = %v after a canceled probe, want a free probe slot", err)
+	}
+}
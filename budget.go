@@ -0,0 +1,305 @@
+// Package sqirvy provides spend budgets for queries.
+//
+// This file implements Budget, which limits the estimated spend of queries per
+// request, per day and per month, and BudgetClient, a Client wrapper that checks
+// the budget before each query. The cost of a request is estimated before it is
+// sent from its prompt size and reserved output tokens; requests that would exceed
+// a budget, or to models without a price in the model registry, are refused with
+// ErrBudgetExceeded unless the context allows them with WithBudgetForce. The spend of earlier queries is read from a SpendHistory, such
+// as a SpendTracker or a persistent usage ledger.
+package sqirvy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrBudgetExceeded is returned when the estimated cost of a request would exceed a budget.
+var ErrBudgetExceeded = errors.New("spend budget exceeded")
+
+// Budget periods reported in a BudgetCheck
+const (
+	BudgetPerRequest = "request"
+	BudgetDaily      = "daily"
+	BudgetMonthly    = "monthly"
+)
+
+// spendRetention is how long a SpendTracker keeps the spend of a query, long enough for a monthly budget
+const spendRetention = 62 * 24 * time.Hour
+
+// BudgetConfig configures a Budget. Amounts are in USD; a zero limit is not enforced.
+type BudgetConfig struct {
+	// Daily limits the spend of a calendar day, in local time
+	Daily float64
+	// Monthly limits the spend of a calendar month, in local time
+	Monthly float64
+	// PerRequest limits the estimated cost of a single request
+	PerRequest float64
+	// WarnPercent calls Warn when a request brings the spend of a period to this
+	// percentage of its budget. Zero disables warnings.
+	WarnPercent float64
+	// OutputTokens is the number of output tokens reserved when estimating the cost of
+	// a request. The default is the request MaxTokens, or MAX_TOKENS_DEFAULT.
+	OutputTokens int64
+	// Warn is called for each budget that a request brings above WarnPercent, and for
+	// each budget that a forced request exceeds. It may be nil.
+	Warn func(BudgetCheck)
+}
+
+// BudgetCheck is the state of one budget when a request is checked.
+type BudgetCheck struct {
+	Period    string  // BudgetPerRequest, BudgetDaily or BudgetMonthly
+	Limit     float64 // the budget
+	Spent     float64 // spend of the period so far, including requests in flight
+	Estimated float64 // estimated cost of the request
+	Exceeded  bool    // the request exceeds the budget
+}
+
+// Percent returns the percentage of the budget used including the request.
+func (c BudgetCheck) Percent() float64 {
+	return (c.Spent + c.Estimated) / c.Limit * 100
+}
+
+// SpendHistory reports the recorded spend of earlier queries.
+type SpendHistory interface {
+	// Spend returns the total cost in USD of the queries completed since a time
+	Spend(since time.Time) (float64, error)
+}
+
+// SpendRecorder is a SpendHistory that a Budget records the cost of completed queries to.
+// Histories that are recorded elsewhere, such as a usage ledger, only implement SpendHistory.
+type SpendRecorder interface {
+	SpendHistory
+	// RecordSpend records the cost in USD of a query completed at a time
+	RecordSpend(at time.Time, cost float64) error
+}
+
+// spendEntry is the cost of one completed query
+type spendEntry struct {
+	at   time.Time
+	cost float64
+}
+
+// SpendTracker is an in-memory SpendRecorder. It forgets the spend of queries
+// after 62 days.
+type SpendTracker struct {
+	mu      sync.Mutex
+	entries []spendEntry // in the order recorded
+}
+
+// NewSpendTracker returns an empty SpendTracker.
+func NewSpendTracker() *SpendTracker {
+	return &SpendTracker{}
+}
+
+// Spend implements SpendHistory.
+func (t *SpendTracker) Spend(since time.Time) (float64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var total float64
+	for _, e := range t.entries {
+		if !e.at.Before(since) {
+			total += e.cost
+		}
+	}
+	return total, nil
+}
+
+// RecordSpend implements SpendRecorder.
+func (t *SpendTracker) RecordSpend(at time.Time, cost float64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cutoff := at.Add(-spendRetention)
+	i := 0
+	for i < len(t.entries) && t.entries[i].at.Before(cutoff) {
+		i++
+	}
+	t.entries = append(t.entries[i:], spendEntry{at: at, cost: cost})
+	return nil
+}
+
+// Budget limits the estimated spend of queries. It is safe for concurrent use and
+// can be shared by several clients; the estimated cost of requests in flight counts
+// toward the daily and monthly budgets until they complete.
+type Budget struct {
+	config  BudgetConfig
+	history SpendHistory
+	now     func() time.Time
+
+	mu      sync.Mutex
+	pending float64 // estimated cost of the requests in flight
+}
+
+// NewBudget returns a budget that reads the spend of earlier queries from history.
+// If history is nil, the budget tracks the spend of its own queries in memory.
+func NewBudget(config BudgetConfig, history SpendHistory) *Budget {
+	if history == nil {
+		history = NewSpendTracker()
+	}
+	return &Budget{config: config, history: history, now: time.Now}
+}
+
+// Estimate returns the estimated cost in USD of a request, with the output tokens
+// reserved by the budget.
+func (b *Budget) Estimate(req Request) float64 {
+	output := b.config.OutputTokens
+	if output <= 0 {
+		output = req.Options.MaxTokens
+	}
+	if output <= 0 {
+		output = MAX_TOKENS_DEFAULT
+	}
+	return EstimateCost(req.Model, Usage{InputTokens: estimateRequestTokens(req), OutputTokens: output})
+}
+
+// limited reports whether the budget has a limit
+func (b *Budget) limited() bool {
+	return b.config.PerRequest > 0 || b.config.Daily > 0 || b.config.Monthly > 0
+}
+
+// priced reports whether the cost of a model can be estimated: it has a price in the
+// model registry, or is the mock model, which is free
+func priced(model string) bool {
+	info, err := GetModelInfo(model)
+	return err == nil && (info.Provider == Mock || info.InputPrice > 0 || info.OutputPrice > 0)
+}
+
+// budgetForceKey is the context key that allows requests exceeding a budget
+type budgetForceKey struct{}
+
+// WithBudgetForce returns a context whose requests are sent even if they exceed a
+// budget. The budget still reports them to its Warn function.
+func WithBudgetForce(ctx context.Context) context.Context {
+	return context.WithValue(ctx, budgetForceKey{}, true)
+}
+
+// budgetForced reports whether the context allows requests exceeding a budget
+func budgetForced(ctx context.Context) bool {
+	forced, _ := ctx.Value(budgetForceKey{}).(bool)
+	return forced
+}
+
+// reserve checks a request with the estimated cost against the budgets and adds it
+// to the requests in flight. The reservation must be released with complete.
+func (b *Budget) reserve(ctx context.Context, estimated float64) error {
+	b.mu.Lock()
+	now := b.now()
+	year, month, day := now.Date()
+	daily, err := b.history.Spend(time.Date(year, month, day, 0, 0, 0, 0, now.Location()))
+	if err != nil {
+		b.mu.Unlock()
+		return fmt.Errorf("failed to read spend history: %w", err)
+	}
+	monthly, err := b.history.Spend(time.Date(year, month, 1, 0, 0, 0, 0, now.Location()))
+	if err != nil {
+		b.mu.Unlock()
+		return fmt.Errorf("failed to read spend history: %w", err)
+	}
+
+	var checks []BudgetCheck
+	for _, check := range []BudgetCheck{
+		{Period: BudgetPerRequest, Limit: b.config.PerRequest},
+		{Period: BudgetDaily, Limit: b.config.Daily, Spent: daily + b.pending},
+		{Period: BudgetMonthly, Limit: b.config.Monthly, Spent: monthly + b.pending},
+	} {
+		if check.Limit <= 0 {
+			continue
+		}
+		check.Estimated = estimated
+		check.Exceeded = check.Spent+estimated > check.Limit
+		if check.Exceeded || (b.config.WarnPercent > 0 && check.Percent() >= b.config.WarnPercent) {
+			checks = append(checks, check)
+		}
+	}
+
+	forced := budgetForced(ctx)
+	for _, check := range checks {
+		if check.Exceeded && !forced {
+			b.mu.Unlock()
+			return fmt.Errorf("%w: estimated cost $%.4f with $%.4f spent exceeds the %s budget of $%.2f",
+				ErrBudgetExceeded, check.Estimated, check.Spent, check.Period, check.Limit)
+		}
+	}
+	b.pending += estimated
+	b.mu.Unlock()
+
+	if b.config.Warn != nil {
+		for _, check := range checks {
+			b.config.Warn(check)
+		}
+	}
+	return nil
+}
+
+// complete releases the reservation of a request and records its actual cost
+func (b *Budget) complete(estimated, cost float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending -= estimated
+	if recorder, ok := b.history.(SpendRecorder); ok && cost > 0 {
+		// a failure to record the spend does not fail the query
+		_ = recorder.RecordSpend(b.now(), cost)
+	}
+}
+
+// BudgetClient wraps a Client and refuses queries that would exceed a Budget.
+type BudgetClient struct {
+	client   Client
+	provider string
+	budget   *Budget
+}
+
+// Ensure BudgetClient implements the Client and Querier interfaces
+var (
+	_ Client  = (*BudgetClient)(nil)
+	_ Querier = (*BudgetClient)(nil)
+)
+
+// NewBudgetClient wraps client so that its queries are checked against budget.
+func NewBudgetClient(client Client, provider string, budget *Budget) *BudgetClient {
+	return &BudgetClient{client: client, provider: provider, budget: budget}
+}
+
+// QueryText checks the budget and sends the query to the wrapped client.
+func (c *BudgetClient) QueryText(ctx context.Context, system string, prompts []string, model string, options Options) (string, error) {
+	return queryText(ctx, c, system, prompts, model, options)
+}
+
+// Query implements the Querier interface. Responses from a cache have no cost.
+func (c *BudgetClient) Query(ctx context.Context, req Request) (*Response, error) {
+	return c.intercept(ctx, req, ClientHandler(c.client))
+}
+
+// intercept implements the middleware of the client, sending requests to next
+func (c *BudgetClient) intercept(ctx context.Context, req Request, next Handler) (*Response, error) {
+	// the spend of a model without a price would count as zero against every limit
+	if c.budget.limited() && !priced(req.Model) && !budgetForced(ctx) {
+		return nil, fmt.Errorf("%w: model %s has no price, so its cost cannot be checked against the budget",
+			ErrBudgetExceeded, req.Model)
+	}
+	estimated := c.budget.Estimate(req)
+	if err := c.budget.reserve(ctx, estimated); err != nil {
+		return nil, err
+	}
+	resp, err := next(ctx, req)
+	var cost float64
+	if err == nil && resp.Metadata[MetadataCache] == "" {
+		cost = EstimateCost(req.Model, resp.Usage)
+	}
+	c.budget.complete(estimated, cost)
+	return resp, err
+}
+
+// BudgetMiddleware returns the middleware of a BudgetClient: it refuses queries
+// that would exceed the budget.
+func BudgetMiddleware(provider string, budget *Budget) Middleware {
+	return NewBudgetClient(nil, provider, budget).intercept
+}
+
+// Close closes the wrapped client.
+func (c *BudgetClient) Close() error {
+	return c.client.Close()
+}
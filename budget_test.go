@@ -0,0 +1,165 @@
+package sqirvy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBudgetClient(t *testing.T) {
+	req := Request{System: assistant, Prompts: []string{"hello"}, Model: "claude-sonnet-4-20250514", Options: Options{MaxTokens: 1000}}
+	estimated := NewBudget(BudgetConfig{}, nil).Estimate(req)
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name      string
+		config    BudgetConfig
+		spent     map[time.Time]float64 // recorded spend by time
+		force     bool
+		wantErr   bool
+		wantWarns []string // periods reported to Warn
+	}{
+		{name: "Unlimited", config: BudgetConfig{}},
+		{name: "Per request", config: BudgetConfig{PerRequest: estimated / 2}, wantErr: true},
+		{name: "Per request forced", config: BudgetConfig{PerRequest: estimated / 2}, force: true, wantWarns: []string{BudgetPerRequest}},
+		{name: "Daily", config: BudgetConfig{Daily: 1}, spent: map[time.Time]float64{now.Add(-time.Hour): 1}, wantErr: true},
+		{name: "Daily yesterday", config: BudgetConfig{Daily: 1}, spent: map[time.Time]float64{now.AddDate(0, 0, -1): 1}},
+		{name: "Monthly", config: BudgetConfig{Daily: 1, Monthly: 2}, spent: map[time.Time]float64{now.AddDate(0, 0, -1): 2}, wantErr: true},
+		{name: "Last month", config: BudgetConfig{Monthly: 2}, spent: map[time.Time]float64{now.AddDate(0, -1, 0): 2}},
+		{name: "Warn", config: BudgetConfig{Daily: 1, Monthly: 10, WarnPercent: 80}, spent: map[time.Time]float64{now.Add(-time.Hour): 0.9}, wantWarns: []string{BudgetDaily}},
+		{name: "Below warn", config: BudgetConfig{Daily: 1, WarnPercent: 80}, spent: map[time.Time]float64{now.Add(-time.Hour): 0.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewSpendTracker()
+			for at, cost := range tt.spent {
+				_ = tracker.RecordSpend(at, cost)
+			}
+			var warns []string
+			tt.config.Warn = func(check BudgetCheck) {
+				warns = append(warns, check.Period)
+			}
+			budget := NewBudget(tt.config, tracker)
+			budget.now = func() time.Time { return now }
+			mock := NewMockClientWithResponses(MockResponse{Text: "hi"})
+			client := NewBudgetClient(mock, Anthropic, budget)
+
+			ctx := context.Background()
+			if tt.force {
+				ctx = WithBudgetForce(ctx)
+			}
+			_, err := client.Query(ctx, req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Query() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrBudgetExceeded) {
+					t.Errorf("Query() error = %v, want ErrBudgetExceeded", err)
+				}
+				if n := len(mock.Requests()); n != 0 {
+					t.Errorf("client requests = %d, want 0", n)
+				}
+			}
+			if len(warns) != len(tt.wantWarns) || (len(warns) > 0 && warns[0] != tt.wantWarns[0]) {
+				t.Errorf("warnings = %v, want %v", warns, tt.wantWarns)
+			}
+		})
+	}
+}
+
+func TestBudgetClient_UnpricedModel(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  BudgetConfig
+		model   string
+		force   bool
+		wantErr bool
+	}{
+		{name: "Unregistered model", config: BudgetConfig{Daily: 10}, model: "gpt-4o", wantErr: true},
+		{name: "Unregistered model per request", config: BudgetConfig{PerRequest: 1}, model: "gpt-4o", wantErr: true},
+		{name: "Unregistered model forced", config: BudgetConfig{Daily: 10}, model: "gpt-4o", force: true},
+		{name: "Unregistered model without limits", config: BudgetConfig{WarnPercent: 80}, model: "gpt-4o"},
+		{name: "Mock model", config: BudgetConfig{Daily: 10}, model: "mock"},
+		{name: "Priced model", config: BudgetConfig{Daily: 10}, model: "gpt-5-mini"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := NewMockClientWithResponses(MockResponse{Text: "hi"})
+			client := NewBudgetClient(mock, OpenAI, NewBudget(tt.config, nil))
+			ctx := context.Background()
+			if tt.force {
+				ctx = WithBudgetForce(ctx)
+			}
+			_, err := client.Query(ctx, Request{Prompts: []string{"hello"}, Model: tt.model})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Query() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrBudgetExceeded) {
+					t.Errorf("Query() error = %v, want ErrBudgetExceeded", err)
+				}
+				if n := len(mock.Requests()); n != 0 {
+					t.Errorf("client requests = %d, want 0", n)
+				}
+			}
+		})
+	}
+}
+
+func TestBudgetClient_RecordsSpend(t *testing.T) {
+	tracker := NewSpendTracker()
+	budget := NewBudget(BudgetConfig{Daily: 1}, tracker)
+	client := NewBudgetClient(NewMockClientWithResponses(MockResponse{Text: "hi"}), Anthropic, budget)
+
+	req := Request{System: assistant, Prompts: []string{"hello"}, Model: "claude-sonnet-4-20250514"}
+	resp, err := client.Query(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	spent, _ := tracker.Spend(time.Now().Add(-time.Minute))
+	if want := EstimateCost(req.Model, resp.Usage); spent != want || spent == 0 {
+		t.Errorf("recorded spend = %v, want %v", spent, want)
+	}
+	if budget.pending != 0 {
+		t.Errorf("pending = %v after the query completed, want 0", budget.pending)
+	}
+}
+
+func TestSpendTracker_Retention(t *testing.T) {
+	tracker := NewSpendTracker()
+	now := time.Now()
+	_ = tracker.RecordSpend(now.Add(-100*24*time.Hour), 5)
+	_ = tracker.RecordSpend(now, 1)
+	if n := len(tracker.entries); n != 1 {
+		t.Errorf("entries = %d, want 1", n)
+	}
+	if spent, _ := tracker.Spend(time.Time{}); spent != 1 {
+		t.Errorf("Spend() = %v, want 1", spent)
+	}
+}
+
+func TestNewClient_WithBudget(t *testing.T) {
+	t.Setenv("MOCK_FIXTURE", "")
+	t.Setenv("MOCK_RECORD", "")
+	tracker := NewSpendTracker()
+	_ = tracker.RecordSpend(time.Now(), 10)
+	client, err := NewClient(Mock, WithBudget(NewBudget(BudgetConfig{Daily: 10}, tracker)), WithCache(NewMemoryCache(CacheConfig{})))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close()
+
+	// the budget is inside the cache, so only the first request is checked
+	req := Request{System: assistant, Prompts: []string{"hello"}, Model: "claude-sonnet-4-20250514"}
+	if _, err := Query(context.Background(), client, req); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("Query() error = %v, want ErrBudgetExceeded", err)
+	}
+	if _, err := Query(WithBudgetForce(context.Background()), client, req); err != nil {
+		t.Fatalf("forced Query() error = %v", err)
+	}
+	resp, err := Query(context.Background(), client, req)
+	if err != nil || resp.Metadata[MetadataCache] != CacheHitExact {
+		t.Errorf("Query() = %v, %v, want cache hit", resp, err)
+	}
+}
@@ -0,0 +1,269 @@
+// Package sqirvy provides an exact-match response cache.
+//
+// This file implements CachedClient, a Client wrapper that returns a stored
+// response for a request that is identical to an earlier one, and MemoryCache,
+// an in-memory LRU backend. Requests are identified by a hash of the provider,
+// model, system prompt, prompts and options, so any change to the request is a
+// cache miss. DiskCache in cache_disk.go stores responses in a directory so they
+// are shared between runs.
+package sqirvy
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"sync"
+	"time"
+)
+
+const (
+	// MetadataCache is the response metadata key set when a response was returned
+	// from a cache: CacheHitExact, or CacheHitSemantic for a SemanticCacheClient
+	MetadataCache = "cache"
+	// CacheHitExact is the MetadataCache value of an exact-match cache hit
+	CacheHitExact = "hit"
+)
+
+// CacheConfig configures a cache backend. Zero fields are not limited.
+type CacheConfig struct {
+	TTL        time.Duration // how long an entry is valid
+	MaxEntries int           // maximum number of entries, least recently used are evicted first
+	MaxBytes   int64         // maximum total size of the entries, least recently used are evicted first
+}
+
+// CacheStats describes the content and use of a cache.
+type CacheStats struct {
+	Entries int   `json:"entries"`
+	Bytes   int64 `json:"bytes"`
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+}
+
+// Cache is a response cache backend. Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the response stored for key, if there is one that has not expired
+	Get(key string) (*Response, bool)
+	// Set stores the response for key
+	Set(key string, resp *Response) error
+	// Clear removes all entries
+	Clear() error
+	// Stats returns the cache statistics
+	Stats() (CacheStats, error)
+}
+
+// cacheKeyFields are the request fields that identify a cached response.
+// The api key is not part of the key.
+type cacheKeyFields struct {
+	Provider    string    `json:"provider"`
+	Model       string    `json:"model"`
+	System      string    `json:"system"`
+	History     []Message `json:"history,omitempty"`
+	Prompts     []string  `json:"prompts"`
+	Temperature float32   `json:"temperature"`
+	MaxTokens   int64     `json:"max_tokens"`
+	BaseUrl     string    `json:"base_url"`
+}
+
+// CacheKey returns the cache key of a request sent to provider: a hex encoded
+// sha256 hash of the provider, model, system prompt, history, prompts and options.
+func CacheKey(provider string, req Request) string {
+	data, _ := json.Marshal(cacheKeyFields{
+		Provider:    provider,
+		Model:       req.Model,
+		System:      req.System,
+		History:     req.History,
+		Prompts:     req.Prompts,
+		Temperature: req.Options.Temperature,
+		MaxTokens:   req.Options.MaxTokens,
+		BaseUrl:     req.Options.BaseUrl,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// cacheEntrySize returns the size used to account an entry against MaxBytes
+func cacheEntrySize(resp *Response) int64 {
+	data, _ := json.Marshal(resp)
+	return int64(len(data))
+}
+
+// memoryEntry is an entry of a MemoryCache
+type memoryEntry struct {
+	key     string
+	resp    *Response
+	size    int64
+	expires time.Time // zero if the entry does not expire
+}
+
+// MemoryCache is an in-memory LRU response cache.
+type MemoryCache struct {
+	config CacheConfig
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // elements hold *memoryEntry
+	lru     *list.List               // most recently used first
+	bytes   int64
+	hits    int64
+	misses  int64
+}
+
+// Ensure MemoryCache implements the Cache interface
+var _ Cache = (*MemoryCache)(nil)
+
+// NewMemoryCache creates an empty in-memory cache.
+func NewMemoryCache(config CacheConfig) *MemoryCache {
+	return &MemoryCache{
+		config:  config,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Get returns the response stored for key and marks it as recently used.
+func (c *MemoryCache) Get(key string) (*Response, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if ok {
+		entry := elem.Value.(*memoryEntry)
+		if entry.expires.IsZero() || c.now().Before(entry.expires) {
+			c.lru.MoveToFront(elem)
+			c.hits++
+			return entry.resp, true
+		}
+		c.remove(elem)
+	}
+	c.misses++
+	return nil, false
+}
+
+// Set stores the response for key, evicting least recently used entries to stay
+// within the size caps. A response larger than MaxBytes is not stored.
+func (c *MemoryCache) Set(key string, resp *Response) error {
+	entry := &memoryEntry{key: key, resp: resp, size: cacheEntrySize(resp)}
+	if c.config.TTL > 0 {
+		entry.expires = c.now().Add(c.config.TTL)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	if c.config.MaxBytes > 0 && entry.size > c.config.MaxBytes {
+		return nil
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.bytes += entry.size
+	for c.lru.Len() > 0 && (c.config.MaxEntries > 0 && c.lru.Len() > c.config.MaxEntries ||
+		c.config.MaxBytes > 0 && c.bytes > c.config.MaxBytes) {
+		c.remove(c.lru.Back())
+	}
+	return nil
+}
+
+// remove removes an element, c.mu must be held
+func (c *MemoryCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*memoryEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+// Clear removes all entries and resets the statistics.
+func (c *MemoryCache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.bytes, c.hits, c.misses = 0, 0, 0
+	return nil
+}
+
+// Stats returns the cache statistics.
+func (c *MemoryCache) Stats() (CacheStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Entries: c.lru.Len(), Bytes: c.bytes, Hits: c.hits, Misses: c.misses}, nil
+}
+
+// CachedClient wraps a Client and returns cached responses for requests that
+// are identical to earlier ones. Only successful responses are stored.
+type CachedClient struct {
+	client   Client
+	provider string
+	cache    Cache
+}
+
+// Ensure CachedClient implements the Client and Querier interfaces
+var (
+	_ Client  = (*CachedClient)(nil)
+	_ Querier = (*CachedClient)(nil)
+)
+
+// NewCachedClient wraps client with the cache. provider is part of the cache key,
+// so the same model served by different providers is cached separately.
+func NewCachedClient(client Client, provider string, cache Cache) *CachedClient {
+	return &CachedClient{client: client, provider: provider, cache: cache}
+}
+
+// QueryText returns a cached response or sends the query to the wrapped client.
+func (c *CachedClient) QueryText(ctx context.Context, system string, prompts []string, model string, options Options) (string, error) {
+	return queryText(ctx, c, system, prompts, model, options)
+}
+
+// Query implements the Querier interface. A cached response has the MetadataCache
+// metadata set to "hit". If the request has a StreamFunc, a cached response is
+// passed to it as a single chunk.
+func (c *CachedClient) Query(ctx context.Context, req Request) (*Response, error) {
+	return c.intercept(ctx, req, ClientHandler(c.client))
+}
+
+// intercept implements the middleware of the client, sending requests to next
+func (c *CachedClient) intercept(ctx context.Context, req Request, next Handler) (*Response, error) {
+	key := CacheKey(c.provider, req)
+	if cached, ok := c.cache.Get(key); ok {
+		if req.Options.StreamFunc != nil {
+			if err := req.Options.StreamFunc(ctx, []byte(cached.Text)); err != nil {
+				return nil, err
+			}
+		}
+		resp := *cached
+		resp.Metadata = maps.Clone(cached.Metadata)
+		if resp.Metadata == nil {
+			resp.Metadata = make(map[string]string)
+		}
+		resp.Metadata[MetadataCache] = CacheHitExact
+		return &resp, nil
+	}
+
+	resp, err := next(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	// responses answered by an inner cache, such as a semantic hit, are not stored
+	if resp.Metadata[MetadataCache] != "" {
+		return resp, nil
+	}
+	// store a copy, callers and outer wrappers may change the metadata of resp;
+	// a failure to store the response does not fail the query
+	stored := *resp
+	stored.Metadata = maps.Clone(resp.Metadata)
+	_ = c.cache.Set(key, &stored)
+	return resp, nil
+}
+
+// CacheMiddleware returns the middleware of a CachedClient: it answers requests that
+// are identical to earlier ones from the cache.
+func CacheMiddleware(provider string, cache Cache) Middleware {
+	return NewCachedClient(nil, provider, cache).intercept
+}
+
+// Close closes the wrapped client.
+func (c *CachedClient) Close() error {
+	return c.client.Close()
+}
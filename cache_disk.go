@@ -0,0 +1,247 @@
+// Package sqirvy provides an on-disk response cache backend.
+//
+// This file implements DiskCache, which stores each response as a JSON file in a
+// directory so that cached responses are shared between runs and processes. The
+// modification time of an entry file records its last use, for LRU eviction.
+package sqirvy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// diskCacheStatsFile holds the hit and miss counters of a DiskCache
+const diskCacheStatsFile = "stats.json"
+
+// diskEntry is the content of a DiskCache entry file
+type diskEntry struct {
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires,omitzero"`
+	Response *Response `json:"response"`
+}
+
+// DiskCache is a response cache that stores entries as files in a directory.
+type DiskCache struct {
+	dir    string
+	config CacheConfig
+	now    func() time.Time
+	mu     sync.Mutex // serializes eviction and statistics within the process
+}
+
+// Ensure DiskCache implements the Cache interface
+var _ Cache = (*DiskCache)(nil)
+
+// NewDiskCache creates a cache that stores entries in dir, creating it if needed.
+func NewDiskCache(dir string, config CacheConfig) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &DiskCache{dir: dir, config: config, now: time.Now}, nil
+}
+
+// path returns the entry file of a key
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.dir, key[:min(2, len(key))], key+".json")
+}
+
+// Get returns the response stored for key and marks it as recently used.
+func (c *DiskCache) Get(key string) (*Response, bool) {
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		var entry diskEntry
+		now := c.now()
+		switch {
+		case json.Unmarshal(data, &entry) != nil || entry.Response == nil:
+			_ = os.Remove(path)
+		case !entry.Expires.IsZero() && !now.Before(entry.Expires):
+			_ = os.Remove(path)
+		default:
+			_ = os.Chtimes(path, now, now)
+			c.count(true)
+			return entry.Response, true
+		}
+	}
+	c.count(false)
+	return nil, false
+}
+
+// Set stores the response for key, evicting least recently used entries to stay
+// within the size caps.
+func (c *DiskCache) Set(key string, resp *Response) error {
+	now := c.now()
+	entry := diskEntry{Created: now, Response: resp}
+	if c.config.TTL > 0 {
+		entry.Expires = now.Add(c.config.TTL)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	// write to a temporary file and rename, so readers never see a partial entry
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return c.evict()
+}
+
+// diskFile is an entry file found by walk
+type diskFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// walk returns the entry files of the cache
+func (c *DiskCache) walk() ([]diskFile, error) {
+	var files []diskFile
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// entries removed by another process while walking are skipped
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || path == filepath.Join(c.dir, diskCacheStatsFile) || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, diskFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+	return files, nil
+}
+
+// evict removes least recently used entries until the cache is within its caps
+func (c *DiskCache) evict() error {
+	if c.config.MaxEntries <= 0 && c.config.MaxBytes <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	files, err := c.walk()
+	if err != nil {
+		return err
+	}
+	var bytes int64
+	for _, f := range files {
+		bytes += f.size
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for len(files) > 0 && (c.config.MaxEntries > 0 && len(files) > c.config.MaxEntries ||
+		c.config.MaxBytes > 0 && bytes > c.config.MaxBytes) {
+		_ = os.Remove(files[0].path)
+		bytes -= files[0].size
+		files = files[1:]
+	}
+	return nil
+}
+
+// count adds a hit or a miss to the statistics file. Counting is best effort.
+func (c *DiskCache) count(hit bool) {
+	_ = c.updateStats(func(s *CacheStats) {
+		if hit {
+			s.Hits++
+		} else {
+			s.Misses++
+		}
+	})
+}
+
+// updateStats runs f on the hit and miss counters, with the statistics file
+// locked against other processes
+func (c *DiskCache) updateStats(f func(s *CacheStats)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	path := filepath.Join(c.dir, diskCacheStatsFile)
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open cache lock file: %w", err)
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return fmt.Errorf("failed to lock cache statistics: %w", err)
+	}
+	defer func() { _ = unlockFile(lock) }()
+
+	var stats CacheStats
+	if data, err := os.ReadFile(path); err == nil {
+		// corrupt statistics are reset
+		_ = json.Unmarshal(data, &stats)
+	}
+	f(&stats)
+	data, err := json.Marshal(CacheStats{Hits: stats.Hits, Misses: stats.Misses})
+	if err != nil {
+		return fmt.Errorf("failed to encode cache statistics: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write cache statistics: %w", err)
+	}
+	return nil
+}
+
+// Clear removes all entries and resets the statistics.
+func (c *DiskCache) Clear() error {
+	files, err := c.walk()
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove cache entry: %w", err)
+		}
+	}
+	return c.updateStats(func(s *CacheStats) { *s = CacheStats{} })
+}
+
+// Stats returns the number and size of the entries and the hit and miss counts.
+// Expired entries that have not been removed yet are included.
+func (c *DiskCache) Stats() (CacheStats, error) {
+	var stats CacheStats
+	if err := c.updateStats(func(s *CacheStats) { stats = *s }); err != nil {
+		return stats, err
+	}
+	files, err := c.walk()
+	if err != nil {
+		return stats, err
+	}
+	stats.Entries = len(files)
+	for _, f := range files {
+		stats.Bytes += f.size
+	}
+	return stats, nil
+}
@@ -0,0 +1,222 @@
+package sqirvy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheKey(t *testing.T) {
+	base := Request{System: assistant, Prompts: []string{"hello"}, Model: "gpt-5", Options: Options{Temperature: 0.5, MaxTokens: 100}}
+	key := CacheKey(OpenAI, base)
+
+	tests := []struct {
+		name     string
+		provider string
+		change   func(r *Request)
+		wantSame bool
+	}{
+		{name: "Identical", provider: OpenAI, change: func(r *Request) {}, wantSame: true},
+		{name: "API key ignored", provider: OpenAI, change: func(r *Request) { r.Options.APIKey = "secret" }, wantSame: true},
+		{name: "Provider", provider: Vertex, change: func(r *Request) {}},
+		{name: "Model", provider: OpenAI, change: func(r *Request) { r.Model = "gpt-5-mini" }},
+		{name: "System", provider: OpenAI, change: func(r *Request) { r.System = "" }},
+		{name: "Prompts", provider: OpenAI, change: func(r *Request) { r.Prompts = []string{"hell", "o"} }},
+		{name: "History", provider: OpenAI, change: func(r *Request) { r.History = []Message{{Role: RoleUser, Text: "hi"}} }},
+		{name: "Temperature", provider: OpenAI, change: func(r *Request) { r.Options.Temperature = 0.6 }},
+		{name: "MaxTokens", provider: OpenAI, change: func(r *Request) { r.Options.MaxTokens = 200 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := base
+			req.Prompts = append([]string(nil), base.Prompts...)
+			tt.change(&req)
+			if got := CacheKey(tt.provider, req) == key; got != tt.wantSame {
+				t.Errorf("CacheKey() same = %v, want %v", got, tt.wantSame)
+			}
+		})
+	}
+}
+
+// testCaches returns a memory and a disk cache with the config and a settable clock
+func testCaches(t *testing.T, config CacheConfig) (map[string]Cache, *time.Time) {
+	now := time.Now()
+	memory := NewMemoryCache(config)
+	memory.now = func() time.Time { return now }
+	disk, err := NewDiskCache(t.TempDir(), config)
+	if err != nil {
+		t.Fatalf("NewDiskCache() error = %v", err)
+	}
+	disk.now = func() time.Time { return now }
+	return map[string]Cache{"memory": memory, "disk": disk}, &now
+}
+
+func TestCache_TTL(t *testing.T) {
+	caches, now := testCaches(t, CacheConfig{TTL: time.Hour})
+	for name, cache := range caches {
+		t.Run(name, func(t *testing.T) {
+			if _, ok := cache.Get("k1"); ok {
+				t.Errorf("Get() of empty cache = hit")
+			}
+			if err := cache.Set("k1", &Response{Text: "one"}); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+			if resp, ok := cache.Get("k1"); !ok || resp.Text != "one" {
+				t.Errorf("Get() = %v, %v, want one", resp, ok)
+			}
+			stats, err := cache.Stats()
+			if err != nil || stats.Entries != 1 || stats.Hits != 1 || stats.Misses != 1 || stats.Bytes == 0 {
+				t.Errorf("Stats() = %+v, %v", stats, err)
+			}
+
+			*now = now.Add(2 * time.Hour)
+			if _, ok := cache.Get("k1"); ok {
+				t.Errorf("Get() of expired entry = hit")
+			}
+			*now = now.Add(-2 * time.Hour)
+
+			if err := cache.Set("k2", &Response{Text: "two"}); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+			if err := cache.Clear(); err != nil {
+				t.Fatalf("Clear() error = %v", err)
+			}
+			if stats, _ := cache.Stats(); stats != (CacheStats{}) {
+				t.Errorf("Stats() after Clear = %+v", stats)
+			}
+		})
+	}
+}
+
+func TestCache_MaxEntries(t *testing.T) {
+	caches, now := testCaches(t, CacheConfig{MaxEntries: 2})
+	for name, cache := range caches {
+		t.Run(name, func(t *testing.T) {
+			set := func(key string) {
+				*now = now.Add(time.Second)
+				if err := cache.Set(key, &Response{Text: key}); err != nil {
+					t.Fatalf("Set(%s) error = %v", key, err)
+				}
+			}
+			set("a")
+			set("b")
+			// using a makes b the least recently used entry
+			*now = now.Add(time.Second)
+			cache.Get("a")
+			set("c")
+
+			for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+				if _, ok := cache.Get(key); ok != want {
+					t.Errorf("Get(%s) hit = %v, want %v", key, ok, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryCache_MaxBytes(t *testing.T) {
+	size := cacheEntrySize(&Response{Text: "aaaa"})
+	cache := NewMemoryCache(CacheConfig{MaxBytes: 2 * size})
+	for _, key := range []string{"aaaa", "bbbb", "cccc"} {
+		cache.Set(key, &Response{Text: key})
+	}
+	stats, _ := cache.Stats()
+	if stats.Entries != 2 || stats.Bytes != 2*size {
+		t.Errorf("Stats() = %+v, want 2 entries of %d bytes", stats, size)
+	}
+	if _, ok := cache.Get("aaaa"); ok {
+		t.Errorf("Get() of evicted entry = hit")
+	}
+
+	// a response larger than the cache is not stored
+	cache.Set("big", &Response{Text: string(make([]byte, 3*size))})
+	if _, ok := cache.Get("big"); ok {
+		t.Errorf("Get() of oversized entry = hit")
+	}
+}
+
+func TestDiskCache_SharedBetweenInstances(t *testing.T) {
+	dir := t.TempDir()
+	first, err := NewDiskCache(dir, CacheConfig{})
+	if err != nil {
+		t.Fatalf("NewDiskCache() error = %v", err)
+	}
+	want := &Response{Text: "hello", Provider: Mock, Model: "mock", Usage: Usage{InputTokens: 3, OutputTokens: 1}}
+	if err := first.Set("k", want); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	second, _ := NewDiskCache(dir, CacheConfig{})
+	got, ok := second.Get("k")
+	if !ok || got.Text != want.Text || got.Usage != want.Usage {
+		t.Errorf("Get() = %+v, %v, want %+v", got, ok, want)
+	}
+
+	// a corrupt entry is a miss
+	if err := os.MkdirAll(filepath.Join(dir, "ba"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ba", "bad.json"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := second.Get("bad"); ok {
+		t.Errorf("Get() of corrupt entry = hit")
+	}
+}
+
+func TestCachedClient(t *testing.T) {
+	t.Setenv("MOCK_FIXTURE", "")
+	t.Setenv("MOCK_RECORD", "")
+	cache := NewMemoryCache(CacheConfig{})
+	client, err := NewClient(Mock, WithCache(cache))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	req := Request{System: assistant, Prompts: []string{"hello"}, Model: "mock"}
+	first, err := Query(ctx, client, req)
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if first.Metadata[MetadataCache] != "" {
+		t.Errorf("first response cache metadata = %q, want none", first.Metadata[MetadataCache])
+	}
+
+	var streamed string
+	req.Options.StreamFunc = func(ctx context.Context, chunk []byte) error {
+		streamed += string(chunk)
+		return nil
+	}
+	second, err := Query(ctx, client, req)
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if second.Text != first.Text || second.Metadata[MetadataCache] != "hit" {
+		t.Errorf("second response = %+v, want cache hit of %q", second, first.Text)
+	}
+	if streamed != first.Text {
+		t.Errorf("streamed %q, want %q", streamed, first.Text)
+	}
+
+	// the hit must not change the cached entry
+	if cached, _ := cache.Get(CacheKey(Mock, req)); cached.Metadata[MetadataCache] != "" {
+		t.Errorf("cached entry metadata = %v", cached.Metadata)
+	}
+
+	mock := client.(*CachedClient).client.(*MockClient)
+	if n := len(mock.Requests()); n != 1 {
+		t.Errorf("mock received %d requests, want 1", n)
+	}
+
+	req.Prompts = []string{"other"}
+	if _, err := Query(ctx, client, req); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if n := len(mock.Requests()); n != 2 {
+		t.Errorf("mock received %d requests, want 2", n)
+	}
+}
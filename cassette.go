@@ -0,0 +1,294 @@
+// Package sqirvy provides HTTP record/replay cassettes for provider calls.
+//
+// This file implements Cassette, an http.RoundTripper that records real
+// provider HTTP exchanges to a JSON cassette file and replays them later
+// without network access. API keys and other credentials are scrubbed from
+// recorded requests so cassettes can be committed alongside tests.
+package sqirvy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// CassetteMode selects whether a Cassette records or replays exchanges.
+type CassetteMode string
+
+const (
+	// CassetteRecord sends requests to the provider and records the exchanges
+	CassetteRecord CassetteMode = "record"
+	// CassetteReplay returns recorded responses and never sends requests
+	CassetteReplay CassetteMode = "replay"
+	// CassetteAuto replays if the cassette file exists, otherwise it records
+	CassetteAuto CassetteMode = "auto"
+)
+
+// scrubbed replaces credentials in recorded requests
+const scrubbed = "REDACTED"
+
+// sensitiveHeaders are removed from recorded requests and responses
+var sensitiveHeaders = []string{
+	"Authorization",
+	"X-Api-Key",
+	"X-Goog-Api-Key",
+	"Api-Key",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// sensitiveQueryParams are scrubbed from recorded request urls
+var sensitiveQueryParams = []string{"key", "api_key"}
+
+// ErrCassetteMiss is returned in replay mode when no recorded exchange matches a request.
+var ErrCassetteMiss = errors.New("no recorded exchange matches the request")
+
+// CassetteRequest is a recorded http request.
+type CassetteRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// CassetteResponse is a recorded http response.
+type CassetteResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// Interaction is one recorded http exchange.
+type Interaction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+// cassetteFile is the on-disk cassette format
+type cassetteFile struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Cassette is an http.RoundTripper that records or replays provider http exchanges.
+// Install it with WithHTTPClient(&http.Client{Transport: cassette}).
+// In record mode, call Save to write the cassette file. Cassette is safe for concurrent use.
+type Cassette struct {
+	path         string
+	mode         CassetteMode
+	next         http.RoundTripper
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool // replayed interactions
+}
+
+// Ensure Cassette implements http.RoundTripper
+var _ http.RoundTripper = (*Cassette)(nil)
+
+// NewCassette creates a cassette backed by the file at path.
+// In replay mode the file must exist. In auto mode the cassette replays if the file
+// exists and records otherwise. next is the transport used for recording;
+// http.DefaultTransport is used if it is nil.
+func NewCassette(path string, mode CassetteMode, next http.RoundTripper) (*Cassette, error) {
+	if path == "" {
+		return nil, fmt.Errorf("cassette path cannot be empty")
+	}
+
+	if mode == "" || mode == CassetteAuto {
+		mode = CassetteRecord
+		if _, err := os.Stat(path); err == nil {
+			mode = CassetteReplay
+		}
+	}
+
+	c := &Cassette{path: path, mode: mode, next: transportOrDefault(next)}
+	switch mode {
+	case CassetteRecord:
+		c.interactions = []Interaction{}
+		return c, nil
+	case CassetteReplay:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cassette %s: %w", path, err)
+		}
+		var file cassetteFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("invalid cassette %s: %w", path, err)
+		}
+		c.interactions = file.Interactions
+		c.used = make([]bool, len(file.Interactions))
+		return c, nil
+	default:
+		return nil, fmt.Errorf("unsupported cassette mode: %s", mode)
+	}
+}
+
+// Mode returns the resolved mode of the cassette, either CassetteRecord or CassetteReplay.
+func (c *Cassette) Mode() CassetteMode {
+	return c.mode
+}
+
+// Interactions returns a copy of the recorded exchanges.
+func (c *Cassette) Interactions() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Interaction(nil), c.interactions...)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		_ = req.Body.Close()
+	}
+	recorded := scrubRequest(req, body)
+
+	if c.mode == CassetteReplay {
+		return c.replay(req, recorded)
+	}
+
+	// record: send the request with the original body
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	resp, err := c.next.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	header := resp.Header.Clone()
+	for _, h := range sensitiveHeaders {
+		header.Del(h)
+	}
+
+	c.mu.Lock()
+	c.interactions = append(c.interactions, Interaction{
+		Request:  recorded,
+		Response: CassetteResponse{Status: resp.StatusCode, Header: header, Body: string(respBody)},
+	})
+	c.mu.Unlock()
+
+	return resp, nil
+}
+
+// replay returns the first unused recorded exchange that matches the request
+func (c *Cassette) replay(req *http.Request, recorded CassetteRequest) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, in := range c.interactions {
+		if c.used[i] || !matchRequest(in.Request, recorded) {
+			continue
+		}
+		c.used[i] = true
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.Status, http.StatusText(in.Response.Status)),
+			StatusCode:    in.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Header.Clone(),
+			Body:          io.NopCloser(strings.NewReader(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrCassetteMiss, recorded.Method, recorded.URL)
+}
+
+// Save writes the recorded exchanges to the cassette file.
+// It does nothing in replay mode.
+func (c *Cassette) Save() error {
+	if c.mode == CassetteReplay {
+		return nil
+	}
+
+	c.mu.Lock()
+	data, err := json.MarshalIndent(cassetteFile{Interactions: c.interactions}, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+
+	if dir := filepath.Dir(c.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create cassette directory: %w", err)
+		}
+	}
+	if err := os.WriteFile(c.path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette %s: %w", c.path, err)
+	}
+	return nil
+}
+
+// scrubRequest returns the recorded form of a request with credentials removed
+func scrubRequest(req *http.Request, body []byte) CassetteRequest {
+	u := *req.URL
+	query := u.Query()
+	for _, p := range sensitiveQueryParams {
+		if query.Has(p) {
+			query.Set(p, scrubbed)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	header := req.Header.Clone()
+	for _, h := range sensitiveHeaders {
+		if header.Get(h) != "" {
+			header.Set(h, scrubbed)
+		}
+	}
+
+	return CassetteRequest{
+		Method: req.Method,
+		URL:    u.String(),
+		Header: header,
+		Body:   string(body),
+	}
+}
+
+// matchRequest reports whether a recorded request matches a new request.
+// Requests match on method, url and body; json bodies are compared semantically.
+func matchRequest(recorded, req CassetteRequest) bool {
+	if recorded.Method != req.Method || !sameURL(recorded.URL, req.URL) {
+		return false
+	}
+	if recorded.Body == req.Body {
+		return true
+	}
+	var a, b any
+	if json.Unmarshal([]byte(recorded.Body), &a) != nil || json.Unmarshal([]byte(req.Body), &b) != nil {
+		return false
+	}
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return bytes.Equal(ja, jb)
+}
+
+// sameURL compares urls ignoring the order of query parameters
+func sameURL(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return ua.Scheme == ub.Scheme && ua.Host == ub.Host && ua.Path == ub.Path &&
+		ua.Query().Encode() == ub.Query().Encode()
+}
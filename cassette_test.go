@@ -0,0 +1,86 @@
+package sqirvy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dmh2000/sqirvy-llmclient/sqirvytest"
+)
+
+func TestCassette_RecordReplay(t *testing.T) {
+	srv := sqirvytest.NewAnthropicServer(t)
+	srv.Setenv(t)
+	path := filepath.Join(t.TempDir(), "cassettes", "anthropic.json")
+	model := "claude-3-5-haiku-20241022"
+	prompts := []string{"Say 'Hello, World!'"}
+
+	// record
+	recorder, err := NewCassette(path, CassetteAuto, nil)
+	if err != nil {
+		t.Fatalf("NewCassette() error = %v", err)
+	}
+	if recorder.Mode() != CassetteRecord {
+		t.Fatalf("Mode() = %s, want %s", recorder.Mode(), CassetteRecord)
+	}
+	client, err := NewClient(Anthropic, WithHTTPClient(&http.Client{Transport: recorder}))
+	if err != nil {
+		t.Fatalf("new client failed: %v", err)
+	}
+	srv.Reply("Hello, World!")
+	want, err := client.QueryText(context.Background(), assistant, prompts, model, Options{Temperature: 0.5})
+	if err != nil {
+		t.Fatalf("QueryText() error = %v", err)
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading cassette: %v", err)
+	}
+	if strings.Contains(string(data), sqirvytest.TestAPIKey) {
+		t.Error("cassette contains the api key")
+	}
+
+	// replay, the server must not be called again
+	player, err := NewCassette(path, CassetteAuto, nil)
+	if err != nil {
+		t.Fatalf("NewCassette() error = %v", err)
+	}
+	if player.Mode() != CassetteReplay {
+		t.Fatalf("Mode() = %s, want %s", player.Mode(), CassetteReplay)
+	}
+	client, err = NewClient(Anthropic, WithHTTPClient(&http.Client{Transport: player}))
+	if err != nil {
+		t.Fatalf("new client failed: %v", err)
+	}
+	got, err := client.QueryText(context.Background(), assistant, prompts, model, Options{Temperature: 0.5})
+	if err != nil {
+		t.Fatalf("QueryText() replay error = %v", err)
+	}
+	if got != want {
+		t.Errorf("QueryText() replay = %q, want %q", got, want)
+	}
+	if n := len(srv.Requests()); n != 1 {
+		t.Errorf("server received %d requests, want 1", n)
+	}
+
+	// a different request is not in the cassette
+	_, err = client.QueryText(context.Background(), assistant, []string{"something else"}, model, Options{Temperature: 0.5})
+	if !errors.Is(err, ErrCassetteMiss) {
+		t.Errorf("QueryText() error = %v, want ErrCassetteMiss", err)
+	}
+}
+
+func TestCassette_ReplayMissingFile(t *testing.T) {
+	_, err := NewCassette(filepath.Join(t.TempDir(), "missing.json"), CassetteReplay, nil)
+	if err == nil {
+		t.Error("NewCassette() error = nil, want error for missing cassette")
+	}
+}
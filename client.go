@@ -4,6 +4,10 @@
 // - Anthropic (Claude models)
 // - Google (Gemini models)
 // - OpenAI (GPT models)
+// - Google Cloud Vertex AI (Gemini and Claude models)
+// - Mistral AI (Mistral models)
+// - DeepSeek (DeepSeek models)
+// - Mock (scripted responses for offline testing)
 //
 // It provides a consistent interface for making text and JSON queries while handling
 // provider-specific implementation details internally.
@@ -11,12 +15,18 @@ package sqirvy
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"log/slog"
+	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/tmc/langchaingo/llms"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -25,9 +35,6 @@ const (
 
 	// request timeout in seconds
 	RequestTimeout = time.Second * 15
-
-	// controls output to stderr
-	DebugMode = false
 )
 
 // Options combines all provider-specific options into a single structure.
@@ -37,6 +44,14 @@ type Options struct {
 	MaxTokens   int64   // Maximum number of tokens in the response
 	APIKey      string  // Optional API key override
 	BaseUrl     string  // Optional Base URL override
+
+	// PromptCache marks the stable prefix of the request as cacheable by providers
+	// that support prompt caching
+	PromptCache PromptCache
+
+	// StreamFunc is an optional callback that receives chunks of the response
+	// as they are generated. QueryText still returns the complete response.
+	StreamFunc func(ctx context.Context, chunk []byte) error `json:"-"`
 }
 
 // Client provides a unified interface for AI operations.
@@ -47,39 +62,334 @@ type Client interface {
 	Close() error
 }
 
-// NewClient creates a new AI client for the specified provider
-func NewClient(provider string) (Client, error) {
+// Message roles of a conversation history
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is one turn of a conversation.
+type Message struct {
+	Role string `json:"role"` // RoleUser or RoleAssistant
+	Text string `json:"text"`
+}
+
+// Request holds the inputs of a single query.
+type Request struct {
+	System  string    // System prompt
+	History []Message // Earlier turns of a conversation, sent before the prompts
+	Prompts []string  // User prompts, sent in order
+	Model   string    // Model name
+	Options Options   // Query options
+}
+
+// Usage reports the tokens consumed by a query.
+// InputTokens includes the prompt tokens read from and written to the provider prompt cache.
+type Usage struct {
+	InputTokens      int64 `json:"input_tokens"`
+	OutputTokens     int64 `json:"output_tokens"`
+	CacheReadTokens  int64 `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens int64 `json:"cache_write_tokens,omitempty"`
+}
+
+// Response holds the result of a query along with metadata describing how it was produced.
+type Response struct {
+	Text       string            // Response text
+	Provider   string            // Provider that answered
+	Model      string            // Model that answered
+	StopReason string            // Provider stop reason, if reported
+	Usage      Usage             // Token usage, if reported
+	Metadata   map[string]string // Additional metadata added by clients and wrappers
+}
+
+// Querier is implemented by clients that return a full Response rather than only the text.
+// All clients in this package implement Querier.
+type Querier interface {
+	Query(ctx context.Context, req Request) (*Response, error)
+}
+
+// Query sends a request with the client and returns the full Response.
+// If the client does not implement Querier, the response holds only the text and model.
+func Query(ctx context.Context, client Client, req Request) (*Response, error) {
+	if q, ok := client.(Querier); ok {
+		return q.Query(ctx, req)
+	}
+	text, err := client.QueryText(ctx, req.System, req.Prompts, req.Model, req.Options)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{Text: text, Model: req.Model}, nil
+}
+
+// queryText implements QueryText for clients that implement Querier
+func queryText(ctx context.Context, q Querier, system string, prompts []string, model string, options Options) (string, error) {
+	resp, err := q.Query(ctx, Request{System: system, Prompts: prompts, Model: model, Options: options})
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+// ClientOption configures a client created by NewClient or one of the provider constructors.
+type ClientOption func(*clientConfig)
+
+// clientConfig holds the settings applied by ClientOptions
+type clientConfig struct {
+	httpClient  *http.Client // optional http client used for provider requests
+	rateLimiter *RateLimiter // optional rate limiter applied by NewClient
+
+	adaptiveLimiter *AdaptiveLimiter // optional adaptive concurrency limiter applied by NewClient
+	circuitBreaker  *CircuitBreaker  // optional circuit breaker applied by NewClient
+	budget          *Budget          // optional spend budget applied by NewClient
+	cache           Cache            // optional response cache applied by NewClient
+	semanticCache   *SemanticCache   // optional semantic cache applied by NewClient
+	logger          *slog.Logger     // optional query logger applied by NewClient
+	logConfig       LogConfig        // settings of the query logger
+	telemetry       TelemetryConfig  // optional tracer and meter providers applied by NewClient
+	middlewares     []Middleware     // optional middlewares applied by NewClient
+}
+
+// WithHTTPClient sets the http client used for provider requests, for example
+// to install a custom transport such as a Cassette. The Mistral client does not
+// support a custom http client and ignores this option.
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(c *clientConfig) {
+		c.httpClient = client
+	}
+}
+
+// WithRateLimiter makes NewClient wrap the client in a RateLimitedClient that
+// waits for the limiter before each query. Share one limiter between clients
+// so that they share the limits.
+func WithRateLimiter(limiter *RateLimiter) ClientOption {
+	return func(c *clientConfig) {
+		c.rateLimiter = limiter
+	}
+}
+
+// WithAdaptiveLimiter makes NewClient limit the concurrent requests of the client
+// with the limiter, and report the provider's rate-limit headers to it. The
+// Mistral client does not support a custom http client, so its limit does not adapt.
+func WithAdaptiveLimiter(limiter *AdaptiveLimiter) ClientOption {
+	return func(c *clientConfig) {
+		c.adaptiveLimiter = limiter
+	}
+}
+
+// WithCircuitBreaker makes NewClient wrap the client with the provider's circuit
+// in the breaker, so requests fail fast while the provider is failing.
+func WithCircuitBreaker(breaker *CircuitBreaker) ClientOption {
+	return func(c *clientConfig) {
+		c.circuitBreaker = breaker
+	}
+}
+
+// WithBudget makes NewClient wrap the client in a BudgetClient, so requests that
+// would exceed the budget are refused. Responses from a cache do not count toward it.
+func WithBudget(budget *Budget) ClientOption {
+	return func(c *clientConfig) {
+		c.budget = budget
+	}
+}
+
+// WithCache makes NewClient wrap the client in a CachedClient, so requests that are
+// identical to earlier ones are answered from the cache. It is applied outside the
+// limiters, circuit breaker and budget, so cache hits do not count against them.
+func WithCache(cache Cache) ClientOption {
+	return func(c *clientConfig) {
+		c.cache = cache
+	}
+}
+
+// WithSemanticCache makes NewClient wrap the client in a SemanticCacheClient, so
+// requests similar to earlier ones are answered from the cache. It is applied
+// inside WithCache, so exact matches are found without embedding the prompts.
+func WithSemanticCache(cache *SemanticCache) ClientOption {
+	return func(c *clientConfig) {
+		c.semanticCache = cache
+	}
+}
+
+// WithLogger makes NewClient wrap the client in a LoggingClient that logs the
+// metadata of each query to logger at debug level, with the prompts redacted.
+// It is applied outside the caches, so cache hits are logged with their metadata.
+func WithLogger(logger *slog.Logger) ClientOption {
+	return func(c *clientConfig) {
+		c.logger = logger
+	}
+}
+
+// WithLogPrompts makes the logger set by WithLogger log the system prompt, prompts
+// and response text instead of redacting them.
+func WithLogPrompts() ClientOption {
+	return func(c *clientConfig) {
+		c.logConfig.Prompts = true
+	}
+}
+
+// WithTracerProvider makes NewClient wrap the client in a TelemetryClient that
+// records a span for each query with the tracer provider. Tracing is off by default.
+func WithTracerProvider(provider trace.TracerProvider) ClientOption {
+	return func(c *clientConfig) {
+		c.telemetry.TracerProvider = provider
+	}
+}
+
+// WithMeterProvider makes NewClient wrap the client in a TelemetryClient that
+// records request, latency and token metrics with the meter provider. Metrics are
+// off by default.
+func WithMeterProvider(provider metric.MeterProvider) ClientOption {
+	return func(c *clientConfig) {
+		c.telemetry.MeterProvider = provider
+	}
+}
+
+// newClientConfig applies the options to a default configuration
+func newClientConfig(opts []ClientOption) clientConfig {
+	var config clientConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+// transportOrDefault returns t, or http.DefaultTransport if t is nil
+func transportOrDefault(t http.RoundTripper) http.RoundTripper {
+	if t == nil {
+		return http.DefaultTransport
+	}
+	return t
+}
+
+// NewClient creates a new AI client for the specified provider.
+// Client wrappers configured by the options, such as WithRateLimiter,
+// WithAdaptiveLimiter, WithCircuitBreaker, WithBudget, WithSemanticCache, WithCache, WithLogger,
+// WithTracerProvider and WithMiddleware, are applied to the new client. Each wrapper
+// is the client composed with the matching Middleware, such as CacheMiddleware.
+//
+// The wrappers are applied from the innermost to the outermost in the order rate
+// limiter, adaptive limiter, circuit breaker, budget, semantic cache, cache, logger,
+// telemetry and middlewares. Cache hits do not count against the limiters, breaker
+// or budget, and are seen by the logger, telemetry and middlewares.
+func NewClient(provider string, opts ...ClientOption) (Client, error) {
+	config := newClientConfig(opts)
+	if config.adaptiveLimiter != nil {
+		// report provider responses to the adaptive limiter
+		httpClient := &http.Client{}
+		if config.httpClient != nil {
+			*httpClient = *config.httpClient
+		}
+		httpClient.Transport = &adaptiveTransport{
+			provider: provider,
+			limiter:  config.adaptiveLimiter,
+			next:     transportOrDefault(httpClient.Transport),
+		}
+		opts = append(opts[:len(opts):len(opts)], WithHTTPClient(httpClient))
+	}
+
+	var client Client
+	var err error
 	switch provider {
 	case Anthropic:
-		client, err := NewAnthropicClient()
-		if err != nil {
-			return nil, fmt.Errorf("failed to create client for provider %s: %w", provider, err)
-		}
-		return client, nil
+		client, err = NewAnthropicClient(opts...)
 	case Gemini:
-		client, err := NewGeminiClient()
-		if err != nil {
-			return nil, fmt.Errorf("failed to create client for provider %s: %w", provider, err)
-		}
-		return client, nil
+		client, err = NewGeminiClient(opts...)
 	case OpenAI:
-		client, err := NewOpenAIClient()
-		if err != nil {
-			return nil, fmt.Errorf("failed to create client for provider %s: %w", provider, err)
-		}
-		return client, nil
+		client, err = NewOpenAIClient(opts...)
+	case Vertex:
+		client, err = NewVertexClient(opts...)
+	case Mistral:
+		client, err = NewMistralClient(opts...)
+	case DeepSeek:
+		client, err = NewDeepSeekClient(opts...)
+	case Mock:
+		client, err = NewMockClient()
 	default:
 		return nil, fmt.Errorf("unsupported provider: %s", provider)
 	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for provider %s: %w", provider, err)
+	}
+
+	if config.rateLimiter != nil {
+		client = NewRateLimitedClient(client, provider, config.rateLimiter)
+	}
+	if config.adaptiveLimiter != nil {
+		client = NewAdaptiveClient(client, provider, config.adaptiveLimiter)
+	}
+	if config.circuitBreaker != nil {
+		client = NewCircuitBreakerClient(client, provider, config.circuitBreaker)
+	}
+	if config.budget != nil {
+		client = NewBudgetClient(client, provider, config.budget)
+	}
+	if config.semanticCache != nil {
+		client = NewSemanticCacheClient(client, provider, config.semanticCache)
+	}
+	if config.cache != nil {
+		client = NewCachedClient(client, provider, config.cache)
+	}
+	if config.logger != nil {
+		client = NewLoggingClient(client, provider, config.logger, config.logConfig)
+	}
+	if config.telemetry.TracerProvider != nil || config.telemetry.MeterProvider != nil {
+		client = NewTelemetryClient(client, provider, config.telemetry)
+	}
+	if len(config.middlewares) > 0 {
+		client = Chain(client, config.middlewares...)
+	}
+	return client, nil
+}
+
+// clientPool creates clients on demand and shares one client per provider.
+// It is used by wrappers that query several providers.
+type clientPool struct {
+	opts    []ClientOption
+	mu      sync.Mutex
+	clients map[string]Client // clients by provider
+}
+
+// get returns the client for a provider, creating it if needed
+func (p *clientPool) get(provider string) (Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if client, ok := p.clients[provider]; ok {
+		return client, nil
+	}
+	client, err := NewClient(provider, p.opts...)
+	if err != nil {
+		return nil, err
+	}
+	if p.clients == nil {
+		p.clients = make(map[string]Client)
+	}
+	p.clients[provider] = client
+	return client, nil
 }
 
-func queryTextLangChain(ctx context.Context, llm llms.Model, system string, prompts []string, model string, options Options) (string, error) {
+// Close closes the clients created by the pool
+func (p *clientPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var errs []error
+	for _, client := range p.clients {
+		if err := client.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	p.clients = nil
+	return errors.Join(errs...)
+}
+
+// queryLangChain sends a query to a langchaingo model and returns the response
+// with the stop reason and token usage reported by the provider.
+func queryLangChain(ctx context.Context, llm llms.Model, provider string, system string, history []Message, prompts []string, model string, options Options) (*Response, error) {
 	if ctx.Err() != nil {
-		return "", fmt.Errorf("request context error %w", ctx.Err())
+		return nil, fmt.Errorf("request context error %w", ctx.Err())
 	}
 
 	if len(prompts) == 0 {
-		return "", fmt.Errorf("prompts cannot be empty for text query")
+		return nil, fmt.Errorf("prompts cannot be empty for text query")
 	}
 
 	// system prompt
@@ -87,29 +397,117 @@ func queryTextLangChain(ctx context.Context, llm llms.Model, system string, prom
 		llms.TextParts(llms.ChatMessageTypeSystem, system),
 	}
 
+	// earlier turns of the conversation
+	for _, message := range history {
+		role := llms.ChatMessageTypeHuman
+		if message.Role == RoleAssistant {
+			role = llms.ChatMessageTypeAI
+		}
+		content = append(content, llms.TextParts(role, message.Text))
+	}
+
 	// query prompts
 	for _, prompt := range prompts {
 		content = append(content, llms.TextParts(llms.ChatMessageTypeHuman, prompt))
 	}
 
-	// generate completion
-	completion, err := llm.GenerateContent(
-		ctx, content,
+	callOptions := []llms.CallOption{
 		llms.WithTemperature(float64(options.Temperature)),
 		llms.WithModel(model),
 		llms.WithMaxTokens(int(options.MaxTokens)),
-	)
+	}
+	if options.StreamFunc != nil {
+		callOptions = append(callOptions, llms.WithStreamingFunc(options.StreamFunc))
+	}
+
+	// the prompt cache transport of the provider client applies the marks and reports cache usage;
+	// the marked prompts follow the history in the request messages
+	promptCache := options.PromptCache
+	if len(history) > 0 && len(promptCache.Prompts) > 0 {
+		promptCache.Prompts = make([]int, len(options.PromptCache.Prompts))
+		for i, index := range options.PromptCache.Prompts {
+			promptCache.Prompts[i] = index + len(history)
+		}
+	}
+	ctx, cacheState := withPromptCache(ctx, promptCache)
+
+	// generate completion
+	completion, err := llm.GenerateContent(ctx, content, callOptions...)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate completion: %w", err)
+		return nil, fmt.Errorf("failed to generate completion: %w", err)
 	}
 
-	var response strings.Builder
+	response := &Response{Provider: provider, Model: model}
+	var text strings.Builder
 	for _, part := range completion.Choices {
-		if DebugMode {
-			fmt.Fprintf(os.Stderr, "response completion %s:%v\n", model, part.StopReason)
+		text.WriteString(part.Content)
+		if part.StopReason != "" {
+			response.StopReason = part.StopReason
 		}
-		response.WriteString(part.Content)
+		usage := generationUsage(part.GenerationInfo)
+		response.Usage.InputTokens += usage.InputTokens
+		response.Usage.OutputTokens += usage.OutputTokens
 	}
+	response.Text = text.String()
 
-	return response.String(), nil
+	cacheUsage := cacheState.cacheUsage()
+	response.Usage.CacheReadTokens = cacheUsage.CacheReadTokens
+	response.Usage.CacheWriteTokens = cacheUsage.CacheWriteTokens
+	switch provider {
+	case Anthropic:
+		// anthropic reports the input tokens without the cached prefix
+		response.Usage.InputTokens += cacheUsage.CacheReadTokens + cacheUsage.CacheWriteTokens
+	case Gemini:
+		// gemini cached contents are created by a separate request
+		response.Usage.InputTokens += cacheUsage.CacheWriteTokens
+	}
+
+	return response, nil
+}
+
+// generationUsage extracts token usage from langchaingo generation info.
+// Each provider reports usage with different keys.
+func generationUsage(info map[string]any) Usage {
+	var usage Usage
+	for _, key := range []string{"InputTokens", "PromptTokens", "input_tokens"} {
+		if v, ok := info[key]; ok {
+			usage.InputTokens = toInt64(v)
+			break
+		}
+	}
+	for _, key := range []string{"OutputTokens", "CompletionTokens", "output_tokens"} {
+		if v, ok := info[key]; ok {
+			usage.OutputTokens = toInt64(v)
+			break
+		}
+	}
+
+	// mistral reports a usage struct
+	if v, ok := info["usage"]; ok && usage == (Usage{}) {
+		var u struct {
+			PromptTokens     int64 `json:"prompt_tokens"`
+			CompletionTokens int64 `json:"completion_tokens"`
+		}
+		if data, err := json.Marshal(v); err == nil && json.Unmarshal(data, &u) == nil {
+			usage = Usage{InputTokens: u.PromptTokens, OutputTokens: u.CompletionTokens}
+		}
+	}
+	return usage
+}
+
+// toInt64 converts a numeric value of any integer or float type to int64
+func toInt64(v any) int64 {
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	case float32:
+		return int64(n)
+	}
+	return 0
 }
@@ -0,0 +1,458 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-llmclient"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// batchLine is one line of a JSONL batch input file
+type batchLine struct {
+	ID          string   `json:"id"`
+	Prompt      string   `json:"prompt"`
+	System      string   `json:"system,omitempty"`
+	Model       string   `json:"model,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+}
+
+// batchOutput is one line of a JSONL batch output file
+type batchOutput struct {
+	ID         string        `json:"id"`
+	Model      string        `json:"model,omitempty"`
+	Text       string        `json:"text,omitempty"`
+	Usage      *sqirvy.Usage `json:"usage,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	DurationMS *int64        `json:"duration_ms,omitempty"` // not reported for provider batch jobs
+}
+
+// batchCmd runs a JSONL file of prompts, and is the parent of the provider batch job commands.
+var batchCmd = &cobra.Command{
+	Use:   "batch [FILE]",
+	Short: "Run a JSONL file of prompts, or submit it as a provider batch job",
+	Long: `sqirvy-cli batch FILE runs a JSONL file of prompts concurrently and writes one JSONL
+result per prompt, with the response text, usage, error and duration. Each input line
+is a JSON object:
+
+  {"id": "q1", "prompt": "...", "system": "...", "model": "...", "temperature": 0.5}
+
+system, model and temperature are optional and default to the query system prompt,
+--model and --temperature. With --resume, prompts whose id is already in the output
+file are skipped and new results are appended.
+
+The submit, status, results and cancel subcommands use the asynchronous provider batch
+jobs instead (Anthropic Message Batches or the OpenAI Batch API), which are processed
+at a discount within 24 hours. All lines of a job must use models of the same provider.
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			_ = cmd.Help()
+			return
+		}
+		parallel, _ := cmd.Flags().GetInt("parallel")
+		output, _ := cmd.Flags().GetString("output")
+		resume, _ := cmd.Flags().GetBool("resume")
+		if err := runBatch(args[0], output, parallel, resume); err != nil {
+			log.Fatalf("Error running batch: %v", err)
+		}
+	},
+}
+
+// batchSubmitCmd submits a JSONL file as a provider batch job and prints the job id.
+var batchSubmitCmd = &cobra.Command{
+	Use:   "submit FILE",
+	Short: "Submit a JSONL file of prompts as a provider batch job",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		lines, err := readBatchFile(args[0])
+		if err != nil {
+			log.Fatalf("Error reading batch file: %v", err)
+		}
+		requests := batchRequests(lines, viper.GetString("model"), viper.GetFloat64("temperature"))
+
+		provider := ""
+		for _, r := range requests {
+			p := providerForModel(r.Model)
+			if provider != "" && p != provider {
+				log.Fatalf("Error: batch %s mixes providers %s and %s", args[0], provider, p)
+			}
+			provider = p
+		}
+
+		client, err := sqirvy.NewBatchJobClient(provider)
+		if err != nil {
+			log.Fatalf("Error creating batch client: %v", err)
+		}
+		job, err := client.SubmitBatch(context.Background(), requests)
+		if err != nil {
+			log.Fatalf("Error submitting batch: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "Submitted   : %d requests to %s\n", len(requests), provider)
+		fmt.Println(job.ID)
+	},
+}
+
+// batchStatusCmd prints the state of a provider batch job as JSON.
+var batchStatusCmd = &cobra.Command{
+	Use:   "status ID",
+	Short: "Show the status of a provider batch job",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client := batchJobClient(args[0])
+		job, err := client.GetBatch(context.Background(), args[0])
+		if err != nil {
+			log.Fatalf("Error getting batch: %v", err)
+		}
+		printBatchJob(job)
+	},
+}
+
+// batchCancelCmd requests cancellation of a provider batch job.
+var batchCancelCmd = &cobra.Command{
+	Use:   "cancel ID",
+	Short: "Cancel a provider batch job",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client := batchJobClient(args[0])
+		job, err := client.CancelBatch(context.Background(), args[0])
+		if err != nil {
+			log.Fatalf("Error cancelling batch: %v", err)
+		}
+		printBatchJob(job)
+	},
+}
+
+// batchResultsCmd writes the results of a provider batch job as JSONL.
+var batchResultsCmd = &cobra.Command{
+	Use:   "results ID",
+	Short: "Write the results of a provider batch job as JSONL",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		client := batchJobClient(args[0])
+		if wait, _ := cmd.Flags().GetDuration("wait"); wait > 0 {
+			job, err := sqirvy.WaitBatch(ctx, client, args[0], wait)
+			if err != nil {
+				log.Fatalf("Error waiting for batch: %v", err)
+			}
+			fmt.Fprintf(os.Stderr, "Batch       : %s %s\n", job.ID, job.Status)
+		}
+
+		results, err := client.BatchResults(ctx, args[0])
+		if err != nil {
+			log.Fatalf("Error getting batch results: %v", err)
+		}
+
+		out := io.Writer(os.Stdout)
+		if path, _ := cmd.Flags().GetString("output"); path != "" {
+			f, err := os.Create(path)
+			if err != nil {
+				log.Fatalf("Error creating output file: %v", err)
+			}
+			defer f.Close()
+			out = f
+		}
+		enc := json.NewEncoder(out)
+		for _, r := range results {
+			line := batchOutput{ID: r.CustomID, Error: r.Error}
+			if r.Response != nil {
+				line.Model = r.Response.Model
+				line.Text = r.Response.Text
+				line.Usage = &r.Response.Usage
+			}
+			if err := enc.Encode(line); err != nil {
+				log.Fatalf("Error writing batch results: %v", err)
+			}
+		}
+	},
+}
+
+// readBatchFile reads a JSONL batch input file. Every line must have a unique id and a prompt.
+func readBatchFile(path string) ([]batchLine, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []batchLine
+	ids := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxInputTotalBytes)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var line batchLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		if line.ID == "" || line.Prompt == "" {
+			return nil, fmt.Errorf("%s:%d: id and prompt are required", path, n)
+		}
+		if ids[line.ID] {
+			return nil, fmt.Errorf("%s:%d: duplicate id %s", path, n, line.ID)
+		}
+		ids[line.ID] = true
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%s: no prompts", path)
+	}
+	return lines, nil
+}
+
+// batchRequests converts batch lines to requests, using the query system prompt,
+// model and temperature for fields that are not set in a line
+func batchRequests(lines []batchLine, model string, temperature float64) []sqirvy.BatchJobRequest {
+	requests := make([]sqirvy.BatchJobRequest, len(lines))
+	for i, line := range lines {
+		r := sqirvy.BatchJobRequest{CustomID: line.ID}
+		r.System = line.System
+		if r.System == "" {
+			r.System = queryPrompt
+		}
+		r.Model = line.Model
+		if r.Model == "" {
+			r.Model = model
+		}
+		r.Model = sqirvy.GetModelAlias(r.Model)
+		t := temperature
+		if line.Temperature != nil {
+			t = *line.Temperature
+		}
+		r.Prompts = []string{line.Prompt}
+		r.Options = sqirvy.Options{Temperature: float32(t), MaxTokens: sqirvy.GetMaxTokens(r.Model)}
+		requests[i] = r
+	}
+	return requests
+}
+
+// runBatch runs the prompts of a JSONL batch file with parallel concurrent requests
+// and writes the results to the output file, or stdout if output is empty. Results are
+// written as they complete, so an interrupted batch can be continued with resume.
+func runBatch(path string, output string, parallel int, resume bool) error {
+	lines, err := readBatchFile(path)
+	if err != nil {
+		return err
+	}
+
+	out := io.Writer(os.Stdout)
+	if output != "" {
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if resume {
+			done, err := batchOutputIDs(output)
+			if err != nil {
+				return err
+			}
+			remaining := lines[:0]
+			for _, line := range lines {
+				if !done[line.ID] {
+					remaining = append(remaining, line)
+				}
+			}
+			fmt.Fprintf(os.Stderr, "Resuming    : %d of %d prompts done\n", len(lines)-len(remaining), len(lines))
+			lines = remaining
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+		f, err := os.OpenFile(output, flags, 0644)
+		if err != nil {
+			return fmt.Errorf("creating output file: %v", err)
+		}
+		defer f.Close()
+		out = f
+	} else if resume {
+		return fmt.Errorf("--resume requires --output")
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	clientOptions, done, err := queryClientOptions("batch", os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer done()
+	client := &modelClients{options: clientOptions, clients: make(map[string]sqirvy.Client)}
+	defer client.Close()
+
+	var requests []sqirvy.Request
+	for _, r := range batchRequests(lines, viper.GetString("model"), viper.GetFloat64("temperature")) {
+		requests = append(requests, r.Request)
+	}
+
+	// stop starting new prompts on interrupt, the results written so far are kept
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx = queryContext(ctx)
+
+	enc := json.NewEncoder(out)
+	var writeErr error
+	failed := 0
+	_, err = sqirvy.BatchQuery(ctx, client, requests, sqirvy.BatchOptions{
+		Workers: parallel,
+		OnProgress: func(n, total int, result sqirvy.BatchResult) {
+			id := lines[result.Index].ID
+			// prompts interrupted by the cancel are not written, so resume runs them again
+			if ctx.Err() != nil && errors.Is(result.Err, context.Canceled) {
+				return
+			}
+			ms := result.Duration.Milliseconds()
+			line := batchOutput{ID: id, Model: result.Request.Model, DurationMS: &ms}
+			status := "ok"
+			if result.Err != nil {
+				line.Error = result.Err.Error()
+				status = "error"
+				failed++
+			} else {
+				line.Model = result.Response.Model
+				line.Text = result.Response.Text
+				line.Usage = &result.Response.Usage
+			}
+			if err := enc.Encode(line); err != nil && writeErr == nil {
+				writeErr = err
+			}
+			fmt.Fprintf(os.Stderr, "[%d/%d] %s %s (%s)\n", n, total, id, status, result.Duration.Round(time.Millisecond))
+		},
+	})
+	if writeErr != nil {
+		return fmt.Errorf("writing results: %v", writeErr)
+	}
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "Failed      : %d of %d prompts\n", failed, len(requests))
+	}
+	return nil
+}
+
+// batchOutputIDs returns the ids of the results in a batch output file.
+// A missing file has no results.
+func batchOutputIDs(path string) (map[string]bool, error) {
+	ids := make(map[string]bool)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ids, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*MaxInputTotalBytes)
+	for scanner.Scan() {
+		var line batchOutput
+		// a partial last line of an interrupted run is ignored
+		if json.Unmarshal(scanner.Bytes(), &line) == nil && line.ID != "" {
+			ids[line.ID] = true
+		}
+	}
+	return ids, scanner.Err()
+}
+
+// modelClients is a client that sends each request to the client of its model,
+// created on first use, so the lines of a batch can use different models and providers
+type modelClients struct {
+	options []sqirvy.ClientOption
+	mu      sync.Mutex
+	clients map[string]sqirvy.Client
+}
+
+// Ensure modelClients implements the Client and Querier interfaces
+var (
+	_ sqirvy.Client  = (*modelClients)(nil)
+	_ sqirvy.Querier = (*modelClients)(nil)
+)
+
+// Query sends the request to the client of its model
+func (m *modelClients) Query(ctx context.Context, req sqirvy.Request) (*sqirvy.Response, error) {
+	m.mu.Lock()
+	client, ok := m.clients[req.Model]
+	if !ok {
+		var err error
+		client, err = newQueryClient(req.Model, m.options)
+		if err != nil {
+			m.mu.Unlock()
+			return nil, err
+		}
+		m.clients[req.Model] = client
+	}
+	m.mu.Unlock()
+	return sqirvy.Query(ctx, client, req)
+}
+
+// QueryText sends the query to the client of the model
+func (m *modelClients) QueryText(ctx context.Context, system string, prompts []string, model string, options sqirvy.Options) (string, error) {
+	resp, err := m.Query(ctx, sqirvy.Request{System: system, Prompts: prompts, Model: model, Options: options})
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+// Close closes the clients of all models
+func (m *modelClients) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var errs []error
+	for _, client := range m.clients {
+		errs = append(errs, client.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// batchJobClient returns the batch job client for the provider of a job id
+func batchJobClient(id string) sqirvy.BatchJobClient {
+	provider, err := sqirvy.BatchJobProvider(id)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	client, err := sqirvy.NewBatchJobClient(provider)
+	if err != nil {
+		log.Fatalf("Error creating batch client: %v", err)
+	}
+	return client
+}
+
+// printBatchJob prints a batch job as indented JSON to stdout
+func printBatchJob(job *sqirvy.BatchJob) {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		log.Fatalf("Error encoding batch: %v", err)
+	}
+	fmt.Println(string(data))
+}
+
+// init registers the batch command family with the root command.
+func init() {
+	batchResultsCmd.Flags().StringP("output", "o", "", "Write the results to this file instead of stdout")
+	batchResultsCmd.Flags().Duration("wait", 0, "Poll at this interval until the job is done before fetching results (e.g. 1m)")
+
+	batchCmd.Flags().IntP("parallel", "p", 4, "Number of prompts sent concurrently")
+	batchCmd.Flags().StringP("output", "o", "", "Write the results to this file instead of stdout")
+	batchCmd.Flags().Bool("resume", false, "Skip prompts whose id is already in the output file and append new results")
+
+	batchCmd.AddCommand(batchSubmitCmd, batchStatusCmd, batchResultsCmd, batchCancelCmd)
+	rootCmd.AddCommand(batchCmd)
+}
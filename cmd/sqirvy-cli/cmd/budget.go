@@ -0,0 +1,98 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-llmclient"
+
+	"github.com/spf13/viper"
+)
+
+// budgetConfig is the spend budget in the config file, in USD
+type budgetConfig struct {
+	Daily        float64 `mapstructure:"daily"`
+	Monthly      float64 `mapstructure:"monthly"`
+	PerRequest   float64 `mapstructure:"per-request"`
+	WarnPercent  float64 `mapstructure:"warn-percent"`
+	OutputTokens int64   `mapstructure:"output-tokens"`
+}
+
+// ledgerHistory is the spend history of the usage ledger. The ledger is read once,
+// and the spend of this run is tracked in memory.
+type ledgerHistory struct {
+	path string
+	run  *sqirvy.SpendTracker
+
+	once    sync.Once
+	records []ledgerRecord
+	err     error
+}
+
+// Spend implements sqirvy.SpendHistory.
+func (h *ledgerHistory) Spend(since time.Time) (float64, error) {
+	h.once.Do(func() {
+		h.records, h.err = readLedger(h.path)
+	})
+	if h.err != nil {
+		return 0, h.err
+	}
+	total, _ := h.run.Spend(since)
+	for _, r := range h.records {
+		if !r.Time.Before(since) {
+			total += r.Cost
+		}
+	}
+	return total, nil
+}
+
+// RecordSpend implements sqirvy.SpendRecorder.
+func (h *ledgerHistory) RecordSpend(at time.Time, cost float64) error {
+	return h.run.RecordSpend(at, cost)
+}
+
+// spendBudget returns the spend budget in the config file, or nil if there is none.
+// The spend of earlier runs is read from the usage ledger at path, which is empty
+// if the ledger is disabled. Warnings are written to status.
+func spendBudget(path string, status io.Writer) (*sqirvy.Budget, error) {
+	var config budgetConfig
+	if err := viper.UnmarshalKey("budget", &config); err != nil {
+		return nil, fmt.Errorf("error: invalid budget config: %v", err)
+	}
+	if config.Daily <= 0 && config.Monthly <= 0 && config.PerRequest <= 0 {
+		return nil, nil
+	}
+
+	// without the ledger only the spend of this run is counted
+	var history sqirvy.SpendHistory
+	if path != "" {
+		history = &ledgerHistory{path: path, run: sqirvy.NewSpendTracker()}
+	}
+	return sqirvy.NewBudget(sqirvy.BudgetConfig{
+		Daily:        config.Daily,
+		Monthly:      config.Monthly,
+		PerRequest:   config.PerRequest,
+		WarnPercent:  config.WarnPercent,
+		OutputTokens: config.OutputTokens,
+		Warn: func(check sqirvy.BudgetCheck) {
+			printBudgetWarning(status, check)
+		},
+	}, history), nil
+}
+
+// printBudgetWarning prints a budget that a request brings above the warning
+// threshold, or exceeds with --force, to w
+func printBudgetWarning(w io.Writer, check sqirvy.BudgetCheck) {
+	if check.Exceeded {
+		fmt.Fprintf(w, "Budget      : %s budget of $%.2f exceeded (est. $%.4f), sent with --force\n",
+			check.Period, check.Limit, check.Spent+check.Estimated)
+		return
+	}
+	fmt.Fprintf(w, "Budget      : %.0f%% of the %s budget of $%.2f used (est. $%.4f)\n",
+		check.Percent(), check.Period, check.Limit, check.Spent+check.Estimated)
+}
@@ -0,0 +1,107 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	sqirvy "github.com/dmh2000/sqirvy-llmclient"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// default limits of the response cache, overridden by the config file
+const (
+	defaultCacheTTL      = "168h"
+	defaultCacheMaxBytes = 100 * 1024 * 1024
+)
+
+// cacheCmd represents the command family that manages the response cache.
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Show or clear the response cache used with --cache",
+	Long: `sqirvy-cli cache manages the on-disk response cache. With --cache (or cache: true in
+the config file), a request that is identical to an earlier one (same provider, model,
+system prompt, prompts and options) is answered from the cache instead of the provider.
+The cache limits are set in the config file with cache-ttl, cache-max-bytes and
+cache-max-entries.
+`,
+}
+
+// cacheStatsCmd prints the size and hit counts of the response cache.
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show the response cache statistics",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cache, dir, err := responseCache()
+		if err != nil {
+			log.Fatalf("Error opening cache: %v", err)
+		}
+		stats, err := cache.Stats()
+		if err != nil {
+			log.Fatalf("Error reading cache: %v", err)
+		}
+		fmt.Printf("Directory   : %s\n", dir)
+		fmt.Printf("Entries     : %d\n", stats.Entries)
+		fmt.Printf("Size        : %d bytes\n", stats.Bytes)
+		fmt.Printf("Hits        : %d\n", stats.Hits)
+		fmt.Printf("Misses      : %d\n", stats.Misses)
+	},
+}
+
+// cacheClearCmd removes all entries of the response cache.
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove all entries from the response cache",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cache, _, err := responseCache()
+		if err != nil {
+			log.Fatalf("Error opening cache: %v", err)
+		}
+		if err := cache.Clear(); err != nil {
+			log.Fatalf("Error clearing cache: %v", err)
+		}
+		fmt.Fprintln(os.Stderr, "Cache cleared")
+	},
+}
+
+// cacheEnabled reports whether responses are cached: --cache or cache: true in the
+// config file, unless --no-cache is set
+func cacheEnabled() bool {
+	return viper.GetBool("cache") && !viper.GetBool("no-cache")
+}
+
+// responseCache opens the on-disk response cache with the limits in the config file
+// and returns it with its directory
+func responseCache() (*sqirvy.DiskCache, string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, "", fmt.Errorf("finding cache directory: %v", err)
+	}
+	dir = filepath.Join(dir, "sqirvy-cli", "responses")
+
+	viper.SetDefault("cache-ttl", defaultCacheTTL)
+	viper.SetDefault("cache-max-bytes", defaultCacheMaxBytes)
+	cache, err := sqirvy.NewDiskCache(dir, sqirvy.CacheConfig{
+		TTL:        viper.GetDuration("cache-ttl"),
+		MaxEntries: viper.GetInt("cache-max-entries"),
+		MaxBytes:   viper.GetInt64("cache-max-bytes"),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return cache, dir, nil
+}
+
+// init registers the cache command family with the root command.
+func init() {
+	cacheCmd.AddCommand(cacheStatsCmd, cacheClearCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
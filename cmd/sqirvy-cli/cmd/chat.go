@@ -0,0 +1,375 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	sqirvy "github.com/dmh2000/sqirvy-llmclient"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// chatHelp lists the slash commands of the chat command
+const chatHelp = `Commands:
+  /file PATH...    attach files to the next message
+  /url URL...      attach web pages to the next message
+  /model NAME      switch the model for the next replies
+  /temp VALUE      set the temperature (0.0 to 1.0)
+  /system [TEXT]   show or replace the system prompt
+  /reset           clear the conversation and attachments
+  /save FILE       save the conversation as Markdown
+  /help            show this help
+  /exit            end the chat (or Ctrl-D)`
+
+// chatCmd represents the interactive chat command.
+var chatCmd = &cobra.Command{
+	Use:   "chat [files| urls]",
+	Short: "Chat with the LLM interactively, keeping the conversation history",
+	Long: `sqirvy-cli chat starts an interactive conversation with the LLM. Each message is sent
+with the earlier messages and replies of the conversation, and replies are streamed to
+stdout as they are generated. Files and URLs given as arguments are attached to the
+first message; more can be attached at any time with slash commands:
+
+` + chatHelp + `
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runChat(os.Stdin, os.Stdout, args); err != nil {
+			log.Fatalf("Error running chat: %v", err)
+		}
+	},
+}
+
+// chatSession is the state of an interactive conversation
+type chatSession struct {
+	model       string
+	temperature float64
+	system      string
+	history     []sqirvy.Message
+	attachments []string // files and urls sent with the next message
+	sources     []string // names of the attachments
+
+	options []sqirvy.ClientOption
+	client  sqirvy.Client
+	out     io.Writer // replies
+	status  io.Writer // status and error messages
+}
+
+// runChat reads messages and slash commands from in, one per line, and writes the
+// replies to out until the input ends or /exit
+func runChat(in io.Reader, out io.Writer, args []string) error {
+	session, done, err := newChatSession("chat", out, os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer done()
+	if err := session.attach(args); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "Type a message, /help for commands, /exit to quit")
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Fprint(os.Stderr, "> ")
+		line, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line != "" {
+			quit, cmdErr := session.handle(line)
+			if cmdErr != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", cmdErr)
+			}
+			if quit {
+				return nil
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			fmt.Fprintln(os.Stderr)
+			return nil
+		}
+	}
+}
+
+// newChatSession returns a conversation with the model, temperature and system prompt
+// of the config, whose queries are recorded in the usage ledger as command. The done
+// function closes the clients of the session.
+func newChatSession(command string, out, status io.Writer) (*chatSession, func(), error) {
+	options, done, err := queryClientOptions(command, status)
+	if err != nil {
+		return nil, nil, err
+	}
+	session := &chatSession{
+		temperature: viper.GetFloat64("temperature"),
+		system:      queryPrompt,
+		options:     options,
+		out:         out,
+		status:      status,
+	}
+	if err := session.setModel(viper.GetString("model")); err != nil {
+		done()
+		return nil, nil, err
+	}
+	return session, func() {
+		session.close()
+		done()
+	}, nil
+}
+
+// handle runs a slash command or sends a message. It returns true when the chat should end.
+func (s *chatSession) handle(line string) (bool, error) {
+	if !strings.HasPrefix(line, "/") {
+		return false, s.send(line)
+	}
+
+	command, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch command {
+	case "/exit", "/quit":
+		return true, nil
+	case "/help":
+		fmt.Fprintln(s.status, chatHelp)
+	case "/file", "/url":
+		sources, err := attachSources(command, arg)
+		if err != nil {
+			return false, err
+		}
+		return false, s.attach(sources)
+	case "/model":
+		if arg == "" {
+			fmt.Fprintln(s.status, "Using model :", s.model)
+			return false, nil
+		}
+		return false, s.setModel(arg)
+	case "/temp":
+		temperature, err := strconv.ParseFloat(arg, 64)
+		if err != nil || temperature < 0 || temperature > 1 {
+			return false, fmt.Errorf("invalid temperature %q, use a value from 0.0 to 1.0", arg)
+		}
+		s.temperature = temperature
+		fmt.Fprintf(s.status, "Temperature : %.2f\n", temperature)
+	case "/system":
+		if arg == "" {
+			fmt.Fprintln(s.status, s.system)
+			return false, nil
+		}
+		s.system = arg
+		fmt.Fprintln(s.status, "System prompt replaced")
+	case "/reset":
+		s.history = nil
+		s.attachments = nil
+		s.sources = nil
+		fmt.Fprintln(s.status, "Conversation cleared")
+	case "/save":
+		if arg == "" {
+			return false, fmt.Errorf("usage: /save FILE")
+		}
+		if err := os.WriteFile(arg, []byte(chatMarkdown("Conversation", s.model, s.system, s.history)), 0o644); err != nil {
+			return false, fmt.Errorf("saving conversation: %v", err)
+		}
+		fmt.Fprintln(s.status, "Saved       :", arg)
+	default:
+		return false, fmt.Errorf("unknown command %s, type /help for commands", command)
+	}
+	return false, nil
+}
+
+// attachSources returns the files or urls of a /file or /url command
+func attachSources(command, arg string) ([]string, error) {
+	if arg == "" {
+		return nil, fmt.Errorf("usage: %s %s", command, map[string]string{"/file": "PATH...", "/url": "URL..."}[command])
+	}
+	sources := strings.Fields(arg)
+	for _, source := range sources {
+		if (command == "/url") != isURL(source) {
+			return nil, fmt.Errorf("%s is not a %s", source, strings.TrimPrefix(command, "/"))
+		}
+	}
+	return sources, nil
+}
+
+// attach reads files and urls to send with the next message
+func (s *chatSession) attach(sources []string) error {
+	contents, err := readSources(sources)
+	if err != nil {
+		return err
+	}
+	return s.addAttachments(sources, contents)
+}
+
+// readSources reads the contents of files and urls
+func readSources(sources []string) ([]string, error) {
+	var contents []string
+	for _, source := range sources {
+		var content string
+		var err error
+		if isURL(source) {
+			content, err = readURL(source)
+		} else {
+			content, err = readFile(source)
+		}
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, content)
+	}
+	return contents, nil
+}
+
+// addAttachments adds the contents of files and urls to send with the next message
+func (s *chatSession) addAttachments(sources, contents []string) error {
+	length := 0
+	for _, attachment := range s.attachments {
+		length += len(attachment)
+	}
+	for i, source := range sources {
+		content := contents[i]
+		length += len(content)
+		if length > MaxInputTotalBytes {
+			return fmt.Errorf("total size of the attachments would exceed limit of %d bytes", MaxInputTotalBytes)
+		}
+		s.attachments = append(s.attachments, content)
+		s.sources = append(s.sources, source)
+		fmt.Fprintf(s.status, "Attached    : %s (%d bytes)\n", source, len(content))
+	}
+	return nil
+}
+
+// setModel switches the conversation to a model, fallback chain or auto
+func (s *chatSession) setModel(model string) error {
+	if model != autoModel && len(modelChain(model)) == 0 {
+		model = sqirvy.GetModelAlias(model)
+	}
+	client, err := newQueryClient(model, s.options)
+	if err != nil {
+		return err
+	}
+	s.close()
+	s.model, s.client = model, client
+	fmt.Fprintln(s.status, "Using model :", model)
+	return nil
+}
+
+// send sends a message with the pending attachments and the conversation history,
+// streams the reply to the output and adds both to the history. The reply can be
+// interrupted with Ctrl-C, which leaves the history unchanged.
+func (s *chatSession) send(message string) error {
+	req, err := s.request(message)
+	if err != nil {
+		return err
+	}
+	if s.streams() {
+		req.Options.StreamFunc = func(ctx context.Context, chunk []byte) error {
+			_, err := s.out.Write(chunk)
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	response, err := sqirvy.Query(queryContext(ctx), s.client, req)
+	fmt.Fprintln(s.out)
+	if ctx.Err() != nil {
+		return fmt.Errorf("reply interrupted")
+	}
+	if errors.Is(err, sqirvy.ErrBudgetExceeded) {
+		return fmt.Errorf("%v (use --force to send it anyway)", err)
+	}
+	if err != nil {
+		return err
+	}
+	if !s.streams() {
+		fmt.Fprintln(s.out, response.Text)
+	}
+	s.commit(req, response.Text)
+	return nil
+}
+
+// streams reports whether replies are streamed. Replies of a fallback chain are not,
+// since a target that fails after streaming part of its reply would leave the
+// fragment before the reply of the next target.
+func (s *chatSession) streams() bool {
+	return len(modelChain(s.model)) == 0
+}
+
+// request returns the request of a message with the pending attachments and the
+// conversation history
+func (s *chatSession) request(message string) (sqirvy.Request, error) {
+	// the oldest exchanges are removed when the conversation outgrows the context window
+	prompts := append(s.attachments[:len(s.attachments):len(s.attachments)], message)
+	history, removed, err := trimHistory(s.model, s.system, prompts, s.history)
+	if err != nil {
+		return sqirvy.Request{}, err
+	}
+	if removed > 0 {
+		s.history = history
+		fmt.Fprintf(s.status, "History     : removed the %d oldest messages to fit the context window\n", removed)
+	}
+
+	options := sqirvy.Options{
+		Temperature: float32(s.temperature),
+		MaxTokens:   sqirvy.GetMaxTokens(s.model),
+	}
+	if viper.GetBool("prompt-cache") {
+		options.PromptCache = sqirvy.PromptCache{System: true}
+	}
+	return sqirvy.Request{
+		System:  s.system,
+		History: s.history,
+		Prompts: prompts,
+		Model:   s.model,
+		Options: options,
+	}, nil
+}
+
+// commit adds a request and its reply to the history and clears the attachments
+func (s *chatSession) commit(req sqirvy.Request, reply string) {
+	s.history = append(s.history,
+		sqirvy.Message{Role: sqirvy.RoleUser, Text: strings.Join(req.Prompts, "\n\n")},
+		sqirvy.Message{Role: sqirvy.RoleAssistant, Text: reply},
+	)
+	s.attachments = nil
+	s.sources = nil
+}
+
+// close closes the client of the current model
+func (s *chatSession) close() {
+	if s.client == nil {
+		return
+	}
+	if err := s.client.Close(); err != nil {
+		fmt.Fprintf(s.status, "error closing client: %v\n", err)
+	}
+	s.client = nil
+}
+
+// chatMarkdown returns a conversation as a Markdown document with a title
+func chatMarkdown(title, model, system string, history []sqirvy.Message) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n- Model: %s\n\n## System\n\n%s\n", title, model, strings.TrimSpace(system))
+	for _, message := range history {
+		title := "User"
+		if message.Role == sqirvy.RoleAssistant {
+			title = "Assistant"
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n%s\n", title, strings.TrimSpace(message.Text))
+	}
+	return b.String()
+}
+
+// init registers the chat command with the root command.
+func init() {
+	rootCmd.AddCommand(chatCmd)
+}
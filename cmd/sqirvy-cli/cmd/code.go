@@ -32,7 +32,7 @@ The prompt is constructed in this order:
 		temperature := viper.GetFloat64("temperature")
 
 		// Execute the query using the specific code generation prompt
-		response, err := executeQuery(model, temperature, codePrompt, args)
+		response, err := executeQuery("code", sessionFlag(cmd), model, temperature, codePrompt, args)
 		if err != nil {
 			log.Fatalf("Error executing code command: %v", err)
 		}
@@ -6,48 +6,85 @@ package cmd
 import (
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 
 	sqirvy "github.com/dmh2000/sqirvy-llmclient"
+	"github.com/spf13/viper"
 )
 
+// autoModel is the model name that selects a model with the routing policy in the config file
+const autoModel = "auto"
+
 // executeQuery processes and executes an AI model query with the given system prompt and arguments.
 // It handles model selection, temperature settings, and communication with the AI provider.
 //
 // Parameters:
-//   - cmd: The Cobra command instance containing parsed flags
+//   - command: The name of the command, recorded in the usage ledger
+//   - sessionName: The session continued by the query, or empty
+//   - model: The model, fallback chain or auto
+//   - temperature: The temperature of the query
 //   - sysprompt: The system prompt to provide context to the AI model
 //   - args: Additional arguments to be processed as part of the query
 //
 // Returns:
 //   - string: The model's response text
 //   - error: Any error encountered during execution
-func executeQuery(model string, temperature float64, system string, args []string) (string, error) {
-	// check if it has an alias
-	model = sqirvy.GetModelAlias(model)
-
-	// Print the selected model to stderr
-	fmt.Fprintln(os.Stderr, "Using model :", model)
-
+func executeQuery(command string, sessionName string, model string, temperature float64, system string, args []string) (string, error) {
 	// Process system prompt and arguments into query prompts
 	prompts, err := readPrompt(args)
 	if err != nil {
 		return "", fmt.Errorf("error: reading prompt:[]string{\n%v", err)
 	}
 
-	// Determine the AI provider based on the selected model
-	provider, err := sqirvy.GetProviderName(model)
+	// continue the conversation of the session, read after stdin so that the
+	// previous command of a pipeline has saved its reply
+	var conversation *session
+	if sessionName != "" {
+		// the session is locked until its exchange is saved
+		unlock, err := lockSession(sessionName)
+		if err != nil {
+			return "", fmt.Errorf("error: locking session %s: %v", sessionName, err)
+		}
+		defer unlock()
+		if conversation, err = openSession(sessionName); err != nil {
+			return "", fmt.Errorf("error: reading session %s: %v", sessionName, err)
+		}
+		// the session keeps its model unless --model is given
+		if conversation.Model != "" && !rootCmd.PersistentFlags().Changed("model") {
+			model = conversation.Model
+		}
+	}
+
+	chain := modelChain(model)
+	switch {
+	case model == autoModel:
+		fmt.Fprintln(os.Stderr, "Using model : auto")
+	case len(chain) > 0:
+		fmt.Fprintln(os.Stderr, "Using chain :", strings.Join(chain, ","))
+	default:
+		// check if it has an alias
+		model = sqirvy.GetModelAlias(model)
+
+		// Print the selected model to stderr
+		fmt.Fprintln(os.Stderr, "Using model :", model)
+	}
+
+	clientOptions, done, err := queryClientOptions(command, os.Stderr)
 	if err != nil {
-		// many of the models are not registered with this package
-		// use user model name and assume openai compatible provider
-		provider = "openai"
+		return "", err
 	}
+	defer done()
 
-	// Create client for the provider
-	client, err := sqirvy.NewClient(provider)
+	// Create client for the provider, a router for auto, or a fallback client for the chain
+	client, err := newQueryClient(model, clientOptions)
 	if err != nil {
-		return "", fmt.Errorf("error: creating client for provider %s: %v", provider, err)
+		return "", err
 	}
 	defer func() {
 		err := client.Close()
@@ -57,12 +94,231 @@ func executeQuery(model string, temperature float64, system string, args []strin
 	}()
 
 	// Configure query options and execute the query
+	ctx := queryContext(context.Background())
 	options := sqirvy.Options{Temperature: float32(temperature), MaxTokens: sqirvy.GetMaxTokens(model)}
-	ctx := context.Background()
-	response, err := client.QueryText(ctx, system, prompts, model, options)
+	if viper.GetBool("prompt-cache") {
+		// the system prompt and inputs are resent unchanged when a run is repeated
+		options.PromptCache = sqirvy.PromptCache{System: true, Prompts: []int{len(prompts) - 1}}
+	}
+	req := sqirvy.Request{System: system, Prompts: prompts, Model: model, Options: options}
+	if conversation != nil {
+		removed, err := conversation.trim(model, system, prompts)
+		if err != nil {
+			return "", fmt.Errorf("error: continuing session %s: %v", sessionName, err)
+		}
+		if removed > 0 {
+			fmt.Fprintf(os.Stderr, "Session     : removed the %d oldest messages to fit the context window\n", removed)
+		}
+		req.History = conversation.Messages
+	}
+	response, err := sqirvy.Query(ctx, client, req)
+	if errors.Is(err, sqirvy.ErrBudgetExceeded) {
+		return "", fmt.Errorf("error: querying model %s: %v (use --force to send it anyway)", model, err)
+	}
 	if err != nil {
 		return "", fmt.Errorf("error: querying model %s: %v", model, err)
 	}
+	if response.Metadata[sqirvy.MetadataCache] == sqirvy.CacheHitExact {
+		fmt.Fprintln(os.Stderr, "Cache       : hit")
+	}
+	if usage := response.Usage; usage.CacheReadTokens > 0 || usage.CacheWriteTokens > 0 {
+		fmt.Fprintf(os.Stderr, "Prompt cache: %d tokens read, %d written\n", usage.CacheReadTokens, usage.CacheWriteTokens)
+	}
+	if target := response.Metadata[sqirvy.MetadataFallbackTarget]; target != "" {
+		fmt.Fprintln(os.Stderr, "Answered by :", target)
+	}
+	if routed := response.Metadata[sqirvy.MetadataRouteModel]; routed != "" {
+		fmt.Fprintf(os.Stderr, "Routed to   : %s (%s, est. $%s)\n", routed,
+			response.Metadata[sqirvy.MetadataRouteReason], response.Metadata[sqirvy.MetadataRouteEstimatedCost])
+	}
+
+	// add the exchange to the session before the reply is written to the next command
+	if conversation != nil {
+		conversation.add(model, system, prompts, response.Text)
+		if err := saveSession(conversation); err != nil {
+			fmt.Fprintf(os.Stderr, "error saving session %s: %v\n", sessionName, err)
+		}
+	}
+
+	return response.Text, nil
+}
+
+// queryContext returns a context for queries with the difficulty hint of --difficulty
+// that allows requests exceeding the spend budget with --force
+func queryContext(ctx context.Context) context.Context {
+	ctx = sqirvy.WithDifficulty(ctx, sqirvy.Difficulty(viper.GetString("difficulty")))
+	if force, _ := rootCmd.PersistentFlags().GetBool("force"); force {
+		ctx = sqirvy.WithBudgetForce(ctx)
+	}
+	return ctx
+}
+
+// modelChain returns the models of a fallback chain: the chain of that name in the
+// config file, or a comma separated list of models. It returns nil for a single model.
+func modelChain(model string) []string {
+	chain := viper.GetStringSlice("chains." + model)
+	if len(chain) == 0 && strings.Contains(model, ",") {
+		chain = strings.Split(model, ",")
+	}
+	return chain
+}
+
+// queryClientOptions returns the client options of a command set by the flags and config file:
+// cassette recording or replay, rate limits, the response cache, logging, the usage ledger
+// and the spend budget. Status messages, budget warnings and the --verbose log are written
+// to status.
+// The returned function saves the cassette and must be called when the clients are no longer used.
+func queryClientOptions(command string, status io.Writer) ([]sqirvy.ClientOption, func(), error) {
+	var clientOptions []sqirvy.ClientOption
+	done := func() {}
+
+	// optionally record or replay the provider http exchanges
+	if path := viper.GetString("cassette"); path != "" {
+		cassette, err := sqirvy.NewCassette(path, sqirvy.CassetteMode(viper.GetString("cassette-mode")), nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error: opening cassette: %v", err)
+		}
+		fmt.Fprintf(status, "Cassette    : %s (%s)\n", path, cassette.Mode())
+		clientOptions = append(clientOptions, sqirvy.WithHTTPClient(&http.Client{Transport: cassette}))
+		done = func() {
+			if err := cassette.Save(); err != nil {
+				fmt.Fprintf(os.Stderr, "error saving cassette: %v\n", err)
+			}
+		}
+	}
+
+	// optionally limit the request and token rates, shared with other sqirvy-cli processes
+	limiter, err := rateLimiter()
+	if err != nil {
+		return nil, nil, err
+	}
+	if limiter != nil {
+		clientOptions = append(clientOptions, sqirvy.WithRateLimiter(limiter))
+	}
+
+	// optionally answer repeated requests from the response cache
+	if cacheEnabled() {
+		cache, _, err := responseCache()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error: opening cache: %v", err)
+		}
+		clientOptions = append(clientOptions, sqirvy.WithCache(cache))
+	}
+
+	// optionally log the queries with --verbose
+	logOptions, err := loggerOptions(status)
+	if err != nil {
+		return nil, nil, err
+	}
+	clientOptions = append(clientOptions, logOptions...)
+
+	// record the completed requests in the usage ledger
+	var ledger string
+	if ledgerEnabled() {
+		path, err := ledgerPath()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error: opening usage ledger: %v", err)
+		}
+		ledger = path
+		clientOptions = append(clientOptions, sqirvy.WithMiddleware(ledgerMiddleware(command, path, status)))
+	}
 
-	return response, nil
+	// optionally refuse requests that would exceed the spend budget, unless --force is set
+	budget, err := spendBudget(ledger, status)
+	if err != nil {
+		return nil, nil, err
+	}
+	if budget != nil {
+		clientOptions = append(clientOptions, sqirvy.WithBudget(budget))
+	}
+	return clientOptions, done, nil
+}
+
+// newQueryClient creates the client for a model: a router for auto, a fallback client
+// for a chain, or the client of the model provider.
+func newQueryClient(model string, clientOptions []sqirvy.ClientOption) (sqirvy.Client, error) {
+	chain := modelChain(model)
+	switch {
+	case model == autoModel:
+		policy := sqirvy.RoutingPolicy{
+			Models:         viper.GetStringSlice("routing.models"),
+			StrongModels:   viper.GetStringSlice("routing.strong-models"),
+			EscalateTokens: viper.GetInt64("routing.escalate-tokens"),
+			// the models are served by the same providers as with -m, e.g. through vertex ai
+			Provider: providerForModel,
+		}
+		client, err := sqirvy.NewRouterClient(policy, clientOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("error: creating router: %v", err)
+		}
+		return client, nil
+	case len(chain) == 0:
+		provider := providerForModel(model)
+		client, err := sqirvy.NewClient(provider, clientOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("error: creating client for provider %s: %v", provider, err)
+		}
+		return client, nil
+	default:
+		var targets []sqirvy.Target
+		for _, m := range chain {
+			m = sqirvy.GetModelAlias(strings.TrimSpace(m))
+			targets = append(targets, sqirvy.Target{Provider: providerForModel(m), Model: m})
+		}
+		client, err := sqirvy.NewFallbackClient(targets, sqirvy.WithFallbackClientOptions(clientOptions...))
+		if err != nil {
+			return nil, fmt.Errorf("error: creating fallback chain: %v", err)
+		}
+		return client, nil
+	}
+}
+
+// providerForModel returns the provider that serves a model
+func providerForModel(model string) string {
+	// Determine the AI provider based on the selected model
+	provider, err := sqirvy.GetProviderName(model)
+	if err != nil {
+		// many of the models are not registered with this package
+		// use user model name and assume openai compatible provider
+		provider = "openai"
+	}
+
+	// anthropic and gemini models can be served through vertex ai instead of the provider api
+	if viper.GetString("backend") == sqirvy.Vertex && (provider == sqirvy.Anthropic || provider == sqirvy.Gemini) {
+		provider = sqirvy.Vertex
+	}
+	return provider
+}
+
+// rateLimitConfig is a rate limit in the config file
+type rateLimitConfig struct {
+	RequestsPerMinute int   `mapstructure:"requests-per-minute"`
+	TokensPerMinute   int64 `mapstructure:"tokens-per-minute"`
+}
+
+// rateLimiter returns a rate limiter for the rate-limits in the config file,
+// or nil if there are none. Keys are a provider or provider/model.
+// The limiter state is shared with other sqirvy-cli processes.
+func rateLimiter() (*sqirvy.RateLimiter, error) {
+	var limits map[string]rateLimitConfig
+	if err := viper.UnmarshalKey("rate-limits", &limits); err != nil {
+		return nil, fmt.Errorf("error: invalid rate-limits config: %v", err)
+	}
+	if len(limits) == 0 {
+		return nil, nil
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("error: finding cache directory: %v", err)
+	}
+	limiter := sqirvy.NewSharedRateLimiter(filepath.Join(dir, "sqirvy-cli", "ratelimit.json"))
+	for key, limit := range limits {
+		provider, model, _ := strings.Cut(key, "/")
+		limiter.SetLimit(provider, sqirvy.GetModelAlias(model), sqirvy.RateLimit{
+			RequestsPerMinute: limit.RequestsPerMinute,
+			TokensPerMinute:   limit.TokensPerMinute,
+		})
+	}
+	return limiter, nil
 }
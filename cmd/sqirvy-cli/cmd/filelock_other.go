@@ -0,0 +1,21 @@
+//go:build !unix
+
+package cmd
+
+import "os"
+
+// tryLockFile does nothing on platforms without advisory file locks;
+// sessions are then not protected against concurrent commands
+func tryLockFile(f *os.File) (bool, error) {
+	return true, nil
+}
+
+// lockFile does nothing on platforms without advisory file locks
+func lockFile(f *os.File) error {
+	return nil
+}
+
+// unlockFile releases the lock taken by lockFile or tryLockFile
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,143 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-llmclient"
+
+	"github.com/spf13/viper"
+)
+
+// ledgerRecord is one completed request in the usage ledger
+type ledgerRecord struct {
+	Time             time.Time `json:"time"`
+	Command          string    `json:"command"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	InputTokens      int64     `json:"input_tokens"`
+	OutputTokens     int64     `json:"output_tokens"`
+	CacheReadTokens  int64     `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens int64     `json:"cache_write_tokens,omitempty"`
+	Cost             float64   `json:"cost"`
+	DurationMS       int64     `json:"duration_ms"`
+	Cached           bool      `json:"cached,omitempty"` // answered from the response cache, no tokens or cost
+}
+
+// ledgerMu serializes the appends of concurrent requests, such as those of a batch
+var ledgerMu sync.Mutex
+
+// ledgerPath returns the path of the usage ledger: ledger-file in the config file,
+// or usage.jsonl in the sqirvy-cli config directory
+func ledgerPath() (string, error) {
+	if path := viper.GetString("ledger-file"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("finding home directory: %v", err)
+	}
+	return filepath.Join(home, ".config", "sqirvy-cli", "usage.jsonl"), nil
+}
+
+// ledgerEnabled reports whether completed requests are recorded in the usage ledger,
+// which is on unless ledger: false is set in the config file
+func ledgerEnabled() bool {
+	viper.SetDefault("ledger", true)
+	return viper.GetBool("ledger")
+}
+
+// ledgerMiddleware returns a middleware that appends each completed request of a
+// command to the usage ledger. Errors writing the ledger are reported to status and
+// do not fail the request.
+func ledgerMiddleware(command, path string, status io.Writer) sqirvy.Middleware {
+	return func(ctx context.Context, req sqirvy.Request, next sqirvy.Handler) (*sqirvy.Response, error) {
+		start := time.Now()
+		resp, err := next(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+		model := resp.Model
+		if model == "" {
+			model = req.Model
+		}
+		record := ledgerRecord{
+			Time:       start,
+			Command:    command,
+			Provider:   providerForModel(req.Model),
+			Model:      model,
+			DurationMS: time.Since(start).Milliseconds(),
+		}
+		if resp.Metadata[sqirvy.MetadataCache] != "" {
+			record.Cached = true
+		} else {
+			record.InputTokens = resp.Usage.InputTokens
+			record.OutputTokens = resp.Usage.OutputTokens
+			record.CacheReadTokens = resp.Usage.CacheReadTokens
+			record.CacheWriteTokens = resp.Usage.CacheWriteTokens
+			record.Cost = sqirvy.EstimateCost(req.Model, resp.Usage)
+		}
+		if err := appendLedger(path, record); err != nil {
+			fmt.Fprintf(status, "error writing usage ledger: %v\n", err)
+		}
+		return resp, nil
+	}
+}
+
+// appendLedger appends a record to the ledger file, creating it if needed
+func appendLedger(path string, record ledgerRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readLedger returns the records of the ledger file, or none if it does not exist.
+// Lines that cannot be decoded are skipped.
+func readLedger(path string) ([]ledgerRecord, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []ledgerRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record ledgerRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,38 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	sqirvy "github.com/dmh2000/sqirvy-llmclient"
+
+	"github.com/spf13/viper"
+)
+
+// loggerOptions returns the client options that log queries to w when --verbose
+// is set, in the format selected with --log-format
+func loggerOptions(w io.Writer) ([]sqirvy.ClientOption, error) {
+	if !viper.GetBool("verbose") {
+		return nil, nil
+	}
+	handlerOptions := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var handler slog.Handler
+	switch format := viper.GetString("log-format"); format {
+	case "", "text":
+		handler = slog.NewTextHandler(w, handlerOptions)
+	case "json":
+		handler = slog.NewJSONHandler(w, handlerOptions)
+	default:
+		return nil, fmt.Errorf("error: invalid log format %q, use text or json", format)
+	}
+
+	options := []sqirvy.ClientOption{sqirvy.WithLogger(slog.New(handler))}
+	if viper.GetBool("log-prompts") {
+		options = append(options, sqirvy.WithLogPrompts())
+	}
+	return options, nil
+}
@@ -33,7 +33,7 @@ The prompt is constructed in this order:
 		temperature := viper.GetFloat64("temperature")
 
 		// Execute the query using the specific planning prompt
-		response, err := executeQuery(model, temperature, planPrompt, args)
+		response, err := executeQuery("plan", sessionFlag(cmd), model, temperature, planPrompt, args)
 		if err != nil {
 			log.Fatalf("Error executing plan command: %v", err)
 		}
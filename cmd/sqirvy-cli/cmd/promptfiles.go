@@ -0,0 +1,219 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// promptNamePattern matches valid names of prompt file commands
+var promptNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// Output modes of prompt file commands
+const (
+	promptOutputText = "text" // print the reply
+	promptOutputCode = "code" // print only the contents of the fenced code blocks of the reply
+)
+
+// promptFile is a command defined by a Markdown prompt file. The YAML front matter
+// sets the fields, and the body of the file is the system prompt.
+type promptFile struct {
+	Name        string  `mapstructure:"name"`
+	Description string  `mapstructure:"description"`
+	Model       string  `mapstructure:"model"`
+	Temperature float64 `mapstructure:"temperature"`
+	Output      string  `mapstructure:"output"`
+
+	path   string
+	prompt string
+	// temperature is set in the front matter
+	hasTemperature bool
+}
+
+// promptDirs returns the directories of the prompt files, in increasing precedence:
+// the user directory, then the project directory
+func promptDirs() []string {
+	var dirs []string
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".config", "sqirvy-cli", "prompts"))
+	}
+	return append(dirs, filepath.Join(".sqirvy", "prompts"))
+}
+
+// readPromptFile reads a prompt file. The name of the command defaults to the
+// file name without the .md extension.
+func readPromptFile(path string) (*promptFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &promptFile{
+		Name:   strings.TrimSuffix(filepath.Base(path), ".md"),
+		Output: promptOutputText,
+		path:   path,
+	}
+
+	// the front matter is between --- lines at the start of the file
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	body := string(data)
+	if rest, ok := strings.CutPrefix(body, "---\n"); ok {
+		front, prompt, found := cutFrontMatter(rest)
+		if !found {
+			return nil, fmt.Errorf("front matter is not closed with ---")
+		}
+		v := viper.New()
+		v.SetConfigType("yaml")
+		if err := v.ReadConfig(strings.NewReader(front)); err != nil {
+			return nil, fmt.Errorf("invalid front matter: %v", err)
+		}
+		if err := v.Unmarshal(p); err != nil {
+			return nil, fmt.Errorf("invalid front matter: %v", err)
+		}
+		p.hasTemperature = v.IsSet("temperature")
+		body = prompt
+	}
+	p.prompt = strings.TrimSpace(body)
+
+	switch {
+	case !promptNamePattern.MatchString(p.Name):
+		return nil, fmt.Errorf("invalid command name %q, use lowercase letters, digits and '-'", p.Name)
+	case p.Output != promptOutputText && p.Output != promptOutputCode:
+		return nil, fmt.Errorf("invalid output %q, use %s or %s", p.Output, promptOutputText, promptOutputCode)
+	case p.hasTemperature && (p.Temperature < 0 || p.Temperature > 1):
+		return nil, fmt.Errorf("invalid temperature %v, use a value from 0.0 to 1.0", p.Temperature)
+	case p.prompt == "":
+		return nil, fmt.Errorf("the prompt is empty")
+	}
+	return p, nil
+}
+
+// cutFrontMatter splits the text after the opening --- line at the closing line,
+// which is exactly ---, into the front matter and the rest of the file
+func cutFrontMatter(text string) (front, rest string, found bool) {
+	start := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if strings.TrimSuffix(line, "\n") == "---" {
+			return text[:start], text[start+len(line):], true
+		}
+		start += len(line)
+	}
+	return "", "", false
+}
+
+// loadPromptFiles reads the prompt files of the directories. A command in a later
+// directory replaces a command with the same name in an earlier one. Invalid files
+// are reported to stderr and skipped.
+func loadPromptFiles(dirs []string) []*promptFile {
+	var files []*promptFile
+	index := map[string]int{}
+	for _, dir := range dirs {
+		paths, _ := filepath.Glob(filepath.Join(dir, "*.md"))
+		for _, path := range paths {
+			p, err := readPromptFile(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: skipping prompt file %s: %v\n", path, err)
+				continue
+			}
+			if i, ok := index[p.Name]; ok {
+				files[i] = p
+				continue
+			}
+			index[p.Name] = len(files)
+			files = append(files, p)
+		}
+	}
+	return files
+}
+
+// registerPromptCommands adds a command to the root command for each prompt file.
+// Prompt files cannot replace the built-in commands.
+func registerPromptCommands() {
+	for _, p := range loadPromptFiles(promptDirs()) {
+		// help and completion are added by cobra when the command runs
+		existing, _, err := rootCmd.Find([]string{p.Name})
+		if (err == nil && existing != rootCmd) || p.Name == "help" || p.Name == "completion" {
+			fmt.Fprintf(os.Stderr, "warning: skipping prompt file %s: %s is a built-in command\n", p.path, p.Name)
+			continue
+		}
+		rootCmd.AddCommand(p.command())
+	}
+}
+
+// command returns the command of a prompt file
+func (p *promptFile) command() *cobra.Command {
+	short := p.Description
+	if short == "" {
+		short = fmt.Sprintf("Run the prompt in %s", filepath.Base(p.path))
+	}
+	long := fmt.Sprintf(`%s
+
+sqirvy-cli %s sends the prompt defined in %s
+with input from stdin and any number of filename or url arguments.`, short, p.Name, p.path)
+	if p.Model != "" {
+		long += fmt.Sprintf("\nThe default model is %s.", p.Model)
+	}
+
+	cmd := &cobra.Command{
+		Use:   p.Name + " [files| urls]",
+		Short: short,
+		Long:  long + "\n",
+		Run: func(cmd *cobra.Command, args []string) {
+			// the front matter replaces the config defaults, but not the flags
+			model := viper.GetString("model")
+			if p.Model != "" && !rootCmd.PersistentFlags().Changed("model") {
+				model = p.Model
+			}
+			temperature := viper.GetFloat64("temperature")
+			if p.hasTemperature && !rootCmd.PersistentFlags().Changed("temperature") {
+				temperature = p.Temperature
+			}
+
+			response, err := executeQuery(p.Name, sessionFlag(cmd), model, temperature, p.prompt, args)
+			if err != nil {
+				log.Fatalf("Error executing %s command: %v", p.Name, err)
+			}
+			if p.Output == promptOutputCode {
+				response = codeBlocks(response)
+			}
+			fmt.Print(response)
+			fmt.Println() // Ensure a newline at the end
+		},
+	}
+	cmd.Flags().String("session", "", "Continue the conversation stored under this name and add this exchange to it")
+	return cmd
+}
+
+// codeBlocks returns the contents of the fenced code blocks of a reply, or the
+// reply if it has none
+func codeBlocks(reply string) string {
+	var blocks []string
+	var block []string
+	inBlock := false
+	for _, line := range strings.Split(reply, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			if inBlock {
+				blocks = append(blocks, strings.Join(block, "\n"))
+				block = nil
+			}
+			inBlock = !inBlock
+			continue
+		}
+		if inBlock {
+			block = append(block, line)
+		}
+	}
+	if len(blocks) == 0 {
+		return reply
+	}
+	return strings.Join(blocks, "\n\n")
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadPromptFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    promptFile
+		wantErr string
+	}{
+		{
+			name:    "No front matter",
+			file:    "explain.md",
+			content: "Explain the code.\n",
+			want:    promptFile{Name: "explain", Output: promptOutputText, prompt: "Explain the code."},
+		},
+		{
+			name:    "Front matter",
+			file:    "query.md",
+			content: "---\nname: sql\ndescription: Write a SQL query\nmodel: claude-sonnet-4\ntemperature: 0.2\noutput: code\n---\nWrite SQL.\n",
+			want: promptFile{Name: "sql", Description: "Write a SQL query", Model: "claude-sonnet-4", Temperature: 0.2,
+				Output: promptOutputCode, prompt: "Write SQL.", hasTemperature: true},
+		},
+		{
+			name:    "Windows line endings",
+			file:    "crlf.md",
+			content: "---\r\nmodel: gpt-5\r\n---\r\nBe brief.\r\n",
+			want:    promptFile{Name: "crlf", Model: "gpt-5", Output: promptOutputText, prompt: "Be brief."},
+		},
+		{
+			name:    "Empty front matter",
+			file:    "empty.md",
+			content: "---\n---\nBe brief.\n",
+			want:    promptFile{Name: "empty", Output: promptOutputText, prompt: "Be brief."},
+		},
+		{
+			name:    "Rules in the prompt",
+			file:    "rules.md",
+			content: "---\nmodel: gpt-5\n---\nBefore\n---\nAfter\n",
+			want:    promptFile{Name: "rules", Model: "gpt-5", Output: promptOutputText, prompt: "Before\n---\nAfter"},
+		},
+		{
+			name:    "Longer rule in the front matter is not the closing line",
+			file:    "rule.md",
+			content: "---\ndescription: |\n  first\n  ----\n  second\n---\nBe brief.\n",
+			want:    promptFile{Name: "rule", Description: "first\n----\nsecond\n", Output: promptOutputText, prompt: "Be brief."},
+		},
+		{
+			name:    "Longer rule is not the closing line",
+			file:    "dashes.md",
+			content: "---\nmodel: gpt-5\n----\n",
+			wantErr: "front matter is not closed",
+		},
+		{
+			name:    "Line starting with --- is not the closing line",
+			file:    "notes.md",
+			content: "---\nmodel: gpt-5\n--- notes\n",
+			wantErr: "front matter is not closed",
+		},
+		{
+			name:    "Unclosed front matter",
+			file:    "open.md",
+			content: "---\nmodel: gpt-5\nBe brief.\n",
+			wantErr: "front matter is not closed",
+		},
+		{
+			name:    "Invalid YAML",
+			file:    "yaml.md",
+			content: "---\nmodel: [gpt-5\n---\nBe brief.\n",
+			wantErr: "invalid front matter",
+		},
+		{
+			name:    "Invalid name",
+			file:    "Bad_Name.md",
+			content: "Be brief.\n",
+			wantErr: "invalid command name",
+		},
+		{
+			name:    "Invalid output",
+			file:    "output.md",
+			content: "---\noutput: json\n---\nBe brief.\n",
+			wantErr: "invalid output",
+		},
+		{
+			name:    "Invalid temperature",
+			file:    "temp.md",
+			content: "---\ntemperature: 1.5\n---\nBe brief.\n",
+			wantErr: "invalid temperature",
+		},
+		{
+			name:    "Empty prompt",
+			file:    "blank.md",
+			content: "---\nmodel: gpt-5\n---\n\n",
+			wantErr: "the prompt is empty",
+		},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatalf("failed to write prompt file: %v", err)
+			}
+			got, err := readPromptFile(path)
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("readPromptFile() error = nil, want error containing %q", tt.wantErr)
+				}
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("readPromptFile() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readPromptFile() error = %v", err)
+			}
+			tt.want.path = path
+			if *got != tt.want {
+				t.Errorf("readPromptFile() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCodeBlocks(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		want  string
+	}{
+		{
+			name:  "No code blocks",
+			reply: "Nothing to show.",
+			want:  "Nothing to show.",
+		},
+		{
+			name:  "One code block",
+			reply: "Here it is:\n```go\nfmt.Println(\"hi\")\n```\nDone.",
+			want:  "fmt.Println(\"hi\")",
+		},
+		{
+			name:  "Several code blocks",
+			reply: "```sql\nSELECT 1;\n```\nand\n```sql\nSELECT 2;\n```",
+			want:  "SELECT 1;\n\nSELECT 2;",
+		},
+		{
+			name:  "Indented fences",
+			reply: "1. Run:\n   ```sh\n   make\n   ```",
+			want:  "   make",
+		},
+		{
+			name:  "Unclosed code block",
+			reply: "Start:\n```go\npackage main",
+			want:  "Start:\n```go\npackage main",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := codeBlocks(tt.reply); got != tt.want {
+				t.Errorf("codeBlocks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -75,48 +75,22 @@ func readPrompt(args []string) ([]string, error) {
 
 	// Process each argument which can be either a URL or a file path
 	for _, arg := range args {
-		// Attempt to parse argument as URL
-		parsedURL, err := url.ParseRequestURI(arg)
-		if err == nil && (parsedURL.Scheme == "http" || parsedURL.Scheme == "https") {
-			// Basic URL format is valid, now check for potential SSRF
-			hostname := parsedURL.Hostname()
-			ips, err := net.LookupIP(hostname)
-			if err != nil {
-				return nil, fmt.Errorf("error: could not resolve hostname for URL %s: %w", arg, err)
-			}
-
-			for _, ip := range ips {
-				if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
-					return nil, fmt.Errorf("error: URL %s resolves to a non-public IP address %s, potential SSRF detected", arg, ip.String())
-				}
-			}
-
-			// Hostname resolves to public IPs, proceed with scraping
-			content, err := util.ScrapeURL(arg)
-			if err != nil {
-				return nil, fmt.Errorf("error: failed to scrape URL %s: %w", arg, err)
-			}
-			// Add markers around URL content
-			markedContent := fmt.Sprintf("--- START URL: %s ---\n%s\n--- END URL: %s ---", arg, content, arg)
-			prompts = append(prompts, markedContent)
-			length += int64(len(markedContent))
-			if length > MaxInputTotalBytes {
-				return nil, fmt.Errorf("error: total size would exceed limit of %d bytes (urls)", MaxInputTotalBytes)
-			}
-			continue
+		var content string
+		var err error
+		source := "files"
+		if isURL(arg) {
+			content, err = readURL(arg)
+			source = "urls"
+		} else {
+			content, err = readFile(arg)
 		}
-
-		// Handle file content if not a URL
-		fileData, _, err := util.ReadFile(arg, MaxInputTotalBytes)
 		if err != nil {
-			return nil, fmt.Errorf("error: failed to read file %s: %w", arg, err)
+			return nil, err
 		}
-		// Add markers around file content
-		markedFileData := fmt.Sprintf("--- START FILE: %s ---\n%s\n--- END FILE: %s ---", arg, string(fileData), arg)
-		prompts = append(prompts, markedFileData)
-		length += int64(len(markedFileData))
+		prompts = append(prompts, content)
+		length += int64(len(content))
 		if length > MaxInputTotalBytes {
-			return nil, fmt.Errorf("error: total size would exceed limit of %d bytes (files)", MaxInputTotalBytes)
+			return nil, fmt.Errorf("error: total size would exceed limit of %d bytes (%s)", MaxInputTotalBytes, source)
 		}
 	}
 
@@ -139,3 +113,48 @@ func readPrompt(args []string) ([]string, error) {
 
 	return prompts, nil
 }
+
+// isURL reports whether an argument is an http or https URL
+func isURL(arg string) bool {
+	parsedURL, err := url.ParseRequestURI(arg)
+	return err == nil && (parsedURL.Scheme == "http" || parsedURL.Scheme == "https")
+}
+
+// readURL scrapes the content of a public URL and returns it between markers
+func readURL(arg string) (string, error) {
+	parsedURL, err := url.ParseRequestURI(arg)
+	if err != nil {
+		return "", fmt.Errorf("error: invalid URL %s: %w", arg, err)
+	}
+
+	// Basic URL format is valid, now check for potential SSRF
+	hostname := parsedURL.Hostname()
+	ips, err := net.LookupIP(hostname)
+	if err != nil {
+		return "", fmt.Errorf("error: could not resolve hostname for URL %s: %w", arg, err)
+	}
+
+	for _, ip := range ips {
+		if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+			return "", fmt.Errorf("error: URL %s resolves to a non-public IP address %s, potential SSRF detected", arg, ip.String())
+		}
+	}
+
+	// Hostname resolves to public IPs, proceed with scraping
+	content, err := util.ScrapeURL(arg)
+	if err != nil {
+		return "", fmt.Errorf("error: failed to scrape URL %s: %w", arg, err)
+	}
+	// Add markers around URL content
+	return fmt.Sprintf("--- START URL: %s ---\n%s\n--- END URL: %s ---", arg, content, arg), nil
+}
+
+// readFile reads a local file and returns its content between markers
+func readFile(arg string) (string, error) {
+	fileData, _, err := util.ReadFile(arg, MaxInputTotalBytes)
+	if err != nil {
+		return "", fmt.Errorf("error: failed to read file %s: %w", arg, err)
+	}
+	// Add markers around file content
+	return fmt.Sprintf("--- START FILE: %s ---\n%s\n--- END FILE: %s ---", arg, string(fileData), arg), nil
+}
@@ -29,7 +29,7 @@ in the order specified.
 		temperature := viper.GetFloat64("temperature")
 
 		// Execute the query using the generic query prompt
-		response, err := executeQuery(model, temperature, queryPrompt, args)
+		response, err := executeQuery("query", sessionFlag(cmd), model, temperature, queryPrompt, args)
 		if err != nil {
 			log.Fatalf("Error executing query command: %v", err)
 		}
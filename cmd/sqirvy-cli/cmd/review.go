@@ -32,7 +32,7 @@ The prompt is constructed in this order:
 		temperature := viper.GetFloat64("temperature")
 
 		// Execute the query using the specific code review prompt
-		response, err := executeQuery(model, temperature, reviewPrompt, args)
+		response, err := executeQuery("review", sessionFlag(cmd), model, temperature, reviewPrompt, args)
 		if err != nil {
 			log.Fatalf("Error executing review command: %v", err)
 		}
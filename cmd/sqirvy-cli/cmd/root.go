@@ -6,6 +6,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -30,6 +31,10 @@ var rootCmd = &cobra.Command{
    - The "plan" command is used to send a prompt to the LLM and receive a plan in response.
    - The "code" command is used to send a prompt to the LLM and receive source code in response.
    - The "review" command is used to send a prompt to the LLM and receive a code review in response.
+   - The "chat" command starts an interactive conversation with the LLM.
+   - The "tui" command runs the conversation in a full-screen terminal UI.
+   - Markdown prompt files in ~/.config/sqirvy-cli/prompts or .sqirvy/prompts add custom commands.
+   - The --session flag continues a conversation stored on disk across commands.
    - Sqirvy-cli is designed to support terminal command pipelines. 
 	`,
 	// Run defines the behavior when the root command is executed without subcommands.
@@ -50,7 +55,9 @@ var rootCmd = &cobra.Command{
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// The commands of the prompt files are added first.
 func Execute() {
+	registerPromptCommands()
 	err := rootCmd.Execute()
 	if err != nil {
 		os.Exit(1)
@@ -73,13 +80,82 @@ func init() {
 		os.Exit(1)
 	}
 
-	rootCmd.PersistentFlags().StringP("model", "m", defaultModel, "LLM model to use (e.g., gpt-4o, claude-sonnet-4)")
+	rootCmd.PersistentFlags().StringP("model", "m", defaultModel, "LLM model to use (e.g., gpt-4o, claude-sonnet-4), a comma separated fallback chain, or auto")
 	err = viper.BindPFlag("model", rootCmd.PersistentFlags().Lookup("model")) // Bind flag to Viper config
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "ERROR: invalid flag: \nError binding flag to config: %v\n", err)
 		os.Exit(1)
 	}
 
+	rootCmd.PersistentFlags().String("backend", "", "Backend serving anthropic and gemini models (\"vertex\" for Google Cloud Vertex AI)")
+	err = viper.BindPFlag("backend", rootCmd.PersistentFlags().Lookup("backend")) // Bind flag to Viper config
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: invalid flag: \nError binding flag to config: %v\n", err)
+		os.Exit(1)
+	}
+
+	rootCmd.PersistentFlags().String("cassette", "", "Record/replay provider http exchanges to this cassette file (env SQIRVY_CASSETTE)")
+	err = viper.BindPFlag("cassette", rootCmd.PersistentFlags().Lookup("cassette")) // Bind flag to Viper config
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: invalid flag: \nError binding flag to config: %v\n", err)
+		os.Exit(1)
+	}
+	rootCmd.PersistentFlags().String("cassette-mode", "auto", "Cassette mode: record, replay or auto (env SQIRVY_CASSETTE_MODE)")
+	err = viper.BindPFlag("cassette-mode", rootCmd.PersistentFlags().Lookup("cassette-mode")) // Bind flag to Viper config
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: invalid flag: \nError binding flag to config: %v\n", err)
+		os.Exit(1)
+	}
+	_ = viper.BindEnv("cassette", "SQIRVY_CASSETTE")
+	_ = viper.BindEnv("cassette-mode", "SQIRVY_CASSETTE_MODE")
+
+	rootCmd.PersistentFlags().String("difficulty", "normal", "Difficulty hint for --model auto: normal or hard")
+	err = viper.BindPFlag("difficulty", rootCmd.PersistentFlags().Lookup("difficulty")) // Bind flag to Viper config
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: invalid flag: \nError binding flag to config: %v\n", err)
+		os.Exit(1)
+	}
+
+	rootCmd.PersistentFlags().Bool("cache", false, "Answer repeated identical requests from the response cache")
+	err = viper.BindPFlag("cache", rootCmd.PersistentFlags().Lookup("cache")) // Bind flag to Viper config
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: invalid flag: \nError binding flag to config: %v\n", err)
+		os.Exit(1)
+	}
+	rootCmd.PersistentFlags().Bool("no-cache", false, "Do not use the response cache, even if enabled in the config file")
+	err = viper.BindPFlag("no-cache", rootCmd.PersistentFlags().Lookup("no-cache")) // Bind flag to Viper config
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: invalid flag: \nError binding flag to config: %v\n", err)
+		os.Exit(1)
+	}
+	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Log request and response metadata to stderr")
+	err = viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose")) // Bind flag to Viper config
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: invalid flag: \nError binding flag to config: %v\n", err)
+		os.Exit(1)
+	}
+	rootCmd.PersistentFlags().String("log-format", "text", "Format of the --verbose log: text or json")
+	err = viper.BindPFlag("log-format", rootCmd.PersistentFlags().Lookup("log-format")) // Bind flag to Viper config
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: invalid flag: \nError binding flag to config: %v\n", err)
+		os.Exit(1)
+	}
+	rootCmd.PersistentFlags().Bool("log-prompts", false, "Include prompts and responses in the --verbose log instead of redacting them")
+	err = viper.BindPFlag("log-prompts", rootCmd.PersistentFlags().Lookup("log-prompts")) // Bind flag to Viper config
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: invalid flag: \nError binding flag to config: %v\n", err)
+		os.Exit(1)
+	}
+	rootCmd.PersistentFlags().Bool("prompt-cache", false, "Mark the system prompt and inputs as cacheable by the provider")
+	err = viper.BindPFlag("prompt-cache", rootCmd.PersistentFlags().Lookup("prompt-cache")) // Bind flag to Viper config
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: invalid flag: \nError binding flag to config: %v\n", err)
+		os.Exit(1)
+	}
+
+	// --force is read only from the command line, never from the config or environment
+	rootCmd.PersistentFlags().Bool("force", false, "Send requests that would exceed the spend budget in the config file")
+
 	rootCmd.PersistentFlags().Float32P("temperature", "t", defaultTemperature, "LLM temperature (randomness) to use (0.0 to 1.0)")
 	err = viper.BindPFlag("temperature", rootCmd.PersistentFlags().Lookup("temperature")) // Bind flag to Viper config
 	if err != nil {
@@ -108,7 +184,14 @@ func initConfig() {
 		viper.SetConfigName("config")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	// read in environment variables that match, with the SQIRVY_ prefix, e.g.
+	// SQIRVY_NO_CACHE for no-cache, so that unrelated variables such as CACHE or
+	// VERBOSE do not change the settings. MODEL and TEMPERATURE are still read.
+	viper.SetEnvPrefix("SQIRVY")
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_", ".", "_"))
+	viper.AutomaticEnv()
+	_ = viper.BindEnv("model", "SQIRVY_MODEL", "MODEL")
+	_ = viper.BindEnv("temperature", "SQIRVY_TEMPERATURE", "TEMPERATURE")
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
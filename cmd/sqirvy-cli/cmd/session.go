@@ -0,0 +1,384 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-llmclient"
+
+	"github.com/spf13/cobra"
+)
+
+// sessionNamePattern matches valid session names, which are used as file names
+var sessionNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// session is a conversation stored on disk by --session
+type session struct {
+	Name     string           `json:"name"`
+	Model    string           `json:"model"`
+	System   string           `json:"system"`
+	Messages []sqirvy.Message `json:"messages"`
+	Created  time.Time        `json:"created"`
+	Updated  time.Time        `json:"updated"`
+}
+
+// sessionsCmd represents the command family that manages the stored sessions.
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "List, show, remove or export the sessions used with --session",
+	Long: `sqirvy-cli sessions manages the conversations stored with --session NAME. A query, plan,
+code or review run with --session sends the earlier inputs and replies of the session
+with its prompt and adds the new ones, so the next run with the same name continues
+the thread. The session keeps its model unless --model is given. When the session
+outgrows the context window of the model, its oldest exchanges are removed. Commands
+using the same session run one at a time. Sessions are stored in
+~/.config/sqirvy-cli/sessions.
+`,
+}
+
+// sessionsListCmd lists the stored sessions.
+var sessionsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the sessions",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		sessions, err := listSessions()
+		if err != nil {
+			log.Fatalf("Error listing sessions: %v", err)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tMODEL\tMESSAGES\tUPDATED")
+		for _, s := range sessions {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", s.Name, s.Model, len(s.Messages), s.Updated.Local().Format(time.DateTime))
+		}
+		_ = tw.Flush()
+	},
+}
+
+// sessionsShowCmd prints a session.
+var sessionsShowCmd = &cobra.Command{
+	Use:   "show NAME",
+	Short: "Show the messages of a session",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s, err := loadSession(args[0])
+		if err != nil {
+			log.Fatalf("Error reading session: %v", err)
+		}
+		if s == nil {
+			log.Fatalf("Error reading session: session %s not found", args[0])
+		}
+		fmt.Printf("Session     : %s\n", s.Name)
+		fmt.Printf("Model       : %s\n", s.Model)
+		fmt.Printf("Created     : %s\n", s.Created.Local().Format(time.DateTime))
+		fmt.Printf("Updated     : %s\n", s.Updated.Local().Format(time.DateTime))
+		for _, m := range s.Messages {
+			fmt.Printf("\n--- %s ---\n%s\n", m.Role, strings.TrimSpace(m.Text))
+		}
+	},
+}
+
+// sessionsRmCmd removes sessions.
+var sessionsRmCmd = &cobra.Command{
+	Use:   "rm NAME...",
+	Short: "Remove sessions",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, name := range args {
+			if err := removeSession(name); err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					log.Fatalf("Error removing session: session %s not found", name)
+				}
+				log.Fatalf("Error removing session: %v", err)
+			}
+			fmt.Fprintln(os.Stderr, "Removed     :", name)
+		}
+	},
+}
+
+// sessionsExportCmd writes a session as Markdown.
+var sessionsExportCmd = &cobra.Command{
+	Use:   "export NAME",
+	Short: "Export a session as Markdown",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s, err := loadSession(args[0])
+		if err != nil {
+			log.Fatalf("Error reading session: %v", err)
+		}
+		if s == nil {
+			log.Fatalf("Error reading session: session %s not found", args[0])
+		}
+		markdown := chatMarkdown("Session "+s.Name, s.Model, s.System, s.Messages)
+		output, _ := cmd.Flags().GetString("output")
+		if output == "" {
+			fmt.Print(markdown)
+			return
+		}
+		if err := os.WriteFile(output, []byte(markdown), 0o644); err != nil {
+			log.Fatalf("Error exporting session: %v", err)
+		}
+	},
+}
+
+// sessionDir returns the directory of the stored sessions
+func sessionDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("finding home directory: %v", err)
+	}
+	return filepath.Join(home, ".config", "sqirvy-cli", "sessions"), nil
+}
+
+// sessionPath returns the file of a session, checking that the name is valid
+func sessionPath(name string) (string, error) {
+	if !sessionNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid session name %q, use letters, digits, '.', '_' and '-'", name)
+	}
+	dir, err := sessionDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// loadSession reads a session, returning nil if it does not exist
+func loadSession(name string) (*session, error) {
+	path, err := sessionPath(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid session file %s: %v", path, err)
+	}
+	return &s, nil
+}
+
+// saveSession writes a session, replacing the file atomically
+func saveSession(s *session) error {
+	path, err := sessionPath(s.Name)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), s.Name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// removeSession removes a session and its lock file, waiting while another command uses it
+func removeSession(name string) error {
+	path, err := sessionPath(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	unlock, err := lockSession(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	return os.Remove(path + ".lock")
+}
+
+// openSession reads a session, or starts a new one if it does not exist
+func openSession(name string) (*session, error) {
+	s, err := loadSession(name)
+	if err != nil || s != nil {
+		return s, err
+	}
+	now := time.Now()
+	return &session{Name: name, Created: now, Updated: now}, nil
+}
+
+// lockSession locks a session against other commands until the returned function
+// is called, waiting while another command holds the lock. The lock is an advisory
+// lock on a file next to the session, which the OS releases if the command is killed.
+func lockSession(name string) (func(), error) {
+	path, err := sessionPath(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := tryLockFile(f)
+	if err == nil && !locked {
+		fmt.Fprintf(os.Stderr, "Waiting for session %s, in use by another command\n", name)
+		err = lockFile(f)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		_ = unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// sessionInputLimit returns the input tokens that fit the context window of a model
+// with room for its reply, the smallest of a fallback chain, or 0 if it is unknown
+func sessionInputLimit(model string) int64 {
+	models := modelChain(model)
+	if len(models) == 0 {
+		models = []string{model}
+	}
+	var limit int64
+	for _, m := range models {
+		m = sqirvy.GetModelAlias(strings.TrimSpace(m))
+		info, err := sqirvy.GetModelInfo(m)
+		if err != nil || info.ContextWindow == 0 {
+			// auto and unknown models are not limited
+			return 0
+		}
+		if l := info.ContextWindow - sqirvy.GetMaxTokens(m); limit == 0 || l < limit {
+			limit = l
+		}
+	}
+	return limit
+}
+
+// trim removes the oldest exchanges of the session until they fit the context window
+// of the model with the system prompt and prompts of the next exchange. It returns
+// the number of messages removed.
+func (s *session) trim(model, system string, prompts []string) (int, error) {
+	messages, removed, err := trimHistory(model, system, prompts, s.Messages)
+	if err != nil {
+		return 0, err
+	}
+	s.Messages = messages
+	return removed, nil
+}
+
+// trimHistory removes the oldest exchanges of a conversation history until they fit
+// the context window of the model with the system prompt and prompts of the next
+// exchange. It returns the remaining history and the number of messages removed, and
+// an error if the next exchange does not fit even without the earlier ones.
+func trimHistory(model, system string, prompts []string, history []sqirvy.Message) ([]sqirvy.Message, int, error) {
+	limit := sessionInputLimit(model)
+	if limit <= 0 {
+		return history, 0, nil
+	}
+	tokens := sqirvy.EstimateTokens(system)
+	for _, prompt := range prompts {
+		tokens += sqirvy.EstimateTokens(prompt)
+	}
+	if tokens > limit {
+		return nil, 0, fmt.Errorf("the prompt of about %d tokens does not fit the context window of %s, which leaves %d tokens for input", tokens, model, limit)
+	}
+	for _, m := range history {
+		tokens += sqirvy.EstimateTokens(m.Text)
+	}
+
+	// exchanges are removed in pairs so that the history starts with a user message
+	removed := 0
+	for tokens > limit && removed+2 <= len(history) {
+		tokens -= sqirvy.EstimateTokens(history[removed].Text) + sqirvy.EstimateTokens(history[removed+1].Text)
+		removed += 2
+	}
+	return history[removed:], removed, nil
+}
+
+// add adds an exchange to the session
+func (s *session) add(model, system string, prompts []string, reply string) {
+	s.Model = model
+	s.System = system
+	s.Messages = append(s.Messages,
+		sqirvy.Message{Role: sqirvy.RoleUser, Text: strings.Join(prompts, "\n\n")},
+		sqirvy.Message{Role: sqirvy.RoleAssistant, Text: reply},
+	)
+	s.Updated = time.Now()
+}
+
+// listSessions returns the stored sessions, most recently updated first
+func listSessions() ([]*session, error) {
+	dir, err := sessionDir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var sessions []*session
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		if !sessionNamePattern.MatchString(name) {
+			continue
+		}
+		s, err := loadSession(name)
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Updated.After(sessions[j].Updated)
+	})
+	return sessions, nil
+}
+
+// sessionFlag returns the --session flag of a command
+func sessionFlag(cmd *cobra.Command) string {
+	name, _ := cmd.Flags().GetString("session")
+	return name
+}
+
+// init registers the --session flag of the query commands and the sessions command family.
+func init() {
+	for _, cmd := range []*cobra.Command{queryCmd, planCmd, codeCmd, reviewCmd} {
+		cmd.Flags().String("session", "", "Continue the conversation stored under this name and add this exchange to it")
+	}
+	sessionsExportCmd.Flags().StringP("output", "o", "", "Write the Markdown to this file instead of stdout")
+	sessionsCmd.AddCommand(sessionsListCmd, sessionsShowCmd, sessionsRmCmd, sessionsExportCmd)
+	rootCmd.AddCommand(sessionsCmd)
+}
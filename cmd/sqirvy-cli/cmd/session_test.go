@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	sqirvy "github.com/dmh2000/sqirvy-llmclient"
+)
+
+func TestTrimHistory(t *testing.T) {
+	// claude-sonnet-4 leaves 200000 - 64000 = 136000 tokens for input
+	model := "claude-sonnet-4-20250514"
+	text := func(tokens int) string { return strings.Repeat("x", 4*tokens) }
+	history := []sqirvy.Message{
+		{Role: sqirvy.RoleUser, Text: text(30000)},
+		{Role: sqirvy.RoleAssistant, Text: text(10000)},
+		{Role: sqirvy.RoleUser, Text: text(30000)},
+		{Role: sqirvy.RoleAssistant, Text: text(10000)},
+	}
+
+	tests := []struct {
+		name        string
+		model       string
+		prompt      string
+		wantRemoved int
+		wantErr     bool
+	}{
+		{name: "Fits", model: model, prompt: text(50000), wantRemoved: 0},
+		{name: "Oldest exchange removed", model: model, prompt: text(80000), wantRemoved: 2},
+		{name: "All exchanges removed", model: model, prompt: text(120000), wantRemoved: 4},
+		{name: "Prompt does not fit", model: model, prompt: text(140000), wantErr: true},
+		{name: "Unknown model", model: "no-such-model", prompt: text(140000), wantRemoved: 0},
+		{name: "Auto", model: autoModel, prompt: text(140000), wantRemoved: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, removed, err := trimHistory(tt.model, "", []string{tt.prompt}, history)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("trimHistory() error = nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("trimHistory() error = %v", err)
+			}
+			if removed != tt.wantRemoved || len(got) != len(history)-tt.wantRemoved {
+				t.Errorf("trimHistory() removed %d and kept %d messages, want %d removed", removed, len(got), tt.wantRemoved)
+			}
+			if len(got) > 0 && got[0].Role != sqirvy.RoleUser {
+				t.Errorf("trimHistory() history starts with %s, want user", got[0].Role)
+			}
+		})
+	}
+}
@@ -0,0 +1,601 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	sqirvy "github.com/dmh2000/sqirvy-llmclient"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+// tuiKeys lists the keys of the tui command
+const tuiKeys = `Keys:
+  enter            send the message
+  alt+enter        insert a newline (also ctrl+j)
+  ctrl+o           pick the model
+  pgup/pgdown      scroll the conversation (also the mouse wheel)
+  esc              interrupt a reply or close the model picker
+  ctrl+c           quit`
+
+// tuiCmd represents the full-screen terminal UI command.
+var tuiCmd = &cobra.Command{
+	Use:   "tui [files| urls]",
+	Short: "Chat with the LLM in a full-screen terminal UI",
+	Long: `sqirvy-cli tui starts an interactive conversation in a full-screen terminal UI, with
+a scrolling conversation pane, a multi-line input editor and a side panel showing the
+model, the attached files and the tokens and cost of the conversation. Replies are
+rendered as Markdown with syntax-highlighted code blocks. Files and URLs given as
+arguments are attached to the first message, and the slash commands of the chat
+command work in the input editor.
+
+` + tuiKeys + `
+
+` + chatHelp + `
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runTUI(args); err != nil {
+			log.Fatalf("Error running tui: %v", err)
+		}
+	},
+}
+
+// Layout of the terminal UI
+const (
+	tuiSideWidth   = 32 // width of the side panel, with its border
+	tuiInputHeight = 4  // lines of the input editor
+)
+
+// tuiNotice is the role of status and error messages in the conversation pane
+const tuiNotice = "notice"
+
+// Styles of the terminal UI
+var (
+	tuiPaneStyle   = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("240"))
+	tuiFocusStyle  = tuiPaneStyle.BorderForeground(lipgloss.Color("63"))
+	tuiTitleStyle  = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("63"))
+	tuiUserStyle   = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("39"))
+	tuiNoticeStyle = lipgloss.NewStyle().Faint(true)
+	tuiHelpStyle   = lipgloss.NewStyle().Faint(true)
+)
+
+// tuiEntry is a message shown in the conversation pane
+type tuiEntry struct {
+	role     string // sqirvy.RoleUser, sqirvy.RoleAssistant or tuiNotice
+	text     string
+	rendered string // text rendered for the pane width, empty until rendered
+}
+
+// tuiChunkMsg is a chunk of a streamed reply
+type tuiChunkMsg string
+
+// tuiReplyMsg is the end of a reply
+type tuiReplyMsg struct {
+	req      sqirvy.Request
+	response *sqirvy.Response
+	err      error
+}
+
+// tuiAttachMsg is the contents of the files and urls of a /file or /url command
+type tuiAttachMsg struct {
+	sources  []string
+	contents []string
+	err      error
+}
+
+// tuiStatus collects the status messages of the session, which are also written by
+// the client options of a reply in progress, such as budget warnings and the
+// --verbose log. It is safe for concurrent use.
+type tuiStatus struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *tuiStatus) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(p)
+}
+
+// take returns and clears the messages
+func (s *tuiStatus) take() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	text := s.buf.String()
+	s.buf.Reset()
+	return text
+}
+
+// tuiModelItem is a model in the model picker
+type tuiModelItem struct {
+	model    string
+	provider string
+}
+
+func (i tuiModelItem) Title() string       { return i.model }
+func (i tuiModelItem) Description() string { return i.provider }
+func (i tuiModelItem) FilterValue() string { return i.model }
+
+// tuiModel is the state of the terminal UI
+type tuiModel struct {
+	session *chatSession
+	status  *tuiStatus // status messages of the session
+
+	conversation viewport.Model
+	input        textarea.Model
+	picker       list.Model
+	picking      bool
+	renderer     *glamour.TermRenderer
+	style        string // glamour style, chosen before the UI starts
+	width        int
+	height       int
+
+	entries []tuiEntry
+	sent    []string // files and urls sent with earlier messages
+
+	// attachments being read
+	attaching bool
+
+	// reply in progress
+	streaming bool
+	reply     strings.Builder
+	events    chan tea.Msg
+	cancel    context.CancelFunc
+
+	// usage of the conversation
+	usage sqirvy.Usage
+	cost  float64
+}
+
+// runTUI runs the terminal UI until the user quits
+func runTUI(args []string) error {
+	// the status messages are shown in the conversation pane, since output to
+	// stderr would corrupt the screen
+	status := &tuiStatus{}
+	session, done, err := newChatSession("tui", io.Discard, status)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	m := newTUIModel(session, status)
+	if err := session.attach(args); err != nil {
+		return err
+	}
+	m.notice()
+
+	_, err = tea.NewProgram(m, tea.WithAltScreen(), tea.WithMouseCellMotion()).Run()
+	if m.cancel != nil {
+		m.cancel()
+	}
+	return err
+}
+
+// newTUIModel returns the terminal UI of a session
+func newTUIModel(session *chatSession, status *tuiStatus) *tuiModel {
+	input := textarea.New()
+	input.Placeholder = "Type a message, /help for commands"
+	input.ShowLineNumbers = false
+	input.CharLimit = 0
+	input.SetHeight(tuiInputHeight)
+	input.KeyMap.InsertNewline = key.NewBinding(key.WithKeys("alt+enter", "ctrl+j"))
+	input.Focus()
+
+	var items []list.Item
+	for _, mp := range sqirvy.GetModelProviderList() {
+		items = append(items, tuiModelItem{model: mp.Model, provider: mp.Provider})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].FilterValue() < items[j].FilterValue()
+	})
+	picker := list.New(items, list.NewDefaultDelegate(), 0, 0)
+	picker.Title = "Select a model"
+
+	// the terminal background is detected before the UI takes over the terminal
+	style := "light"
+	if lipgloss.HasDarkBackground() {
+		style = "dark"
+	}
+
+	return &tuiModel{
+		session:      session,
+		status:       status,
+		conversation: viewport.New(0, 0),
+		input:        input,
+		picker:       picker,
+		style:        style,
+	}
+}
+
+// Init implements tea.Model.
+func (m *tuiModel) Init() tea.Cmd {
+	return textarea.Blink
+}
+
+// Update implements tea.Model.
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.resize(msg.Width, msg.Height)
+		return m, nil
+
+	case tuiChunkMsg:
+		m.reply.WriteString(string(msg))
+		m.entries[len(m.entries)-1].text = m.reply.String()
+		m.entries[len(m.entries)-1].rendered = ""
+		m.refresh()
+		return m, m.wait()
+
+	case tuiReplyMsg:
+		m.finish(msg)
+		return m, nil
+
+	case tuiAttachMsg:
+		m.attaching = false
+		err := msg.err
+		if err == nil {
+			err = m.session.addAttachments(msg.sources, msg.contents)
+		}
+		if err != nil {
+			fmt.Fprintf(m.status, "error: %v\n", err)
+		}
+		m.notice()
+		return m, nil
+
+	case tea.MouseMsg:
+		var cmd tea.Cmd
+		m.conversation, cmd = m.conversation.Update(msg)
+		return m, cmd
+
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			if m.cancel != nil {
+				m.cancel()
+			}
+			return m, tea.Quit
+		}
+		if m.picking {
+			return m.updatePicker(msg)
+		}
+		switch msg.String() {
+		case "esc":
+			if m.streaming {
+				m.cancel()
+			}
+			return m, nil
+		case "ctrl+o":
+			if !m.streaming {
+				m.picking = true
+			}
+			return m, nil
+		case "pgup", "pgdown":
+			var cmd tea.Cmd
+			m.conversation, cmd = m.conversation.Update(msg)
+			return m, cmd
+		case "enter":
+			return m.submit()
+		}
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// updatePicker handles the keys of the model picker
+func (m *tuiModel) updatePicker(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.picker.FilterState() != list.Filtering {
+		switch msg.String() {
+		case "esc":
+			m.picking = false
+			return m, nil
+		case "enter":
+			m.picking = false
+			if item, ok := m.picker.SelectedItem().(tuiModelItem); ok {
+				if err := m.session.setModel(item.model); err != nil {
+					fmt.Fprintf(m.status, "error: %v\n", err)
+				}
+				m.notice()
+			}
+			return m, nil
+		}
+	}
+	var cmd tea.Cmd
+	m.picker, cmd = m.picker.Update(msg)
+	return m, cmd
+}
+
+// submit runs the slash command in the input editor or sends its message
+func (m *tuiModel) submit() (tea.Model, tea.Cmd) {
+	line := strings.TrimSpace(m.input.Value())
+	if line == "" || m.streaming || m.attaching {
+		return m, nil
+	}
+	m.input.Reset()
+
+	// files and urls are read in the background, so that a slow url does not
+	// freeze the UI
+	if command, arg, _ := strings.Cut(line, " "); command == "/file" || command == "/url" {
+		sources, err := attachSources(command, strings.TrimSpace(arg))
+		if err != nil {
+			fmt.Fprintf(m.status, "error: %v\n", err)
+			m.notice()
+			return m, nil
+		}
+		m.attaching = true
+		fmt.Fprintf(m.status, "Reading     : %s\n", strings.Join(sources, ", "))
+		m.notice()
+		return m, func() tea.Msg {
+			contents, err := readSources(sources)
+			return tuiAttachMsg{sources: sources, contents: contents, err: err}
+		}
+	}
+
+	if strings.HasPrefix(line, "/") {
+		quit, err := m.session.handle(line)
+		if err != nil {
+			fmt.Fprintf(m.status, "error: %v\n", err)
+		}
+		if quit {
+			return m, tea.Quit
+		}
+		if line == "/reset" {
+			m.entries, m.sent = nil, nil
+			m.usage, m.cost = sqirvy.Usage{}, 0
+		}
+		m.notice()
+		return m, nil
+	}
+
+	req, err := m.session.request(line)
+	if err != nil {
+		// the message stays in the editor so that it can be shortened
+		m.input.SetValue(line)
+		fmt.Fprintf(m.status, "error: %v\n", err)
+		m.notice()
+		return m, nil
+	}
+	// a trimmed history is reported before the message
+	m.notice()
+	text := line
+	if len(m.session.sources) > 0 {
+		text = fmt.Sprintf("%s\n\n(with %s)", line, strings.Join(m.session.sources, ", "))
+	}
+	m.entries = append(m.entries,
+		tuiEntry{role: sqirvy.RoleUser, text: text},
+		tuiEntry{role: sqirvy.RoleAssistant},
+	)
+	m.reply.Reset()
+	m.streaming = true
+	m.refresh()
+
+	// the query runs in the background and sends the chunks and the end of the
+	// reply to events, which are read one at a time by wait
+	ctx, cancel := context.WithCancel(queryContext(context.Background()))
+	events := make(chan tea.Msg, 64)
+	m.events, m.cancel = events, cancel
+	client := m.session.client
+	if m.session.streams() {
+		req.Options.StreamFunc = func(ctx context.Context, chunk []byte) error {
+			select {
+			case events <- tuiChunkMsg(chunk):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	go func() {
+		response, err := sqirvy.Query(ctx, client, req)
+		if ctx.Err() != nil {
+			err = fmt.Errorf("reply interrupted")
+		}
+		events <- tuiReplyMsg{req: req, response: response, err: err}
+	}()
+	return m, m.wait()
+}
+
+// wait returns a command that reads the next event of the reply in progress
+func (m *tuiModel) wait() tea.Cmd {
+	events := m.events
+	return func() tea.Msg {
+		return <-events
+	}
+}
+
+// finish ends the reply in progress, adding it to the conversation if it succeeded
+func (m *tuiModel) finish(msg tuiReplyMsg) {
+	m.streaming = false
+	m.cancel()
+	m.cancel = nil
+
+	if msg.err != nil {
+		// a partial reply stays on screen but is not part of the conversation
+		if m.reply.Len() == 0 {
+			m.entries = m.entries[:len(m.entries)-1]
+		}
+		if errors.Is(msg.err, sqirvy.ErrBudgetExceeded) {
+			msg.err = fmt.Errorf("%v (use --force to send it anyway)", msg.err)
+		}
+		fmt.Fprintf(m.status, "error: %v\n", msg.err)
+		m.notice()
+		return
+	}
+
+	// replies that are not streamed arrive in one piece
+	last := &m.entries[len(m.entries)-1]
+	last.text, last.rendered = msg.response.Text, ""
+	m.sent = append(m.sent, m.session.sources...)
+	m.session.commit(msg.req, msg.response.Text)
+
+	m.usage.InputTokens += msg.response.Usage.InputTokens
+	m.usage.OutputTokens += msg.response.Usage.OutputTokens
+	m.usage.CacheReadTokens += msg.response.Usage.CacheReadTokens
+	m.usage.CacheWriteTokens += msg.response.Usage.CacheWriteTokens
+	if msg.response.Metadata[sqirvy.MetadataCache] == "" {
+		model := msg.response.Model
+		if model == "" {
+			model = msg.req.Model
+		}
+		m.cost += sqirvy.EstimateCost(model, msg.response.Usage)
+	}
+	m.refresh()
+	// budget warnings and the --verbose log of the reply
+	m.notice()
+}
+
+// notice moves the status messages of the session to the conversation pane
+func (m *tuiModel) notice() {
+	text := strings.TrimSpace(m.status.take())
+	if text == "" {
+		return
+	}
+	m.entries = append(m.entries, tuiEntry{role: tuiNotice, text: text})
+	m.refresh()
+}
+
+// resize lays out the panes for the terminal size
+func (m *tuiModel) resize(width, height int) {
+	m.width, m.height = width, height
+	paneWidth := max(width-tuiSideWidth-2, 10)
+	m.conversation.Width = paneWidth
+	m.conversation.Height = max(height-tuiInputHeight-5, 1)
+	m.input.SetWidth(width - 2)
+	m.picker.SetSize(width-2, height-2)
+
+	renderer, err := glamour.NewTermRenderer(glamour.WithStandardStyle(m.style), glamour.WithWordWrap(paneWidth-2))
+	if err == nil {
+		m.renderer = renderer
+	}
+	for i := range m.entries {
+		m.entries[i].rendered = ""
+	}
+	m.refresh()
+}
+
+// refresh renders the conversation pane, following the end of the conversation
+// unless it was scrolled up
+func (m *tuiModel) refresh() {
+	if m.conversation.Width == 0 {
+		return
+	}
+	follow := m.conversation.AtBottom() || m.streaming
+	var b strings.Builder
+	for i := range m.entries {
+		entry := &m.entries[i]
+		if entry.rendered == "" {
+			entry.rendered = m.render(*entry, m.streaming && i == len(m.entries)-1)
+		}
+		b.WriteString(entry.rendered)
+		b.WriteString("\n")
+	}
+	m.conversation.SetContent(b.String())
+	if follow {
+		m.conversation.GotoBottom()
+	}
+}
+
+// render returns an entry of the conversation pane. The reply in progress is shown
+// as plain text and rendered as Markdown when it is complete.
+func (m *tuiModel) render(entry tuiEntry, streaming bool) string {
+	wrap := lipgloss.NewStyle().Width(m.conversation.Width - 2).PaddingLeft(2)
+	switch {
+	case entry.role == sqirvy.RoleUser:
+		return tuiUserStyle.Render("You") + "\n" + wrap.Render(entry.text) + "\n"
+	case entry.role == tuiNotice:
+		return tuiNoticeStyle.Render(wrap.Render(entry.text)) + "\n"
+	case streaming || m.renderer == nil:
+		return wrap.Render(entry.text) + "\n"
+	}
+	rendered, err := m.renderer.Render(entry.text)
+	if err != nil {
+		return wrap.Render(entry.text) + "\n"
+	}
+	return rendered
+}
+
+// View implements tea.Model.
+func (m *tuiModel) View() string {
+	if m.width == 0 {
+		return ""
+	}
+	if m.picking {
+		return tuiFocusStyle.Render(m.picker.View())
+	}
+
+	conversation := tuiPaneStyle.Render(m.conversation.View())
+	side := tuiPaneStyle.
+		Width(tuiSideWidth - 2).
+		Height(m.conversation.Height).
+		Render(m.sidePanel())
+	input := tuiFocusStyle.Render(m.input.View())
+
+	help := "enter send · alt+enter newline · ctrl+o model · pgup/pgdown scroll · ctrl+c quit"
+	if m.streaming {
+		help = "esc interrupt · pgup/pgdown scroll · ctrl+c quit"
+	}
+	return lipgloss.JoinVertical(lipgloss.Left,
+		lipgloss.JoinHorizontal(lipgloss.Top, conversation, side),
+		input,
+		tuiHelpStyle.Render(help),
+	)
+}
+
+// sidePanel returns the model, attachments and usage of the conversation
+func (m *tuiModel) sidePanel() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n%s\n%.2f\n\n", tuiTitleStyle.Render("Model"), m.session.model, m.session.temperature)
+
+	b.WriteString(tuiTitleStyle.Render("Attachments") + "\n")
+	if len(m.session.sources) == 0 && len(m.sent) == 0 {
+		b.WriteString(tuiNoticeStyle.Render("/file or /url to attach") + "\n")
+	}
+	for _, source := range m.session.sources {
+		fmt.Fprintf(&b, "+ %s\n", tuiSource(source))
+	}
+	for _, source := range m.sent {
+		fmt.Fprintf(&b, "  %s\n", tuiNoticeStyle.Render(tuiSource(source)))
+	}
+
+	output := fmt.Sprintf("%d", m.usage.OutputTokens)
+	if m.streaming {
+		output = fmt.Sprintf("%d+~%d", m.usage.OutputTokens, sqirvy.EstimateTokens(m.reply.String()))
+	}
+	fmt.Fprintf(&b, "\n%s\nInput  : %d\nOutput : %s\nCached : %d\nCost   : $%.4f\n",
+		tuiTitleStyle.Render("Tokens"), m.usage.InputTokens, output, m.usage.CacheReadTokens, m.cost)
+	return b.String()
+}
+
+// tuiSource returns the short name of an attached file or url for the side panel
+func tuiSource(source string) string {
+	if !isURL(source) {
+		source = filepath.Base(source)
+	}
+	if len(source) > tuiSideWidth-6 {
+		source = "…" + source[len(source)-(tuiSideWidth-7):]
+	}
+	return source
+}
+
+// init registers the tui command with the root command.
+func init() {
+	rootCmd.AddCommand(tuiCmd)
+}
@@ -0,0 +1,272 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// usageDimensions are the fields the usage report can be grouped by
+var usageDimensions = []string{"day", "model", "command", "provider"}
+
+// usageRow is one group of the usage report
+type usageRow struct {
+	Day          string  `json:"day,omitempty"`
+	Model        string  `json:"model,omitempty"`
+	Command      string  `json:"command,omitempty"`
+	Provider     string  `json:"provider,omitempty"`
+	Requests     int     `json:"requests"`
+	Cached       int     `json:"cached"`
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+	DurationMS   int64   `json:"duration_ms"`
+}
+
+// usageCmd reports the usage recorded in the usage ledger.
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Report token usage and cost from the usage ledger",
+	Long: `sqirvy-cli usage reports the requests, tokens, estimated cost and duration of the
+completed requests of sqirvy-cli, grouped by day, model and command.
+
+Every completed request of the query, plan, code, review and batch commands is appended
+to the usage ledger, ~/.config/sqirvy-cli/usage.jsonl (ledger-file in the config file),
+unless ledger: false is set in the config file. Responses from the response cache are
+recorded without tokens or cost.
+
+  sqirvy-cli usage --since 2025-06-01 --by model
+  sqirvy-cli usage --by day,command --format csv > usage.csv
+`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		by, _ := cmd.Flags().GetString("by")
+		format, _ := cmd.Flags().GetString("format")
+		since, _ := cmd.Flags().GetString("since")
+		until, _ := cmd.Flags().GetString("until")
+		if err := runUsage(os.Stdout, by, format, since, until); err != nil {
+			log.Fatalf("Error reporting usage: %v", err)
+		}
+	},
+}
+
+// runUsage writes the usage report of the ledger records between since and until,
+// dates in local time, grouped by the comma separated dimensions in by
+func runUsage(w io.Writer, by, format, since, until string) error {
+	dimensions, err := parseDimensions(by)
+	if err != nil {
+		return err
+	}
+	from, err := parseDay(since)
+	if err != nil {
+		return fmt.Errorf("invalid --since: %v", err)
+	}
+	to, err := parseDay(until)
+	if err != nil {
+		return fmt.Errorf("invalid --until: %v", err)
+	}
+
+	path, err := ledgerPath()
+	if err != nil {
+		return err
+	}
+	records, err := readLedger(path)
+	if err != nil {
+		return fmt.Errorf("reading usage ledger: %v", err)
+	}
+	var selected []ledgerRecord
+	for _, r := range records {
+		if (!from.IsZero() && r.Time.Before(from)) || (!to.IsZero() && !r.Time.Before(to.AddDate(0, 0, 1))) {
+			continue
+		}
+		selected = append(selected, r)
+	}
+	rows := aggregateUsage(selected, dimensions)
+
+	switch format {
+	case "", "table":
+		return writeUsageTable(w, rows, dimensions)
+	case "csv":
+		return writeUsageCSV(w, rows, dimensions)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if rows == nil {
+			rows = []usageRow{}
+		}
+		return enc.Encode(rows)
+	default:
+		return fmt.Errorf("invalid format %q, use table, csv or json", format)
+	}
+}
+
+// parseDimensions parses a comma separated list of usage dimensions
+func parseDimensions(by string) ([]string, error) {
+	var dimensions []string
+	for _, d := range strings.Split(by, ",") {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+		valid := false
+		for _, v := range usageDimensions {
+			valid = valid || d == v
+		}
+		if !valid {
+			return nil, fmt.Errorf("invalid --by %q, use %s", d, strings.Join(usageDimensions, ", "))
+		}
+		dimensions = append(dimensions, d)
+	}
+	return dimensions, nil
+}
+
+// parseDay parses a YYYY-MM-DD date in local time, returning the zero time if s is empty
+func parseDay(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation(time.DateOnly, s, time.Local)
+}
+
+// dimension returns the value of a usage dimension of a record
+func dimension(r ledgerRecord, d string) string {
+	switch d {
+	case "day":
+		return r.Time.Local().Format(time.DateOnly)
+	case "model":
+		return r.Model
+	case "command":
+		return r.Command
+	case "provider":
+		return r.Provider
+	}
+	return ""
+}
+
+// aggregateUsage sums the records by the values of the dimensions, sorted by those values
+func aggregateUsage(records []ledgerRecord, dimensions []string) []usageRow {
+	groups := make(map[string]*usageRow)
+	var keys []string
+	for _, r := range records {
+		values := make([]string, len(dimensions))
+		for i, d := range dimensions {
+			values[i] = dimension(r, d)
+		}
+		key := strings.Join(values, "\x00")
+		row, ok := groups[key]
+		if !ok {
+			row = &usageRow{}
+			for i, d := range dimensions {
+				*row.field(d) = values[i]
+			}
+			groups[key] = row
+			keys = append(keys, key)
+		}
+		row.Requests++
+		if r.Cached {
+			row.Cached++
+		}
+		row.InputTokens += r.InputTokens
+		row.OutputTokens += r.OutputTokens
+		row.Cost += r.Cost
+		row.DurationMS += r.DurationMS
+	}
+	sort.Strings(keys)
+	var rows []usageRow
+	for _, key := range keys {
+		rows = append(rows, *groups[key])
+	}
+	return rows
+}
+
+// field returns the field of a row that holds a usage dimension
+func (row *usageRow) field(d string) *string {
+	switch d {
+	case "day":
+		return &row.Day
+	case "model":
+		return &row.Model
+	case "command":
+		return &row.Command
+	}
+	return &row.Provider
+}
+
+// usageColumns returns the values of a row for the dimensions and its totals
+func usageColumns(row usageRow, dimensions []string) []string {
+	var values []string
+	for _, d := range dimensions {
+		values = append(values, *row.field(d))
+	}
+	return append(values,
+		strconv.Itoa(row.Requests),
+		strconv.Itoa(row.Cached),
+		strconv.FormatInt(row.InputTokens, 10),
+		strconv.FormatInt(row.OutputTokens, 10),
+		strconv.FormatFloat(row.Cost, 'f', 4, 64),
+		strconv.FormatFloat(float64(row.DurationMS)/1000, 'f', 1, 64),
+	)
+}
+
+// usageHeader returns the column names of the usage report
+func usageHeader(dimensions []string) []string {
+	return append(append([]string{}, dimensions...), "requests", "cached", "input_tokens", "output_tokens", "cost", "duration_s")
+}
+
+// writeUsageCSV writes the usage report as CSV with a header line
+func writeUsageCSV(w io.Writer, rows []usageRow, dimensions []string) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write(usageHeader(dimensions))
+	for _, row := range rows {
+		_ = cw.Write(usageColumns(row, dimensions))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeUsageTable writes the usage report as an aligned table with a total line
+func writeUsageTable(w io.Writer, rows []usageRow, dimensions []string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	header := usageHeader(dimensions)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(header, "\t"))+"\t")
+	var total usageRow
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(usageColumns(row, dimensions), "\t")+"\t")
+		total.Requests += row.Requests
+		total.Cached += row.Cached
+		total.InputTokens += row.InputTokens
+		total.OutputTokens += row.OutputTokens
+		total.Cost += row.Cost
+		total.DurationMS += row.DurationMS
+	}
+	totals := usageColumns(total, nil)
+	if len(dimensions) > 0 {
+		labels := make([]string, len(dimensions))
+		labels[0] = "total"
+		totals = append(labels, totals...)
+	}
+	fmt.Fprintln(tw, strings.Join(totals, "\t")+"\t")
+	return tw.Flush()
+}
+
+// init registers the usage command with the root command.
+func init() {
+	usageCmd.Flags().String("by", "day,model,command", "Comma separated fields to group by: day, model, command, provider")
+	usageCmd.Flags().String("format", "table", "Output format: table, csv or json")
+	usageCmd.Flags().String("since", "", "First day to report, YYYY-MM-DD")
+	usageCmd.Flags().String("until", "", "Last day to report, YYYY-MM-DD")
+	rootCmd.AddCommand(usageCmd)
+}
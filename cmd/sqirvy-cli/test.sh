@@ -80,3 +80,8 @@ echo "-------------------------------"
 echo "sqirvy query"
 check_return_code echo $query |   $TARGET query -m claude-3-5-haiku-20241022 main.go    >$TESTDIR/query1.md
 echo "-------------------------------"
+echo "sqirvy query offline (mock provider)"
+rm -f $TESTDIR/mock-record.jsonl
+check_return_code echo $query |   env MOCK_RECORD=$TESTDIR/mock-record.jsonl $TARGET query -m mock  >$TESTDIR/mock.md
+grep -q "sum of 1" $TESTDIR/mock-record.jsonl || { echo "mock provider did not record the prompt"; exit 1; }
+echo "-------------------------------"
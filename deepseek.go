@@ -0,0 +1,103 @@
+// Package sqirvy provides integration with DeepSeek models via langchaingo.
+//
+// This file implements the Client interface for DeepSeek models. The DeepSeek
+// API is OpenAI compatible, so requests are sent with langchaingo's OpenAI
+// provider pointed at the DeepSeek endpoint, with DeepSeek's own API key,
+// temperature scaling and model validation.
+package sqirvy
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// DeepSeek accepts temperatures in the range 0.0-2.0
+const deepseek_temperature_scale = 2.0
+
+// deepseekBaseURL is the default DeepSeek API endpoint
+const deepseekBaseURL = "https://api.deepseek.com"
+
+// DeepSeekClient implements the Client interface for DeepSeek models.
+// It provides methods for querying DeepSeek language models through
+// the langchaingo library.
+type DeepSeekClient struct {
+	llm              llms.Model // OpenAI-compatible LLM client
+	temperatureScale float32
+}
+
+// Ensure DeepSeekClient implements the Client interface
+var _ Client = (*DeepSeekClient)(nil)
+
+// NewDeepSeekClient creates a new instance of DeepSeekClient using langchaingo.
+// It returns an error if the required DEEPSEEK_API_KEY environment variable is not set.
+//
+// The API key is retrieved from the DEEPSEEK_API_KEY environment variable.
+// The optional DEEPSEEK_BASE_URL environment variable overrides the API endpoint.
+func NewDeepSeekClient(opts ...ClientOption) (*DeepSeekClient, error) {
+	config := newClientConfig(opts)
+
+	apiKey := os.Getenv("DEEPSEEK_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("DEEPSEEK_API_KEY environment variable not set")
+	}
+	if len(apiKey) < 20 {
+		return nil, fmt.Errorf("invalid DEEPSEEK_API_KEY: key appears to be too short")
+	}
+
+	baseURL := os.Getenv("DEEPSEEK_BASE_URL")
+	if baseURL == "" {
+		baseURL = deepseekBaseURL
+	}
+
+	llmOptions := []openai.Option{
+		openai.WithBaseURL(baseURL),
+		openai.WithToken(apiKey),
+	}
+	llmOptions = append(llmOptions, openai.WithHTTPClient(providerHTTPClient(DeepSeek, config.httpClient)))
+
+	llm, err := openai.New(llmOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DeepSeek client: %w", err)
+	}
+
+	return &DeepSeekClient{
+		llm:              llm,
+		temperatureScale: deepseek_temperature_scale, // Default temperature scale for DeepSeek
+	}, nil
+}
+
+// QueryText sends a text query to the specified DeepSeek model using langchaingo and returns the response.
+//
+// It takes a context, system prompt, a list of prompts, the model name, and options as input.
+// It returns the generated text or an error if the query fails or the model is invalid.
+func (c *DeepSeekClient) QueryText(ctx context.Context, system string, prompts []string, model string, options Options) (string, error) {
+	return queryText(ctx, c, system, prompts, model, options)
+}
+
+// Query implements the Querier interface. It works like QueryText and also
+// returns the stop reason and token usage reported by DeepSeek.
+func (c *DeepSeekClient) Query(ctx context.Context, req Request) (*Response, error) {
+	provider, err := GetProviderName(req.Model)
+	if err != nil || provider != DeepSeek {
+		return nil, fmt.Errorf("invalid or unsupported DeepSeek model: %s", req.Model)
+	}
+
+	// scale the temperature
+	options := req.Options
+	options.Temperature = options.Temperature * c.temperatureScale
+	options.MaxTokens = GetMaxTokens(req.Model)
+	return queryLangChain(ctx, c.llm, DeepSeek, req.System, req.History, req.Prompts, req.Model, options)
+}
+
+// Close implements the Close method for the Client interface.
+//
+// For the DeepSeek client, this method does not require any action as the
+// underlying langchaingo client does not need to be explicitly closed.
+func (c *DeepSeekClient) Close() error {
+	// the langchaingo llm does not require explicit close
+	return nil
+}
@@ -0,0 +1,124 @@
+// Package sqirvy provides text embeddings for the semantic cache.
+//
+// This file defines the Embedder interface and two implementations:
+// OpenAIEmbedder, which uses the OpenAI embeddings api through langchaingo,
+// and MockEmbedder, a deterministic bag-of-words embedder that never calls a
+// real API, for tests and offline use.
+package sqirvy
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// default embedding model of OpenAIEmbedder
+const defaultEmbeddingModel = "text-embedding-3-small"
+
+// Embedder converts texts to embedding vectors.
+type Embedder interface {
+	// Embed returns one vector per text, in order
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// OpenAIEmbedder implements Embedder with the OpenAI embeddings api.
+type OpenAIEmbedder struct {
+	llm *openai.LLM
+}
+
+// Ensure OpenAIEmbedder implements the Embedder interface
+var _ Embedder = (*OpenAIEmbedder)(nil)
+
+// NewOpenAIEmbedder creates an embedder for the embedding model, text-embedding-3-small
+// if model is empty. It uses the OPENAI_API_KEY and OPENAI_BASE_URL environment
+// variables, like NewOpenAIClient.
+func NewOpenAIEmbedder(model string, opts ...ClientOption) (*OpenAIEmbedder, error) {
+	config := newClientConfig(opts)
+
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY environment variable not set")
+	}
+	baseURL := os.Getenv("OPENAI_BASE_URL")
+	if baseURL == "" {
+		return nil, fmt.Errorf("OPENAI_BASE_URL environment variable not set")
+	}
+	if model == "" {
+		model = defaultEmbeddingModel
+	}
+
+	llmOptions := []openai.Option{
+		openai.WithBaseURL(baseURL),
+		openai.WithToken(apiKey),
+		openai.WithEmbeddingModel(model),
+	}
+	if config.httpClient != nil {
+		llmOptions = append(llmOptions, openai.WithHTTPClient(config.httpClient))
+	}
+	llm, err := openai.New(llmOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OpenAI embedder: %w", err)
+	}
+	return &OpenAIEmbedder{llm: llm}, nil
+}
+
+// Embed implements the Embedder interface.
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors, err := e.llm.CreateEmbedding(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embeddings: %w", err)
+	}
+	return vectors, nil
+}
+
+// mockEmbeddingDims is the vector size of MockEmbedder
+const mockEmbeddingDims = 256
+
+// MockEmbedder is a deterministic Embedder that hashes the lowercased words of a
+// text into a fixed size vector. Texts that share most of their words are similar.
+type MockEmbedder struct{}
+
+// Ensure MockEmbedder implements the Embedder interface
+var _ Embedder = MockEmbedder{}
+
+// Embed implements the Embedder interface.
+func (MockEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		v := make([]float32, mockEmbeddingDims)
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		for _, word := range words {
+			h := fnv.New32a()
+			h.Write([]byte(word))
+			v[h.Sum32()%mockEmbeddingDims]++
+		}
+		vectors[i] = v
+	}
+	return vectors, nil
+}
+
+// CosineSimilarity returns the cosine similarity of two vectors, 0 if either is
+// zero or their lengths differ.
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -0,0 +1,179 @@
+// Package sqirvy provides classification of provider errors.
+//
+// This file maps the errors returned by the provider clients to a small set of
+// error classes, so that wrappers such as FallbackClient can decide whether a
+// failed request is worth sending to another model.
+package sqirvy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	vertexgenai "cloud.google.com/go/vertexai/genai"
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/googleapi"
+)
+
+// ErrContentFiltered is returned by FallbackClient for a reply that a target
+// stopped with a content filter stop reason.
+var ErrContentFiltered = errors.New("reply stopped by a content filter")
+
+// ErrorClass describes the kind of failure returned by a provider.
+type ErrorClass string
+
+const (
+	// ErrorRateLimit means the request was rejected by a provider rate limit (http 429)
+	ErrorRateLimit ErrorClass = "rate_limit"
+	// ErrorOverloaded means the provider is temporarily overloaded (http 503, 529),
+	// or its circuit breaker is open
+	ErrorOverloaded ErrorClass = "overloaded"
+	// ErrorTimeout means the request timed out
+	ErrorTimeout ErrorClass = "timeout"
+	// ErrorContentFilter means the request or response was blocked by a content filter
+	ErrorContentFilter ErrorClass = "content_filter"
+	// ErrorServer means the provider returned another server error (http 5xx)
+	ErrorServer ErrorClass = "server_error"
+	// ErrorAuthentication means the api key or credentials were rejected (http 401, 403)
+	ErrorAuthentication ErrorClass = "authentication"
+	// ErrorInvalidRequest means the request was rejected as invalid (other http 4xx)
+	ErrorInvalidRequest ErrorClass = "invalid_request"
+	// ErrorUnknown is used for errors that cannot be classified
+	ErrorUnknown ErrorClass = "unknown"
+)
+
+// statusCodePattern finds the http status code in langchaingo error messages,
+// e.g. "API returned unexpected status code: 429: rate limited"
+var statusCodePattern = regexp.MustCompile(`status code:? (\d{3})`)
+
+// ClassifyError returns the class of an error returned by a client.
+// It returns an empty class for a nil error.
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ""
+	}
+
+	// an open circuit means the provider is unavailable
+	if errors.Is(err, ErrCircuitOpen) {
+		return ErrorOverloaded
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorTimeout
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		if class := classifyStatus(apiErr.Code); class != ErrorUnknown {
+			return class
+		}
+	}
+
+	// replies blocked by the gemini safety filters
+	if errors.Is(err, ErrContentFiltered) {
+		return ErrorContentFilter
+	}
+	var geminiBlocked *genai.BlockedError
+	var vertexBlocked *vertexgenai.BlockedError
+	if errors.As(err, &geminiBlocked) || errors.As(err, &vertexBlocked) {
+		return ErrorContentFilter
+	}
+
+	// the status code takes priority over the words of the message, except for
+	// prompts that are rejected by a content filter as invalid requests
+	msg := strings.ToLower(err.Error())
+	if m := statusCodePattern.FindStringSubmatch(msg); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		class := classifyStatus(code)
+		if class == ErrorInvalidRequest && isContentFilterMessage(msg) {
+			return ErrorContentFilter
+		}
+		if class != ErrorUnknown {
+			return class
+		}
+	}
+
+	switch {
+	case isContentFilterMessage(msg):
+		return ErrorContentFilter
+	case strings.Contains(msg, "rate limit"),
+		strings.Contains(msg, "rate_limit"),
+		strings.Contains(msg, "too many requests"),
+		strings.Contains(msg, "resource_exhausted"),
+		strings.Contains(msg, "resource exhausted"):
+		return ErrorRateLimit
+	case strings.Contains(msg, "overloaded"),
+		strings.Contains(msg, "unavailable"):
+		return ErrorOverloaded
+	case strings.Contains(msg, "timeout"),
+		strings.Contains(msg, "timed out"):
+		return ErrorTimeout
+	}
+	return ErrorUnknown
+}
+
+// isContentFilterStop reports whether a provider stop reason means that the reply
+// was stopped by a content filter: content_filter (openai), and SAFETY, RECITATION,
+// BLOCKLIST, PROHIBITED_CONTENT or SPII (gemini, also as FinishReasonSafety)
+func isContentFilterStop(stopReason string) bool {
+	stop := strings.ToLower(stopReason)
+	for _, reason := range []string{"content_filter", "safety", "recitation", "blocklist", "prohibited_content", "spii"} {
+		if strings.Contains(stop, reason) {
+			return true
+		}
+	}
+	return false
+}
+
+// isContentFilterMessage reports whether a lowercase error message has one of the
+// content filter markers of the providers
+func isContentFilterMessage(msg string) bool {
+	for _, marker := range []string{
+		"content_filter",            // openai finish reason and error code
+		"content management policy", // azure openai
+		"finish_reason: safety",
+		"finishreasonsafety", // gemini blocked candidate
+		"prompt blocked",
+	} {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyStatus returns the class of an http status code
+func classifyStatus(code int) ErrorClass {
+	switch {
+	case code == http.StatusTooManyRequests:
+		return ErrorRateLimit
+	case code == http.StatusServiceUnavailable || code == 529:
+		return ErrorOverloaded
+	case code == http.StatusRequestTimeout || code == http.StatusGatewayTimeout:
+		return ErrorTimeout
+	case code >= 500:
+		return ErrorServer
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return ErrorAuthentication
+	case code >= 400:
+		return ErrorInvalidRequest
+	}
+	return ErrorUnknown
+}
+
+// IsRetryable reports whether a request that failed with err may succeed if it is
+// sent again or sent to another model: rate limits, overloads, timeouts and server errors.
+func IsRetryable(err error) bool {
+	switch ClassifyError(err) {
+	case ErrorRateLimit, ErrorOverloaded, ErrorTimeout, ErrorServer:
+		return true
+	}
+	return false
+}
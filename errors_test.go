@@ -0,0 +1,49 @@
+package sqirvy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	vertexgenai "cloud.google.com/go/vertexai/genai"
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/googleapi"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		want      ErrorClass
+		retryable bool
+	}{
+		{name: "Nil", err: nil, want: ""},
+		{name: "Anthropic rate limit", err: errors.New("API returned unexpected status code: 429: Number of requests has exceeded your rate limit"), want: ErrorRateLimit, retryable: true},
+		{name: "Anthropic overloaded", err: errors.New("API returned unexpected status code: 529: Overloaded"), want: ErrorOverloaded, retryable: true},
+		{name: "OpenAI server error", err: errors.New("API returned unexpected status code: 500: internal error"), want: ErrorServer, retryable: true},
+		{name: "OpenAI auth error", err: errors.New("API returned unexpected status code: 401: Incorrect API key provided"), want: ErrorAuthentication},
+		{name: "Invalid request", err: errors.New("API returned unexpected status code: 400: max_tokens is too large"), want: ErrorInvalidRequest},
+		{name: "Content filter", err: errors.New("failed to generate completion: content_filter"), want: ErrorContentFilter},
+		{name: "Gemini error", err: fmt.Errorf("failed to generate completion: %w", &googleapi.Error{Code: 429, Message: "quota"}), want: ErrorRateLimit, retryable: true},
+		{name: "Deadline", err: fmt.Errorf("request context error %w", context.DeadlineExceeded), want: ErrorTimeout, retryable: true},
+		{name: "Azure content filter", err: errors.New("API returned unexpected status code: 400: The response was filtered due to the prompt triggering Azure OpenAI's content management policy"), want: ErrorContentFilter},
+		{name: "Gemini blocked", err: fmt.Errorf("failed to generate completion: %w", &genai.BlockedError{Candidate: &genai.Candidate{FinishReason: genai.FinishReasonSafety}}), want: ErrorContentFilter},
+		{name: "Vertex prompt blocked", err: &vertexgenai.BlockedError{PromptFeedback: &vertexgenai.PromptFeedback{BlockReason: vertexgenai.BlockedReasonSafety}}, want: ErrorContentFilter},
+		{name: "Rate limit blocked", err: errors.New("API returned unexpected status code: 429: request blocked by rate limiter"), want: ErrorRateLimit, retryable: true},
+		{name: "Forbidden blocked", err: errors.New("API returned unexpected status code: 403: access blocked"), want: ErrorAuthentication},
+		{name: "Unavailable safety", err: errors.New("API returned unexpected status code: 503: safety system unavailable"), want: ErrorOverloaded, retryable: true},
+		{name: "Unknown", err: errors.New("something went wrong"), want: ErrorUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyError(tt.err); got != tt.want {
+				t.Errorf("ClassifyError() = %q, want %q", got, tt.want)
+			}
+			if got := IsRetryable(tt.err); got != tt.retryable {
+				t.Errorf("IsRetryable() = %v, want %v", got, tt.retryable)
+			}
+		})
+	}
+}
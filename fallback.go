@@ -0,0 +1,217 @@
+// Package sqirvy provides fallback chains across models and providers.
+//
+// This file implements FallbackClient, a Client that sends each query to an
+// ordered list of provider and model targets. When a target fails with a rate
+// limit, overload, timeout or content filter error, or its reply is stopped by a
+// content filter, the query is sent to the next target. The response metadata reports which target answered.
+package sqirvy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MetadataFallbackTarget is the Response.Metadata key holding the target
+	// that answered a FallbackClient query, as "provider/model"
+	MetadataFallbackTarget = "fallback_target"
+
+	// MetadataFallbackAttempts is the Response.Metadata key holding the number
+	// of targets tried by a FallbackClient query
+	MetadataFallbackAttempts = "fallback_attempts"
+)
+
+// Target is a provider and model in a fallback chain.
+type Target struct {
+	Provider string // Provider name, e.g. Anthropic
+	Model    string // Model name
+	Client   Client // Optional client; if nil, one is created with NewClient when first used
+}
+
+// String returns the target as "provider/model".
+func (t Target) String() string {
+	return t.Provider + "/" + t.Model
+}
+
+// ParseTargets returns the fallback targets for a list of model names, looking up
+// the provider of each model in the model registry. Aliases are resolved.
+func ParseTargets(models []string) ([]Target, error) {
+	var targets []Target
+	for _, model := range models {
+		model = GetModelAlias(strings.TrimSpace(model))
+		if model == "" {
+			continue
+		}
+		provider, err := GetProviderName(model)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, Target{Provider: provider, Model: model})
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("fallback chain cannot be empty")
+	}
+	return targets, nil
+}
+
+// FallbackClient implements the Client interface by trying an ordered list of targets.
+// The model argument of QueryText and the Model of a Request are ignored; each target
+// is queried with its own model. FallbackClient is safe for concurrent use.
+type FallbackClient struct {
+	targets    []Target
+	pool       clientPool // clients created by the fallback client
+	shouldFall func(error) bool
+	timeout    time.Duration
+}
+
+// Ensure FallbackClient implements the Client and Querier interfaces
+var (
+	_ Client  = (*FallbackClient)(nil)
+	_ Querier = (*FallbackClient)(nil)
+)
+
+// FallbackOption configures a FallbackClient.
+type FallbackOption func(*FallbackClient)
+
+// WithFallbackClientOptions sets the ClientOptions used when creating target clients.
+func WithFallbackClientOptions(opts ...ClientOption) FallbackOption {
+	return func(c *FallbackClient) {
+		c.pool.opts = opts
+	}
+}
+
+// WithFallbackTimeout limits the time allowed for each target. A target that times
+// out falls back to the next one. By default only the query context limits each target.
+func WithFallbackTimeout(d time.Duration) FallbackOption {
+	return func(c *FallbackClient) {
+		c.timeout = d
+	}
+}
+
+// WithFallbackOn replaces the function that decides whether an error falls back
+// to the next target. The default is ShouldFallback.
+func WithFallbackOn(f func(error) bool) FallbackOption {
+	return func(c *FallbackClient) {
+		c.shouldFall = f
+	}
+}
+
+// ShouldFallback reports whether a query that failed with err should be sent to
+// the next target in a fallback chain: rate limits, overloads, timeouts, server
+// errors and content filter blocks.
+func ShouldFallback(err error) bool {
+	return IsRetryable(err) || ClassifyError(err) == ErrorContentFilter
+}
+
+// NewFallbackClient creates a FallbackClient for the targets, in order of preference.
+func NewFallbackClient(targets []Target, opts ...FallbackOption) (*FallbackClient, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("fallback chain cannot be empty")
+	}
+	for _, t := range targets {
+		if t.Model == "" || (t.Provider == "" && t.Client == nil) {
+			return nil, fmt.Errorf("invalid fallback target: %s", t)
+		}
+	}
+
+	c := &FallbackClient{
+		targets:    append([]Target(nil), targets...),
+		shouldFall: ShouldFallback,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Targets returns the targets of the fallback chain, in order.
+func (c *FallbackClient) Targets() []Target {
+	return append([]Target(nil), c.targets...)
+}
+
+// QueryText sends the query to each target in turn until one succeeds,
+// and returns its response text.
+func (c *FallbackClient) QueryText(ctx context.Context, system string, prompts []string, model string, options Options) (string, error) {
+	return queryText(ctx, c, system, prompts, model, options)
+}
+
+// Query implements the Querier interface. The response metadata holds the target
+// that answered (MetadataFallbackTarget) and the number of targets tried
+// (MetadataFallbackAttempts). If every target fails, the errors are joined.
+func (c *FallbackClient) Query(ctx context.Context, req Request) (*Response, error) {
+	var errs []error
+	for i, target := range c.targets {
+		if ctx.Err() != nil {
+			errs = append(errs, fmt.Errorf("request context error %w", ctx.Err()))
+			break
+		}
+
+		resp, err := c.queryTarget(ctx, i, req)
+		// a filtered reply is a success with an empty or partial text; it is
+		// returned only by the last target
+		if err == nil && isContentFilterStop(resp.StopReason) && i < len(c.targets)-1 {
+			err = fmt.Errorf("%w: stop reason %s", ErrContentFiltered, resp.StopReason)
+		}
+		if err == nil {
+			if resp.Metadata == nil {
+				resp.Metadata = make(map[string]string)
+			}
+			resp.Metadata[MetadataFallbackTarget] = target.String()
+			resp.Metadata[MetadataFallbackAttempts] = strconv.Itoa(i + 1)
+			return resp, nil
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", target, err))
+		if !errors.Is(err, errTargetClient) && !c.shouldFall(err) {
+			break
+		}
+	}
+	return nil, fmt.Errorf("fallback chain failed: %w", errors.Join(errs...))
+}
+
+// errTargetClient marks a failure to create a target client, which always falls back
+var errTargetClient = errors.New("failed to create target client")
+
+// queryTarget sends the request to the target at index i
+func (c *FallbackClient) queryTarget(ctx context.Context, i int, req Request) (*Response, error) {
+	client, err := c.client(i)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errTargetClient, err)
+	}
+
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	target := c.targets[i]
+	req.Model = target.Model
+	resp, err := Query(ctx, client, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Provider == "" {
+		resp.Provider = target.Provider
+	}
+	return resp, nil
+}
+
+// client returns the client for the target at index i.
+// Targets with the same provider and no client share a client from the pool.
+func (c *FallbackClient) client(i int) (Client, error) {
+	if client := c.targets[i].Client; client != nil {
+		return client, nil
+	}
+	return c.pool.get(c.targets[i].Provider)
+}
+
+// Close closes the clients created by the FallbackClient.
+// Clients passed in a Target are not closed.
+func (c *FallbackClient) Close() error {
+	return c.pool.Close()
+}
@@ -0,0 +1,119 @@
+package sqirvy
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFallbackClient_Query(t *testing.T) {
+	tests := []struct {
+		name       string
+		first      MockResponse
+		second     MockResponse
+		want       string
+		wantTarget string
+		wantErr    bool
+	}{
+		{name: "First target answers", first: MockResponse{Text: "one"}, second: MockResponse{Text: "two"}, want: "one", wantTarget: "mock/first"},
+		{name: "Rate limit falls back", first: MockResponse{Error: "rate limit exceeded"}, second: MockResponse{Text: "two"}, want: "two", wantTarget: "mock/second"},
+		{name: "Overload falls back", first: MockResponse{Error: "overloaded"}, second: MockResponse{Text: "two"}, want: "two", wantTarget: "mock/second"},
+		{name: "Content filter falls back", first: MockResponse{Error: "content_filter"}, second: MockResponse{Text: "two"}, want: "two", wantTarget: "mock/second"},
+		{name: "Filtered reply falls back", first: MockResponse{Text: "partial", StopReason: "content_filter"}, second: MockResponse{Text: "two"}, want: "two", wantTarget: "mock/second"},
+		{name: "Gemini safety stop falls back", first: MockResponse{StopReason: "FinishReasonSafety"}, second: MockResponse{Text: "two"}, want: "two", wantTarget: "mock/second"},
+		{name: "Last target filtered reply", first: MockResponse{Error: "overloaded"}, second: MockResponse{Text: "partial", StopReason: "content_filter"}, want: "partial", wantTarget: "mock/second"},
+		{name: "Invalid request does not fall back", first: MockResponse{Error: "status code: 400: bad request"}, second: MockResponse{Text: "two"}, wantErr: true},
+		{name: "All targets fail", first: MockResponse{Error: "overloaded"}, second: MockResponse{Error: "overloaded"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := NewMockClientWithResponses(tt.first)
+			second := NewMockClientWithResponses(tt.second)
+			client, err := NewFallbackClient([]Target{
+				{Provider: Mock, Model: "first", Client: first},
+				{Provider: Mock, Model: "second", Client: second},
+			})
+			if err != nil {
+				t.Fatalf("NewFallbackClient() error = %v", err)
+			}
+
+			resp, err := client.Query(context.Background(), Request{System: assistant, Prompts: []string{"hello"}})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("FallbackClient.Query() error = nil, wantErr %v", tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FallbackClient.Query() error = %v", err)
+			}
+			if resp.Text != tt.want {
+				t.Errorf("FallbackClient.Query() = %q, want %q", resp.Text, tt.want)
+			}
+			if resp.Metadata[MetadataFallbackTarget] != tt.wantTarget {
+				t.Errorf("fallback target = %q, want %q", resp.Metadata[MetadataFallbackTarget], tt.wantTarget)
+			}
+			if req, ok := second.LastRequest(); ok && req.Model != "second" {
+				t.Errorf("second target queried with model %q", req.Model)
+			}
+		})
+	}
+}
+
+func TestFallbackClient_Timeout(t *testing.T) {
+	slow := NewMockClientWithResponses(MockResponse{Text: "slow", LatencyMS: 1000})
+	fast := NewMockClientWithResponses(MockResponse{Text: "fast"})
+	client, err := NewFallbackClient([]Target{
+		{Provider: Mock, Model: "slow", Client: slow},
+		{Provider: Mock, Model: "fast", Client: fast},
+	}, WithFallbackTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewFallbackClient() error = %v", err)
+	}
+
+	got, err := client.QueryText(context.Background(), assistant, []string{"hello"}, "", Options{})
+	if err != nil {
+		t.Fatalf("FallbackClient.QueryText() error = %v", err)
+	}
+	if got != "fast" {
+		t.Errorf("FallbackClient.QueryText() = %q, want %q", got, "fast")
+	}
+}
+
+func TestFallbackClient_Cancelled(t *testing.T) {
+	client, err := NewFallbackClient([]Target{
+		{Provider: Mock, Model: "first", Client: NewMockClientWithResponses(MockResponse{Error: "overloaded"})},
+		{Provider: Mock, Model: "second", Client: NewMockClientWithResponses()},
+	})
+	if err != nil {
+		t.Fatalf("NewFallbackClient() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.QueryText(ctx, assistant, []string{"hello"}, "", Options{}); err == nil {
+		t.Error("FallbackClient.QueryText() error = nil, want context error")
+	}
+}
+
+func TestParseTargets(t *testing.T) {
+	targets, err := ParseTargets(strings.Split("claude-sonnet-4, gpt-5-mini,mock", ","))
+	if err != nil {
+		t.Fatalf("ParseTargets() error = %v", err)
+	}
+	want := []string{"anthropic/claude-sonnet-4-20250514", "openai/gpt-5-mini", "mock/mock"}
+	if len(targets) != len(want) {
+		t.Fatalf("ParseTargets() returned %d targets, want %d", len(targets), len(want))
+	}
+	for i, target := range targets {
+		if target.String() != want[i] {
+			t.Errorf("target %d = %s, want %s", i, target, want[i])
+		}
+	}
+
+	if _, err := ParseTargets([]string{"no-such-model"}); err == nil {
+		t.Error("ParseTargets() error = nil for unknown model")
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package sqirvy
+
+import "os"
+
+// lockFile does nothing on platforms without advisory file locks;
+// shared state files are then only protected within a process
+func lockFile(f *os.File) error {
+	return nil
+}
+
+// unlockFile releases the lock taken by lockFile
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -12,6 +12,8 @@ import (
 
 	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/llms/googleai"
+	"google.golang.org/api/googleapi/transport"
+	"google.golang.org/api/option"
 )
 
 const gemini_temperature_scale = 2.0
@@ -31,8 +33,11 @@ var _ Client = (*GeminiClient)(nil)
 // It returns an error if the required GEMINI_API_KEY environment variable is not set.
 //
 // The Google API key is retrieved from the GEMINI_API_KEY environment variable.
+// The optional GEMINI_BASE_URL environment variable overrides the API endpoint.
 // Ensure this variable is set before calling this function.
-func NewGeminiClient() (*GeminiClient, error) {
+func NewGeminiClient(opts ...ClientOption) (*GeminiClient, error) {
+	config := newClientConfig(opts)
+
 	apiKey := os.Getenv("GEMINI_API_KEY")
 	if apiKey == "" {
 		return nil, fmt.Errorf("GEMINI_API_KEY environment variable not set")
@@ -41,8 +46,18 @@ func NewGeminiClient() (*GeminiClient, error) {
 		return nil, fmt.Errorf("invalid GEMINI_API_KEY: key appears to be too short")
 	}
 
+	llmOptions := []googleai.Option{googleai.WithAPIKey(apiKey)}
+	// optional endpoint override
+	if baseURL := os.Getenv("GEMINI_BASE_URL"); baseURL != "" {
+		llmOptions = append(llmOptions, withClientOption(option.WithEndpoint(baseURL)))
+	}
+	// a custom http client replaces the api key auth, so the key is added by its transport
+	httpClient := providerHTTPClient(Gemini, config.httpClient)
+	httpClient.Transport = &transport.APIKey{Key: apiKey, Transport: httpClient.Transport}
+	llmOptions = append(llmOptions, googleai.WithHTTPClient(httpClient))
+
 	// Note: langchaingo's googleai client uses the API key from the environment variable by default.
-	llm, err := googleai.New(context.Background(), googleai.WithAPIKey(apiKey))
+	llm, err := googleai.New(context.Background(), llmOptions...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Gemini client: %w", err)
 	}
@@ -59,14 +74,20 @@ func NewGeminiClient() (*GeminiClient, error) {
 // It returns the generated text or an error if the query fails.
 // Request timeouts are handled by the input context.
 func (c *GeminiClient) QueryText(ctx context.Context, system string, prompts []string, model string, options Options) (string, error) {
+	return queryText(ctx, c, system, prompts, model, options)
+}
 
-	provider, err := GetProviderName(model)
+// Query implements the Querier interface. It works like QueryText and also
+// returns the stop reason and token usage reported by Gemini.
+func (c *GeminiClient) Query(ctx context.Context, req Request) (*Response, error) {
+	provider, err := GetProviderName(req.Model)
 	if err != nil || provider != Gemini {
-		return "", fmt.Errorf("invalid or unsupported Gemini model: %s", model)
+		return nil, fmt.Errorf("invalid or unsupported Gemini model: %s", req.Model)
 	}
+	options := req.Options
 	options.Temperature = options.Temperature * c.temperatureScale
-	options.MaxTokens = GetMaxTokens(model)
-	return queryTextLangChain(ctx, c.llm, system, prompts, model, options)
+	options.MaxTokens = GetMaxTokens(req.Model)
+	return queryLangChain(ctx, c.llm, Gemini, req.System, req.History, req.Prompts, req.Model, options)
 }
 
 // Close implements the Close method for the Client interface.
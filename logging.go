@@ -0,0 +1,150 @@
+// Package sqirvy provides structured logging of queries.
+//
+// This file implements LoggingClient, a Client wrapper that logs the metadata of
+// each request and response to a log/slog Logger at debug level. The system
+// prompt, prompts and response text are redacted unless LogConfig.Prompts is set,
+// since they may hold user data.
+package sqirvy
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+)
+
+// redacted replaces logged prompts and response text
+const redacted = "[redacted]"
+
+// LogConfig configures a LoggingClient.
+type LogConfig struct {
+	// Prompts logs the system prompt, prompts and response text instead of redacting them
+	Prompts bool
+}
+
+// LoggingClient wraps a Client and logs each query at debug level.
+type LoggingClient struct {
+	client   Client
+	provider string
+	logger   *slog.Logger
+	config   LogConfig
+}
+
+// Ensure LoggingClient implements the Client and Querier interfaces
+var (
+	_ Client  = (*LoggingClient)(nil)
+	_ Querier = (*LoggingClient)(nil)
+)
+
+// NewLoggingClient wraps client so that its queries are logged to logger.
+func NewLoggingClient(client Client, provider string, logger *slog.Logger, config LogConfig) *LoggingClient {
+	return &LoggingClient{client: client, provider: provider, logger: logger, config: config}
+}
+
+// QueryText sends the query to the wrapped client and logs it.
+func (c *LoggingClient) QueryText(ctx context.Context, system string, prompts []string, model string, options Options) (string, error) {
+	return queryText(ctx, c, system, prompts, model, options)
+}
+
+// Query implements the Querier interface. It logs the request before it is sent
+// and the response or error when it completes.
+func (c *LoggingClient) Query(ctx context.Context, req Request) (*Response, error) {
+	return c.intercept(ctx, req, ClientHandler(c.client))
+}
+
+// intercept implements the middleware of the client, sending requests to next
+func (c *LoggingClient) intercept(ctx context.Context, req Request, next Handler) (*Response, error) {
+	if !c.logger.Enabled(ctx, slog.LevelDebug) {
+		return next(ctx, req)
+	}
+
+	c.logger.LogAttrs(ctx, slog.LevelDebug, "query request", c.requestAttrs(req)...)
+	start := time.Now()
+	resp, err := next(ctx, req)
+	duration := time.Since(start)
+	if err != nil {
+		c.logger.LogAttrs(ctx, slog.LevelDebug, "query failed",
+			slog.String("provider", c.provider),
+			slog.String("model", req.Model),
+			slog.Duration("duration", duration),
+			slog.String("error", err.Error()),
+		)
+		return nil, err
+	}
+	c.logger.LogAttrs(ctx, slog.LevelDebug, "query response", c.responseAttrs(resp, duration)...)
+	return resp, nil
+}
+
+// requestAttrs returns the logged attributes of a request
+func (c *LoggingClient) requestAttrs(req Request) []slog.Attr {
+	promptBytes := 0
+	for _, prompt := range req.Prompts {
+		promptBytes += len(prompt)
+	}
+	attrs := []slog.Attr{
+		slog.String("provider", c.provider),
+		slog.String("model", req.Model),
+		slog.Float64("temperature", float64(req.Options.Temperature)),
+		slog.Int64("max_tokens", req.Options.MaxTokens),
+		slog.Bool("stream", req.Options.StreamFunc != nil),
+		slog.Int("system_bytes", len(req.System)),
+		slog.Int("prompts", len(req.Prompts)),
+		slog.Int("prompt_bytes", promptBytes),
+	}
+	if len(req.History) > 0 {
+		attrs = append(attrs, slog.Int("history", len(req.History)))
+	}
+	if req.Options.PromptCache.enabled() {
+		attrs = append(attrs, slog.Bool("prompt_cache", true))
+	}
+	if c.config.Prompts {
+		attrs = append(attrs, slog.String("system", req.System), slog.Any("prompt_text", req.Prompts))
+	} else {
+		attrs = append(attrs, slog.String("system", redacted), slog.String("prompt_text", redacted))
+	}
+	return attrs
+}
+
+// responseAttrs returns the logged attributes of a response
+func (c *LoggingClient) responseAttrs(resp *Response, duration time.Duration) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("provider", resp.Provider),
+		slog.String("model", resp.Model),
+		slog.String("stop_reason", resp.StopReason),
+		slog.Duration("duration", duration),
+		slog.Int64("input_tokens", resp.Usage.InputTokens),
+		slog.Int64("output_tokens", resp.Usage.OutputTokens),
+	}
+	if resp.Usage.CacheReadTokens > 0 || resp.Usage.CacheWriteTokens > 0 {
+		attrs = append(attrs,
+			slog.Int64("cache_read_tokens", resp.Usage.CacheReadTokens),
+			slog.Int64("cache_write_tokens", resp.Usage.CacheWriteTokens),
+		)
+	}
+	attrs = append(attrs, slog.Int("response_bytes", len(resp.Text)))
+	if c.config.Prompts {
+		attrs = append(attrs, slog.String("response_text", resp.Text))
+	} else {
+		attrs = append(attrs, slog.String("response_text", redacted))
+	}
+	if len(resp.Metadata) > 0 {
+		var metadata []any
+		for _, key := range slices.Sorted(maps.Keys(resp.Metadata)) {
+			metadata = append(metadata, slog.String(key, resp.Metadata[key]))
+		}
+		attrs = append(attrs, slog.Group("metadata", metadata...))
+	}
+	return attrs
+}
+
+// LoggingMiddleware returns the middleware of a LoggingClient: it logs each query
+// to logger at debug level.
+func LoggingMiddleware(provider string, logger *slog.Logger, config LogConfig) Middleware {
+	return NewLoggingClient(nil, provider, logger, config).intercept
+}
+
+// Close closes the wrapped client.
+func (c *LoggingClient) Close() error {
+	return c.client.Close()
+}
@@ -0,0 +1,130 @@
+package sqirvy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// logRecords decodes the records written by a slog JSON handler
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLoggingClient(t *testing.T) {
+	tests := []struct {
+		name       string
+		level      slog.Level
+		config     LogConfig
+		wantLogs   int
+		wantPrompt any
+	}{
+		{name: "Redacted", level: slog.LevelDebug, wantLogs: 2, wantPrompt: redacted},
+		{name: "Prompts", level: slog.LevelDebug, config: LogConfig{Prompts: true}, wantLogs: 2, wantPrompt: []any{"secret question"}},
+		{name: "Info level", level: slog.LevelInfo, wantLogs: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: tt.level}))
+			mock := NewMockClientWithResponses(MockResponse{Text: "secret answer"})
+			client := NewLoggingClient(mock, Mock, logger, tt.config)
+
+			resp, err := client.Query(context.Background(), Request{System: assistant, Prompts: []string{"secret question"}, Model: "mock"})
+			if err != nil || resp.Text != "secret answer" {
+				t.Fatalf("Query() = %v, %v", resp, err)
+			}
+
+			records := logRecords(t, &buf)
+			if len(records) != tt.wantLogs {
+				t.Fatalf("log records = %d, want %d: %s", len(records), tt.wantLogs, buf.String())
+			}
+			if tt.wantLogs == 0 {
+				return
+			}
+			request, response := records[0], records[1]
+			if request["msg"] != "query request" || request["model"] != "mock" || request["prompt_bytes"] != float64(len("secret question")) {
+				t.Errorf("request record = %v", request)
+			}
+			if got, _ := json.Marshal(request["prompt_text"]); string(got) != mustJSON(tt.wantPrompt) {
+				t.Errorf("prompt_text = %s, want %s", got, mustJSON(tt.wantPrompt))
+			}
+			if response["msg"] != "query response" || response["provider"] != Mock || response["stop_reason"] == nil {
+				t.Errorf("response record = %v", response)
+			}
+			if !tt.config.Prompts && strings.Contains(buf.String(), "secret") {
+				t.Errorf("log contains prompt or response text: %s", buf.String())
+			}
+		})
+	}
+}
+
+func TestLoggingClient_Error(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	mock := NewMockClientWithResponses(MockResponse{Error: "overloaded"})
+	client := NewLoggingClient(mock, Mock, logger, LogConfig{})
+
+	if _, err := client.QueryText(context.Background(), assistant, []string{"hello"}, "mock", Options{}); err == nil {
+		t.Fatalf("QueryText() error = nil, want error")
+	}
+	records := logRecords(t, &buf)
+	if len(records) != 2 || records[1]["msg"] != "query failed" || !strings.Contains(records[1]["error"].(string), "overloaded") {
+		t.Errorf("log records = %v", records)
+	}
+}
+
+func TestNewClient_WithLogger(t *testing.T) {
+	t.Setenv("MOCK_FIXTURE", "")
+	t.Setenv("MOCK_RECORD", "")
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client, err := NewClient(Mock, WithLogger(logger), WithLogPrompts(), WithCache(NewMemoryCache(CacheConfig{})))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close()
+
+	if _, ok := client.(*LoggingClient); !ok {
+		t.Fatalf("NewClient() = %T, want *LoggingClient", client)
+	}
+	req := Request{System: assistant, Prompts: []string{"hello"}, Model: "mock"}
+	for range 2 {
+		if _, err := Query(context.Background(), client, req); err != nil {
+			t.Fatalf("Query() error = %v", err)
+		}
+	}
+	// the logger is outside the cache, so the hit is logged with its metadata
+	records := logRecords(t, &buf)
+	if len(records) != 4 {
+		t.Fatalf("log records = %d, want 4", len(records))
+	}
+	metadata, _ := records[3]["metadata"].(map[string]any)
+	if metadata[MetadataCache] != CacheHitExact {
+		t.Errorf("cache hit record = %v", records[3])
+	}
+	if prompts, _ := records[0]["prompt_text"].([]any); len(prompts) != 1 || prompts[0] != "hello" {
+		t.Errorf("prompt_text = %v, want logged prompts", records[0]["prompt_text"])
+	}
+}
+
+// mustJSON returns the json encoding of v
+func mustJSON(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,141 @@
+// Package sqirvy provides a middleware chain for clients.
+//
+// This file defines Middleware, a function that intercepts a query on its way
+// to a client: it sees and can modify the request before it is sent, and the
+// response or error after it returns. Chain composes a Client with middlewares.
+// The built-in wrappers, such as CachedClient and RateLimitedClient, are each a
+// client composed with one middleware, which is also available on its own, such
+// as CacheMiddleware and RateLimitMiddleware, so built-in and custom behavior
+// compose the same way.
+package sqirvy
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Handler sends a request and returns its response.
+type Handler func(ctx context.Context, req Request) (*Response, error)
+
+// Middleware intercepts a query. It can change the request and context before
+// calling next, change the response or error that next returns, or answer without
+// calling next, as a cache does.
+type Middleware func(ctx context.Context, req Request, next Handler) (*Response, error)
+
+// ClientHandler returns a Handler that sends requests with client.
+func ClientHandler(client Client) Handler {
+	return func(ctx context.Context, req Request) (*Response, error) {
+		return Query(ctx, client, req)
+	}
+}
+
+// chainHandler returns a Handler that sends requests through the middlewares,
+// the first outermost, and then to next
+func chainHandler(next Handler, middlewares []Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		middleware, inner := middlewares[i], next
+		next = func(ctx context.Context, req Request) (*Response, error) {
+			return middleware(ctx, req, inner)
+		}
+	}
+	return next
+}
+
+// MiddlewareClient is a Client that sends queries through a chain of middlewares.
+type MiddlewareClient struct {
+	client  Client
+	handler Handler
+}
+
+// Ensure MiddlewareClient implements the Client and Querier interfaces
+var (
+	_ Client  = (*MiddlewareClient)(nil)
+	_ Querier = (*MiddlewareClient)(nil)
+)
+
+// Chain returns a client that sends each query through the middlewares in order,
+// the first one outermost, and then to client.
+func Chain(client Client, middlewares ...Middleware) *MiddlewareClient {
+	return &MiddlewareClient{client: client, handler: chainHandler(ClientHandler(client), middlewares)}
+}
+
+// QueryText sends the query through the middlewares.
+func (c *MiddlewareClient) QueryText(ctx context.Context, system string, prompts []string, model string, options Options) (string, error) {
+	return queryText(ctx, c, system, prompts, model, options)
+}
+
+// Query implements the Querier interface.
+func (c *MiddlewareClient) Query(ctx context.Context, req Request) (*Response, error) {
+	return c.handler(ctx, req)
+}
+
+// Close closes the wrapped client.
+func (c *MiddlewareClient) Close() error {
+	return c.client.Close()
+}
+
+// WithMiddleware makes NewClient send each query through the middlewares, in order,
+// before the wrappers configured by the other options.
+func WithMiddleware(middlewares ...Middleware) ClientOption {
+	return func(c *clientConfig) {
+		c.middlewares = append(c.middlewares, middlewares...)
+	}
+}
+
+// RetryMiddleware returns a middleware that sends a request again when it fails
+// with a retryable error, see IsRetryable, up to attempts times in total. It waits
+// backoff before the first retry and doubles the wait before each later one.
+// Streamed chunks of a failed attempt are not taken back, so a StreamFunc may
+// receive the start of a response more than once.
+func RetryMiddleware(attempts int, backoff time.Duration) Middleware {
+	return func(ctx context.Context, req Request, next Handler) (*Response, error) {
+		for attempt := 1; ; attempt++ {
+			resp, err := next(ctx, req)
+			if err == nil || attempt >= attempts || !IsRetryable(err) {
+				return resp, err
+			}
+			select {
+			case <-ctx.Done():
+				return nil, err
+			case <-time.After(backoff << (attempt - 1)):
+			}
+		}
+	}
+}
+
+// requestHeaderKey is the context key of the http headers added to provider requests
+type requestHeaderKey struct{}
+
+// WithRequestHeader returns a context that adds an http header to the provider
+// requests of queries sent with it. A middleware can use it to inject headers.
+// The Anthropic, OpenAI, DeepSeek and Gemini clients send the headers.
+func WithRequestHeader(ctx context.Context, key, value string) context.Context {
+	header, _ := ctx.Value(requestHeaderKey{}).(http.Header)
+	header = header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Add(key, value)
+	return context.WithValue(ctx, requestHeaderKey{}, header)
+}
+
+// headerTransport adds the headers set with WithRequestHeader to requests
+type headerTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	header, _ := req.Context().Value(requestHeaderKey{}).(http.Header)
+	if len(header) == 0 {
+		return t.next.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	return t.next.RoundTrip(req)
+}
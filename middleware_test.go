@@ -0,0 +1,192 @@
+package sqirvy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmh2000/sqirvy-llmclient/sqirvytest"
+)
+
+// recordMiddleware returns a middleware that appends its name to calls before and
+// after the query and tags the prompt and response with it
+func recordMiddleware(name string, calls *[]string) Middleware {
+	return func(ctx context.Context, req Request, next Handler) (*Response, error) {
+		*calls = append(*calls, name+" before")
+		req.Prompts = append([]string{name}, req.Prompts...)
+		resp, err := next(ctx, req)
+		*calls = append(*calls, name+" after")
+		if err != nil {
+			return nil, err
+		}
+		resp.Text += " " + name
+		return resp, nil
+	}
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	mock := NewMockClientWithResponses(MockResponse{Text: "answer"})
+	client := Chain(mock, recordMiddleware("outer", &calls), recordMiddleware("inner", &calls))
+
+	text, err := client.QueryText(context.Background(), assistant, []string{"question"}, "mock", Options{})
+	if err != nil {
+		t.Fatalf("QueryText() error = %v", err)
+	}
+	if text != "answer inner outer" {
+		t.Errorf("QueryText() = %q, want %q", text, "answer inner outer")
+	}
+	want := []string{"outer before", "inner before", "inner after", "outer after"}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+	if got := strings.Join(mock.Requests()[0].Prompts, ","); got != "inner,outer,question" {
+		t.Errorf("client prompts = %s, want inner,outer,question", got)
+	}
+}
+
+func TestChain_ShortCircuit(t *testing.T) {
+	mock := NewMockClientWithResponses(MockResponse{Text: "answer"})
+	blocked := errors.New("blocked")
+	client := Chain(mock, func(ctx context.Context, req Request, next Handler) (*Response, error) {
+		if strings.Contains(strings.Join(req.Prompts, " "), "secret") {
+			return nil, blocked
+		}
+		return next(ctx, req)
+	})
+
+	if _, err := client.QueryText(context.Background(), assistant, []string{"the secret"}, "mock", Options{}); !errors.Is(err, blocked) {
+		t.Errorf("QueryText() error = %v, want %v", err, blocked)
+	}
+	if n := len(mock.Requests()); n != 0 {
+		t.Errorf("client requests = %d, want 0", n)
+	}
+	if _, err := client.QueryText(context.Background(), assistant, []string{"hello"}, "mock", Options{}); err != nil {
+		t.Errorf("QueryText() error = %v", err)
+	}
+}
+
+func TestChain_BuiltinMiddleware(t *testing.T) {
+	mock := NewMockClientWithResponses(MockResponse{Text: "answer"})
+	var calls []string
+	client := Chain(mock, recordMiddleware("outer", &calls), CacheMiddleware(Mock, NewMemoryCache(CacheConfig{})))
+
+	req := Request{System: assistant, Prompts: []string{"question"}, Model: "mock"}
+	for range 2 {
+		if _, err := client.Query(context.Background(), req); err != nil {
+			t.Fatalf("Query() error = %v", err)
+		}
+	}
+	if n := len(mock.Requests()); n != 1 {
+		t.Errorf("client requests = %d, want 1", n)
+	}
+	if len(calls) != 4 {
+		t.Errorf("calls = %v, want the outer middleware on both queries", calls)
+	}
+}
+
+func TestRetryMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		errs      []error
+		attempts  int
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "Success", attempts: 3, wantCalls: 1},
+		{name: "Retried", errs: []error{ErrCircuitOpen, ErrCircuitOpen}, attempts: 3, wantCalls: 3},
+		{name: "Exhausted", errs: []error{ErrCircuitOpen, ErrCircuitOpen, ErrCircuitOpen}, attempts: 2, wantCalls: 2, wantErr: true},
+		{name: "Not retryable", errs: []error{errors.New("invalid request")}, attempts: 3, wantCalls: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			next := func(ctx context.Context, req Request) (*Response, error) {
+				calls++
+				if calls <= len(tt.errs) {
+					return nil, tt.errs[calls-1]
+				}
+				return &Response{Text: "ok"}, nil
+			}
+			resp, err := RetryMiddleware(tt.attempts, time.Millisecond)(context.Background(), Request{}, next)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && resp.Text != "ok" {
+				t.Errorf("response = %+v", resp)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryMiddleware_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	next := func(ctx context.Context, req Request) (*Response, error) {
+		cancel()
+		return nil, ErrCircuitOpen
+	}
+	start := time.Now()
+	if _, err := RetryMiddleware(3, time.Minute)(ctx, Request{}, next); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("error = %v, want %v", err, ErrCircuitOpen)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("canceled retry waited %v", elapsed)
+	}
+}
+
+func TestNewClient_WithMiddleware(t *testing.T) {
+	t.Setenv("MOCK_FIXTURE", "")
+	t.Setenv("MOCK_RECORD", "")
+	var hits []string
+	client, err := NewClient(Mock, WithCache(NewMemoryCache(CacheConfig{})),
+		WithMiddleware(func(ctx context.Context, req Request, next Handler) (*Response, error) {
+			resp, err := next(ctx, req)
+			if err == nil {
+				hits = append(hits, resp.Metadata[MetadataCache])
+			}
+			return resp, err
+		}))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close()
+
+	if _, ok := client.(*MiddlewareClient); !ok {
+		t.Fatalf("NewClient() = %T, want *MiddlewareClient", client)
+	}
+	req := Request{System: assistant, Prompts: []string{"hello"}, Model: "mock"}
+	for range 2 {
+		if _, err := Query(context.Background(), client, req); err != nil {
+			t.Fatalf("Query() error = %v", err)
+		}
+	}
+	// the middleware is outside the cache, so it sees the hit
+	if len(hits) != 2 || hits[0] != "" || hits[1] != CacheHitExact {
+		t.Errorf("cache metadata = %q, want miss then hit", hits)
+	}
+}
+
+func TestWithRequestHeader(t *testing.T) {
+	srv := sqirvytest.NewAnthropicServer(t)
+	srv.Setenv(t)
+	client, err := NewClient(Anthropic, WithMiddleware(func(ctx context.Context, req Request, next Handler) (*Response, error) {
+		ctx = WithRequestHeader(ctx, "X-Request-Id", "42")
+		return next(WithRequestHeader(ctx, "X-Request-Id", "43"), req)
+	}))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.QueryText(context.Background(), assistant, []string{"hello"}, "claude-sonnet-4-20250514", Options{}); err != nil {
+		t.Fatalf("QueryText() error = %v", err)
+	}
+	if got := srv.LastRequest().Header.Values("X-Request-Id"); strings.Join(got, ",") != "42,43" {
+		t.Errorf("X-Request-Id = %v, want [42 43]", got)
+	}
+}
@@ -0,0 +1,93 @@
+// Package sqirvy provides integration with Mistral AI models via langchaingo.
+//
+// This file implements the Client interface for Mistral models using
+// langchaingo's native Mistral provider. It handles authentication,
+// temperature scaling and model validation specific to the Mistral API.
+package sqirvy
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/mistral"
+)
+
+// Mistral accepts temperatures in the range 0.0-1.5
+const mistral_temperature_scale = 1.5
+
+// MistralClient implements the Client interface for Mistral AI models.
+// It provides methods for querying Mistral language models through
+// the langchaingo library.
+type MistralClient struct {
+	llm              llms.Model // langchaingo LLM client
+	temperatureScale float32
+}
+
+// Ensure MistralClient implements the Client interface
+var _ Client = (*MistralClient)(nil)
+
+// NewMistralClient creates a new instance of MistralClient using langchaingo.
+// It returns an error if the required MISTRAL_API_KEY environment variable is not set.
+//
+// The API key is retrieved from the MISTRAL_API_KEY environment variable.
+// The optional MISTRAL_BASE_URL environment variable overrides the API endpoint.
+// The underlying Mistral SDK does not accept a custom http client, so ClientOptions
+// are accepted for consistency but have no effect.
+func NewMistralClient(opts ...ClientOption) (*MistralClient, error) {
+	apiKey := os.Getenv("MISTRAL_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("MISTRAL_API_KEY environment variable not set")
+	}
+	if len(apiKey) < 20 {
+		return nil, fmt.Errorf("invalid MISTRAL_API_KEY: key appears to be too short")
+	}
+
+	llmOptions := []mistral.Option{mistral.WithAPIKey(apiKey)}
+	if baseURL := os.Getenv("MISTRAL_BASE_URL"); baseURL != "" {
+		llmOptions = append(llmOptions, mistral.WithEndpoint(baseURL))
+	}
+
+	llm, err := mistral.New(llmOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Mistral client: %w", err)
+	}
+
+	return &MistralClient{
+		llm:              llm,
+		temperatureScale: mistral_temperature_scale, // Default temperature scale for Mistral
+	}, nil
+}
+
+// QueryText sends a text query to the specified Mistral model using langchaingo and returns the response.
+//
+// It takes a context, system prompt, a list of prompts, the model name, and options as input.
+// It returns the generated text or an error if the query fails or the model is invalid.
+func (c *MistralClient) QueryText(ctx context.Context, system string, prompts []string, model string, options Options) (string, error) {
+	return queryText(ctx, c, system, prompts, model, options)
+}
+
+// Query implements the Querier interface. It works like QueryText and also
+// returns the stop reason and token usage reported by Mistral.
+func (c *MistralClient) Query(ctx context.Context, req Request) (*Response, error) {
+	provider, err := GetProviderName(req.Model)
+	if err != nil || provider != Mistral {
+		return nil, fmt.Errorf("invalid or unsupported Mistral model: %s", req.Model)
+	}
+
+	// scale the temperature
+	options := req.Options
+	options.Temperature = options.Temperature * c.temperatureScale
+	options.MaxTokens = GetMaxTokens(req.Model)
+	return queryLangChain(ctx, c.llm, Mistral, req.System, req.History, req.Prompts, req.Model, options)
+}
+
+// Close implements the Close method for the Client interface.
+//
+// For the Mistral client, this method does not require any action as the
+// underlying langchaingo client does not need to be explicitly closed.
+func (c *MistralClient) Close() error {
+	// the langchaingo llm does not require explicit close
+	return nil
+}
@@ -0,0 +1,63 @@
+package sqirvy
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestMistralClient_QueryText(t *testing.T) {
+	if os.Getenv("MISTRAL_API_KEY") == "" {
+		t.Skip("MISTRAL_API_KEY not set")
+	}
+
+	client, err := NewMistralClient()
+	if err != nil {
+		t.Fatalf("new client failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		prompt  []string
+		model   string
+		wantErr bool
+	}{
+		{
+			name:    "Basic prompt",
+			prompt:  []string{"Say 'Hello, World!'"},
+			model:   "mistral-large-latest",
+			wantErr: false,
+		},
+		{
+			name:    "Empty prompt",
+			prompt:  []string{},
+			model:   "mistral-large-latest",
+			wantErr: true,
+		},
+		{
+			name:    "Wrong provider model",
+			prompt:  []string{"Say 'Hello, World!'"},
+			model:   "gpt-5-mini",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := client.QueryText(context.Background(), assistant, tt.prompt, tt.model, Options{Temperature: 0.5})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("MistralClient.QueryText() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("MistralClient.QueryText() error = %v", err)
+				return
+			}
+			if len(got) == 0 {
+				t.Error("MistralClient.QueryText() returned empty response")
+			}
+		})
+	}
+}
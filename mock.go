@@ -0,0 +1,281 @@
+// Package sqirvy provides a deterministic mock provider for offline testing.
+//
+// This file implements the Client interface with scripted responses. The mock
+// client never makes network requests. It records every request it receives so
+// tests can assert on the exact system prompt, prompts, model and options, and
+// it can simulate errors, latency, truncated responses and streaming.
+package sqirvy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// default number of bytes per chunk when streaming a mock response
+const mockChunkSize = 16
+
+// MockResponse is a scripted response returned by MockClient.
+type MockResponse struct {
+	// Match, if set, selects this response when the combined prompts contain the string.
+	// Responses without Match are returned in order, and the last one repeats.
+	Match string `json:"match,omitempty"`
+	// Text is the response text
+	Text string `json:"text,omitempty"`
+	// Error, if set, causes the query to fail with this message
+	Error string `json:"error,omitempty"`
+	// LatencyMS delays the response by this many milliseconds
+	LatencyMS int `json:"latency_ms,omitempty"`
+	// Truncate, if greater than zero, cuts the response text to this many bytes
+	// to simulate a response that hit the output token limit
+	Truncate int `json:"truncate,omitempty"`
+	// ChunkSize is the number of bytes per chunk when streaming (default 16)
+	ChunkSize int `json:"chunk_size,omitempty"`
+	// StopReason, if set, replaces the stop reason of the response, e.g. content_filter
+	StopReason string `json:"stop_reason,omitempty"`
+}
+
+// MockRequest is a request recorded by MockClient.
+type MockRequest struct {
+	System  string    `json:"system"`
+	History []Message `json:"history,omitempty"`
+	Prompts []string  `json:"prompts"`
+	Model   string    `json:"model"`
+	Options Options   `json:"options"`
+}
+
+// mockFixture is the file format read by LoadMockFixture
+type mockFixture struct {
+	Responses []MockResponse `json:"responses"`
+}
+
+// ErrMockClosed is returned when querying a MockClient after Close.
+var ErrMockClosed = errors.New("mock client is closed")
+
+// MockClient implements the Client interface with scripted responses.
+// It is safe for concurrent use.
+type MockClient struct {
+	mu         sync.Mutex
+	responses  []MockResponse
+	next       int           // index of the next unmatched response
+	requests   []MockRequest // requests received, in order
+	recordFile string        // optional JSONL file that requests are appended to
+	closed     bool
+}
+
+// Ensure MockClient implements the Client interface
+var _ Client = (*MockClient)(nil)
+
+// NewMockClient creates a new instance of MockClient.
+//
+// The optional MOCK_FIXTURE environment variable names a JSON fixture file of
+// scripted responses (see LoadMockFixture). If it is not set, the mock echoes
+// the prompts it receives. The optional MOCK_RECORD environment variable names
+// a JSONL file that each received request is appended to, so that requests made
+// by another process such as sqirvy-cli can be inspected.
+func NewMockClient() (*MockClient, error) {
+	var responses []MockResponse
+	if fixture := os.Getenv("MOCK_FIXTURE"); fixture != "" {
+		var err error
+		responses, err = LoadMockFixture(fixture)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	client := NewMockClientWithResponses(responses...)
+	client.recordFile = os.Getenv("MOCK_RECORD")
+	return client, nil
+}
+
+// NewMockClientWithResponses creates a MockClient that returns the given scripted responses.
+func NewMockClientWithResponses(responses ...MockResponse) *MockClient {
+	return &MockClient{responses: responses}
+}
+
+// LoadMockFixture reads scripted responses from a JSON fixture file of the form
+//
+//	{"responses": [{"text": "hello"}, {"match": "fail", "error": "overloaded"}]}
+func LoadMockFixture(path string) ([]MockResponse, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mock fixture %s: %w", path, err)
+	}
+
+	var fixture mockFixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("invalid mock fixture %s: %w", path, err)
+	}
+	return fixture.Responses, nil
+}
+
+// QueryText records the request and returns the next scripted response.
+//
+// Like the other clients, it returns an error if prompts is empty or the context is done.
+// Latency waits are interrupted by context cancellation.
+func (c *MockClient) QueryText(ctx context.Context, system string, prompts []string, model string, options Options) (string, error) {
+	return queryText(ctx, c, system, prompts, model, options)
+}
+
+// Query implements the Querier interface. It works like QueryText and also
+// returns a stop reason of "max_tokens" for truncated responses, and a token
+// usage estimated at four bytes per token.
+func (c *MockClient) Query(ctx context.Context, req Request) (*Response, error) {
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("request context error %w", ctx.Err())
+	}
+
+	if len(req.Prompts) == 0 {
+		return nil, fmt.Errorf("prompts cannot be empty for text query")
+	}
+
+	options := req.Options
+	response, err := c.record(MockRequest{
+		System:  req.System,
+		History: append([]Message(nil), req.History...),
+		Prompts: append([]string(nil), req.Prompts...),
+		Model:   req.Model,
+		Options: options,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if response.LatencyMS > 0 {
+		timer := time.NewTimer(time.Duration(response.LatencyMS) * time.Millisecond)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("request context error %w", ctx.Err())
+		case <-timer.C:
+		}
+	}
+
+	if response.Error != "" {
+		return nil, fmt.Errorf("failed to generate completion: %s", response.Error)
+	}
+
+	text := response.Text
+	stopReason := "end_turn"
+	if response.Truncate > 0 && response.Truncate < len(text) {
+		text = text[:response.Truncate]
+		stopReason = "max_tokens"
+	}
+	if response.StopReason != "" {
+		stopReason = response.StopReason
+	}
+
+	if options.StreamFunc != nil {
+		size := response.ChunkSize
+		if size <= 0 {
+			size = mockChunkSize
+		}
+		for i := 0; i < len(text); i += size {
+			end := min(i+size, len(text))
+			if err := options.StreamFunc(ctx, []byte(text[i:end])); err != nil {
+				return nil, fmt.Errorf("failed to generate completion: %w", err)
+			}
+		}
+	}
+
+	return &Response{
+		Text:       text,
+		Provider:   Mock,
+		Model:      req.Model,
+		StopReason: stopReason,
+		Usage:      Usage{InputTokens: estimateRequestTokens(req), OutputTokens: EstimateTokens(text)},
+	}, nil
+}
+
+// record stores the request and selects the response for it
+func (c *MockClient) record(req MockRequest) (MockResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return MockResponse{}, ErrMockClosed
+	}
+
+	c.requests = append(c.requests, req)
+	if c.recordFile != "" {
+		// the api key is not written to the file
+		recorded := req
+		recorded.Options.APIKey = ""
+		if err := appendJSONLine(c.recordFile, recorded); err != nil {
+			return MockResponse{}, fmt.Errorf("failed to record mock request: %w", err)
+		}
+	}
+
+	// a matching response takes priority
+	combined := strings.Join(req.Prompts, "\n")
+	for _, r := range c.responses {
+		if r.Match != "" && strings.Contains(combined, r.Match) {
+			return r, nil
+		}
+	}
+
+	// otherwise use the unmatched responses in order, repeating the last one
+	var unmatched []MockResponse
+	for _, r := range c.responses {
+		if r.Match == "" {
+			unmatched = append(unmatched, r)
+		}
+	}
+	if len(unmatched) == 0 {
+		// no script, echo the prompts
+		return MockResponse{Text: combined}, nil
+	}
+	r := unmatched[min(c.next, len(unmatched)-1)]
+	c.next++
+	return r, nil
+}
+
+// Requests returns a copy of the requests received so far, in order.
+func (c *MockClient) Requests() []MockRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]MockRequest(nil), c.requests...)
+}
+
+// LastRequest returns the most recent request received.
+// It returns false if no request has been received.
+func (c *MockClient) LastRequest() (MockRequest, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.requests) == 0 {
+		return MockRequest{}, false
+	}
+	return c.requests[len(c.requests)-1], true
+}
+
+// Close implements the Close method for the Client interface.
+// Queries made after Close return ErrMockClosed.
+func (c *MockClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+// appendJSONLine appends v to a JSONL file, creating it if needed
+func appendJSONLine(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,156 @@
+package sqirvy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMockClient_QueryText(t *testing.T) {
+	client := NewMockClientWithResponses(
+		MockResponse{Text: "first"},
+		MockResponse{Text: "second"},
+		MockResponse{Match: "fail", Error: "overloaded"},
+		MockResponse{Match: "long", Text: "0123456789", Truncate: 4},
+	)
+
+	tests := []struct {
+		name    string
+		prompt  []string
+		want    string
+		wantErr bool
+	}{
+		{name: "First response", prompt: []string{"hello"}, want: "first"},
+		{name: "Second response", prompt: []string{"hello"}, want: "second"},
+		{name: "Last response repeats", prompt: []string{"hello"}, want: "second"},
+		{name: "Matched error", prompt: []string{"please fail"}, wantErr: true},
+		{name: "Truncated", prompt: []string{"a long answer"}, want: "0123"},
+		{name: "Empty prompt", prompt: []string{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := client.QueryText(context.Background(), assistant, tt.prompt, "mock", Options{Temperature: 0.5})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("MockClient.QueryText() error = nil, wantErr %v", tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("MockClient.QueryText() error = %v", err)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("MockClient.QueryText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMockClient_RecordsRequests(t *testing.T) {
+	client := NewMockClientWithResponses()
+	prompts := []string{"one", "two"}
+
+	got, err := client.QueryText(context.Background(), assistant, prompts, "mock", Options{Temperature: 0.25, MaxTokens: 100})
+	if err != nil {
+		t.Fatalf("MockClient.QueryText() error = %v", err)
+	}
+	if got != "one\ntwo" {
+		t.Errorf("MockClient.QueryText() = %q, want echo of prompts", got)
+	}
+
+	req, ok := client.LastRequest()
+	if !ok {
+		t.Fatal("LastRequest() returned no request")
+	}
+	if req.System != assistant || req.Model != "mock" || strings.Join(req.Prompts, ",") != "one,two" {
+		t.Errorf("LastRequest() = %+v", req)
+	}
+	if req.Options.Temperature != 0.25 || req.Options.MaxTokens != 100 {
+		t.Errorf("LastRequest().Options = %+v", req.Options)
+	}
+	if len(client.Requests()) != 1 {
+		t.Errorf("Requests() returned %d requests, want 1", len(client.Requests()))
+	}
+}
+
+func TestMockClient_Streaming(t *testing.T) {
+	client := NewMockClientWithResponses(MockResponse{Text: "hello streaming world", ChunkSize: 5})
+
+	var chunks []string
+	options := Options{StreamFunc: func(ctx context.Context, chunk []byte) error {
+		chunks = append(chunks, string(chunk))
+		return nil
+	}}
+	got, err := client.QueryText(context.Background(), assistant, []string{"hi"}, "mock", options)
+	if err != nil {
+		t.Fatalf("MockClient.QueryText() error = %v", err)
+	}
+	if len(chunks) != 5 {
+		t.Errorf("received %d chunks, want 5", len(chunks))
+	}
+	if strings.Join(chunks, "") != got {
+		t.Errorf("streamed %q, returned %q", strings.Join(chunks, ""), got)
+	}
+}
+
+func TestMockClient_LatencyCancel(t *testing.T) {
+	client := NewMockClientWithResponses(MockResponse{Text: "slow", LatencyMS: 5000})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := client.QueryText(ctx, assistant, []string{"hi"}, "mock", Options{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("MockClient.QueryText() error = %v, want deadline exceeded", err)
+	}
+}
+
+func TestMockClient_Fixture(t *testing.T) {
+	dir := t.TempDir()
+	fixture := filepath.Join(dir, "fixture.json")
+	record := filepath.Join(dir, "record.jsonl")
+	err := os.WriteFile(fixture, []byte(`{"responses": [{"text": "from fixture"}]}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MOCK_FIXTURE", fixture)
+	t.Setenv("MOCK_RECORD", record)
+
+	client, err := NewClient(Mock)
+	if err != nil {
+		t.Fatalf("new client failed: %v", err)
+	}
+	got, err := client.QueryText(context.Background(), assistant, []string{"hi"}, "mock", Options{APIKey: "secret-key"})
+	if err != nil {
+		t.Fatalf("MockClient.QueryText() error = %v", err)
+	}
+	if got != "from fixture" {
+		t.Errorf("MockClient.QueryText() = %q, want %q", got, "from fixture")
+	}
+
+	data, err := os.ReadFile(record)
+	if err != nil {
+		t.Fatalf("reading record file: %v", err)
+	}
+	var req MockRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		t.Fatalf("decoding record file: %v", err)
+	}
+	if req.System != assistant || req.Prompts[0] != "hi" {
+		t.Errorf("recorded request = %+v", req)
+	}
+	if strings.Contains(string(data), "secret-key") {
+		t.Errorf("record file contains the api key: %s", data)
+	}
+
+	_ = client.Close()
+	if _, err := client.QueryText(context.Background(), assistant, []string{"hi"}, "mock", Options{}); !errors.Is(err, ErrMockClosed) {
+		t.Errorf("MockClient.QueryText() after Close error = %v, want ErrMockClosed", err)
+	}
+}
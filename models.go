@@ -10,6 +10,11 @@ var modelAlias = map[string]string{
 	"claude-sonnet-4":  "claude-sonnet-4-20250514",
 	"claude-opus-4-1":  "claude-opus-4-1-20250805",
 	"claude-3-5-haiku": "claude-3-5-haiku-20241022",
+	"mistral-large":    "mistral-large-latest",
+	"mistral-medium":   "mistral-medium-latest",
+	"codestral":        "codestral-latest",
+	"deepseek-v3":      "deepseek-chat",
+	"deepseek-r1":      "deepseek-reasoner",
 }
 
 // Supported AI providers
@@ -17,6 +22,10 @@ const (
 	Anthropic string = "anthropic" // Anthropic's Claude models
 	Gemini    string = "gemini"    // Google's Gemini models
 	OpenAI    string = "openai"    // OpenAI's GPT models
+	Vertex    string = "vertex"    // Google Cloud Vertex AI (Gemini and Claude models)
+	Mistral   string = "mistral"   // Mistral AI models
+	DeepSeek  string = "deepseek"  // DeepSeek models
+	Mock      string = "mock"      // Scripted responses for offline testing
 )
 
 // modelRegistry consolidates provider and token information for each model
@@ -28,20 +37,32 @@ const (
 type ModelInfo struct {
 	Provider        string
 	MaxOutputTokens int64
+	ContextWindow   int64   // maximum input and output tokens
+	InputPrice      float64 // USD per million input tokens
+	OutputPrice     float64 // USD per million output tokens
 }
 
 // modelRegistry is the single source of truth for model information
 var modelRegistry = map[string]ModelInfo{
 	// anthropic models
-	"claude-sonnet-4-20250514":  {Provider: Anthropic, MaxOutputTokens: 64000},
-	"claude-opus-4-1-20250805":  {Provider: Anthropic, MaxOutputTokens: 32000},
-	"claude-3-5-haiku-20241022": {Provider: Anthropic, MaxOutputTokens: 8096},
+	"claude-sonnet-4-20250514":  {Provider: Anthropic, MaxOutputTokens: 64000, ContextWindow: 200000, InputPrice: 3.00, OutputPrice: 15.00},
+	"claude-opus-4-1-20250805":  {Provider: Anthropic, MaxOutputTokens: 32000, ContextWindow: 200000, InputPrice: 15.00, OutputPrice: 75.00},
+	"claude-3-5-haiku-20241022": {Provider: Anthropic, MaxOutputTokens: 8096, ContextWindow: 200000, InputPrice: 0.80, OutputPrice: 4.00},
 	// google gemini models
-	"gemini-2.5-pro":   {Provider: Gemini, MaxOutputTokens: 64000},
-	"gemini-2.5-flash": {Provider: Gemini, MaxOutputTokens: 64000},
+	"gemini-2.5-pro":   {Provider: Gemini, MaxOutputTokens: 64000, ContextWindow: 1048576, InputPrice: 1.25, OutputPrice: 10.00},
+	"gemini-2.5-flash": {Provider: Gemini, MaxOutputTokens: 64000, ContextWindow: 1048576, InputPrice: 0.30, OutputPrice: 2.50},
 	// openai models
-	"gpt-5":      {Provider: OpenAI, MaxOutputTokens: 64000},
-	"gpt-5-mini": {Provider: OpenAI, MaxOutputTokens: 64000},
+	"gpt-5":      {Provider: OpenAI, MaxOutputTokens: 64000, ContextWindow: 400000, InputPrice: 1.25, OutputPrice: 10.00},
+	"gpt-5-mini": {Provider: OpenAI, MaxOutputTokens: 64000, ContextWindow: 400000, InputPrice: 0.25, OutputPrice: 2.00},
+	// mistral models
+	"mistral-large-latest":  {Provider: Mistral, MaxOutputTokens: 32768, ContextWindow: 128000, InputPrice: 2.00, OutputPrice: 6.00},
+	"mistral-medium-latest": {Provider: Mistral, MaxOutputTokens: 32768, ContextWindow: 128000, InputPrice: 0.40, OutputPrice: 2.00},
+	"codestral-latest":      {Provider: Mistral, MaxOutputTokens: 32768, ContextWindow: 256000, InputPrice: 0.30, OutputPrice: 0.90},
+	// deepseek models
+	"deepseek-chat":     {Provider: DeepSeek, MaxOutputTokens: 8192, ContextWindow: 128000, InputPrice: 0.27, OutputPrice: 1.10},
+	"deepseek-reasoner": {Provider: DeepSeek, MaxOutputTokens: 65536, ContextWindow: 128000, InputPrice: 0.55, OutputPrice: 2.19},
+	// mock model for offline testing
+	"mock": {Provider: Mock, MaxOutputTokens: MAX_TOKENS_DEFAULT, ContextWindow: 200000},
 }
 
 // ModelToMaxTokens maps model names to their maximum token limits.
@@ -98,6 +119,62 @@ func GetProviderName(model string) (string, error) {
 	return "", fmt.Errorf("unrecognized model: %s", model)
 }
 
+// GetModelInfo returns the registry information for a model.
+// Returns an error if the model is not recognized.
+func GetModelInfo(model string) (ModelInfo, error) {
+	if info, ok := modelRegistry[model]; ok {
+		return info, nil
+	}
+	return ModelInfo{}, fmt.Errorf("unrecognized model: %s", model)
+}
+
+// promptCachePrice holds the price of prompt cache reads and writes of a provider
+// as a multiple of its input price
+type promptCachePrice struct {
+	read  float64
+	write float64
+}
+
+// promptCachePrices holds the prompt cache prices of the providers with prompt caching
+var promptCachePrices = map[string]promptCachePrice{
+	Anthropic: {read: 0.1, write: 1.25},
+	OpenAI:    {read: 0.1, write: 1},
+	Gemini:    {read: 0.25, write: 1},
+	DeepSeek:  {read: 0.25, write: 1},
+}
+
+// EstimateCost returns the estimated cost in USD of a query to a model with the
+// given token usage. Input tokens read from or written to the prompt cache are
+// priced at the provider cache prices. It returns 0 for models that are not in
+// the registry.
+func EstimateCost(model string, usage Usage) float64 {
+	info := modelRegistry[model]
+	input := float64(usage.InputTokens)
+	if price, ok := promptCachePrices[info.Provider]; ok {
+		cached := float64(usage.CacheReadTokens + usage.CacheWriteTokens)
+		input += float64(usage.CacheReadTokens)*price.read + float64(usage.CacheWriteTokens)*price.write - cached
+	}
+	return (input*info.InputPrice + float64(usage.OutputTokens)*info.OutputPrice) / 1e6
+}
+
+// EstimateTokens returns a rough estimate of the number of tokens in text,
+// using four bytes per token.
+func EstimateTokens(text string) int64 {
+	return int64(len(text)+3) / 4
+}
+
+// estimateRequestTokens returns a rough estimate of the input tokens of a request
+func estimateRequestTokens(req Request) int64 {
+	tokens := EstimateTokens(req.System)
+	for _, message := range req.History {
+		tokens += EstimateTokens(message.Text)
+	}
+	for _, prompt := range req.Prompts {
+		tokens += EstimateTokens(prompt)
+	}
+	return tokens
+}
+
 // GetMaxTokensWithError returns the maximum token limit for a given model identifier
 // along with an error if the model is not recognized.
 // This function provides more detailed error reporting compared to GetMaxTokens.
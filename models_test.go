@@ -33,12 +33,6 @@ func TestAllModels(t *testing.T) {
 	// Test each model from modelRegistry
 	for model, info := range modelRegistry {
 		provider := info.Provider
-		// Create client for this provider
-		client, err := NewClient(provider)
-		if err != nil {
-			t.Errorf("Failed to create client for provider %s: %v", provider, err)
-			continue
-		}
 
 		// Check if required API key is set
 		var apiKey string
@@ -49,6 +43,13 @@ func TestAllModels(t *testing.T) {
 			apiKey = os.Getenv("GEMINI_API_KEY")
 		case "openai":
 			apiKey = os.Getenv("OPENAI_API_KEY")
+		case "mistral":
+			apiKey = os.Getenv("MISTRAL_API_KEY")
+		case "deepseek":
+			apiKey = os.Getenv("DEEPSEEK_API_KEY")
+		case "mock":
+			// the mock provider does not need an api key
+			apiKey = "mock"
 		}
 
 		if apiKey == "" {
@@ -56,6 +57,13 @@ func TestAllModels(t *testing.T) {
 			continue
 		}
 
+		// Create client for this provider
+		client, err := NewClient(provider)
+		if err != nil {
+			t.Errorf("Failed to create client for provider %s: %v", provider, err)
+			continue
+		}
+
 		// Test QueryText
 		t.Run(model+"_QueryText", func(t *testing.T) {
 			for _, tt := range tests {
@@ -81,3 +89,31 @@ func TestAllModels(t *testing.T) {
 		})
 	}
 }
+
+func TestGetModelAlias(t *testing.T) {
+	tests := []struct {
+		alias    string
+		want     string
+		provider string
+	}{
+		{"claude-sonnet-4", "claude-sonnet-4-20250514", Anthropic},
+		{"mistral-large", "mistral-large-latest", Mistral},
+		{"codestral", "codestral-latest", Mistral},
+		{"deepseek-v3", "deepseek-chat", DeepSeek},
+		{"deepseek-r1", "deepseek-reasoner", DeepSeek},
+	}
+
+	for _, tt := range tests {
+		got := GetModelAlias(tt.alias)
+		if got != tt.want {
+			t.Errorf("GetModelAlias(%s) = %s, want %s", tt.alias, got, tt.want)
+		}
+		provider, err := GetProviderName(got)
+		if err != nil || provider != tt.provider {
+			t.Errorf("GetProviderName(%s) = %s, %v, want %s", got, provider, err, tt.provider)
+		}
+		if GetMaxTokens(got) == MAX_TOKENS_DEFAULT {
+			t.Errorf("GetMaxTokens(%s) returned the default token limit", got)
+		}
+	}
+}
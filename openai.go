@@ -33,7 +33,9 @@ var _ Client = (*OpenAIClient)(nil)
 // The API key is retrieved from the OPENAI_API_KEY environment variable and
 // the base URL is retrieved from the OPENAI_BASE_URL environment variable.
 // Ensure these variables are set before calling this function.
-func NewOpenAIClient() (*OpenAIClient, error) {
+func NewOpenAIClient(opts ...ClientOption) (*OpenAIClient, error) {
+	config := newClientConfig(opts)
+
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	if apiKey == "" {
 		return nil, fmt.Errorf("OPENAI_API_KEY environment variable not set")
@@ -47,10 +49,13 @@ func NewOpenAIClient() (*OpenAIClient, error) {
 		return nil, fmt.Errorf("OPENAI_BASE_URL environment variable not set")
 	}
 
-	llm, err := openai.New(
+	llmOptions := []openai.Option{
 		openai.WithBaseURL(baseURL),
 		openai.WithToken(apiKey),
-	)
+	}
+	llmOptions = append(llmOptions, openai.WithHTTPClient(providerHTTPClient(OpenAI, config.httpClient)))
+
+	llm, err := openai.New(llmOptions...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create OpenAI client: %w", err)
 	}
@@ -65,12 +70,18 @@ func NewOpenAIClient() (*OpenAIClient, error) {
 // It sends a text query to OpenAI models and returns the generated text response.
 // It returns an error if the query fails or the model is invalid.
 func (c *OpenAIClient) QueryText(ctx context.Context, system string, prompts []string, model string, options Options) (string, error) {
+	return queryText(ctx, c, system, prompts, model, options)
+}
 
+// Query implements the Querier interface. It works like QueryText and also
+// returns the stop reason and token usage reported by the provider.
+func (c *OpenAIClient) Query(ctx context.Context, req Request) (*Response, error) {
 	// scale the temperature
+	options := req.Options
 	options.Temperature = options.Temperature * c.temperatureScale
-	options.MaxTokens = GetMaxTokens(model)
+	options.MaxTokens = GetMaxTokens(req.Model)
 
-	return queryTextLangChain(ctx, c.llm, system, prompts, model, options)
+	return queryLangChain(ctx, c.llm, OpenAI, req.System, req.History, req.Prompts, req.Model, options)
 }
 
 // Close implements the Close method for the Client interface.
@@ -0,0 +1,323 @@
+// Package sqirvy provides OpenAI Batch API support.
+//
+// This file implements BatchJobClient for the OpenAI Batch API. The requests
+// are uploaded as a JSONL file of chat completion requests, and the results
+// are read from the output and error files of the batch.
+package sqirvy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// openaiBatchEndpoint is the endpoint used for each request of a batch
+const openaiBatchEndpoint = "/v1/chat/completions"
+
+// OpenAIBatchClient implements the BatchJobClient interface for the OpenAI Batch API.
+type OpenAIBatchClient struct {
+	http             batchHTTP
+	temperatureScale float32
+}
+
+// Ensure OpenAIBatchClient implements the BatchJobClient interface
+var _ BatchJobClient = (*OpenAIBatchClient)(nil)
+
+// NewOpenAIBatchClient creates a new instance of OpenAIBatchClient.
+// It uses the OPENAI_API_KEY and OPENAI_BASE_URL environment variables,
+// like NewOpenAIClient.
+func NewOpenAIBatchClient(opts ...ClientOption) (*OpenAIBatchClient, error) {
+	config := newClientConfig(opts)
+
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY environment variable not set")
+	}
+	baseURL := os.Getenv("OPENAI_BASE_URL")
+	if baseURL == "" {
+		return nil, fmt.Errorf("OPENAI_BASE_URL environment variable not set")
+	}
+
+	httpClient := config.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &OpenAIBatchClient{
+		http: batchHTTP{
+			client:  httpClient,
+			baseURL: strings.TrimSuffix(baseURL, "/"),
+			header:  http.Header{"Authorization": {"Bearer " + apiKey}},
+		},
+		temperatureScale: openai_temperature_scale,
+	}, nil
+}
+
+// openaiBatch is the Batch api batch object
+type openaiBatch struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"`
+	OutputFileID  string `json:"output_file_id"`
+	ErrorFileID   string `json:"error_file_id"`
+	CreatedAt     int64  `json:"created_at"`
+	CompletedAt   int64  `json:"completed_at"`
+	FailedAt      int64  `json:"failed_at"`
+	CancelledAt   int64  `json:"cancelled_at"`
+	ExpiredAt     int64  `json:"expired_at"`
+	RequestCounts struct {
+		Total     int `json:"total"`
+		Completed int `json:"completed"`
+		Failed    int `json:"failed"`
+	} `json:"request_counts"`
+}
+
+// job converts the batch object to a BatchJob
+func (b openaiBatch) job() *BatchJob {
+	c := b.RequestCounts
+	job := &BatchJob{
+		ID:        b.ID,
+		Provider:  OpenAI,
+		CreatedAt: time.Unix(b.CreatedAt, 0).UTC(),
+		Counts: BatchJobCounts{
+			Total:      c.Total,
+			Processing: max(0, c.Total-c.Completed-c.Failed),
+			Succeeded:  c.Completed,
+			Failed:     c.Failed,
+		},
+	}
+	switch b.Status {
+	case "completed":
+		job.Status = BatchJobEnded
+	case "cancelling":
+		job.Status = BatchJobCancelling
+	case "cancelled":
+		job.Status = BatchJobCancelled
+	case "failed":
+		job.Status = BatchJobFailed
+	case "expired":
+		job.Status = BatchJobExpired
+	default:
+		// validating, in_progress, finalizing
+		job.Status = BatchJobInProgress
+	}
+	for _, t := range []int64{b.CompletedAt, b.FailedAt, b.CancelledAt, b.ExpiredAt} {
+		if t > 0 {
+			job.EndedAt = time.Unix(t, 0).UTC()
+		}
+	}
+	return job
+}
+
+// openaiBatchLine is one line of a Batch api input file
+type openaiBatchLine struct {
+	CustomID string `json:"custom_id"`
+	Method   string `json:"method"`
+	URL      string `json:"url"`
+	Body     struct {
+		Model               string        `json:"model"`
+		Messages            []chatMessage `json:"messages"`
+		MaxCompletionTokens int64         `json:"max_completion_tokens"`
+		Temperature         float32       `json:"temperature"`
+	} `json:"body"`
+}
+
+// SubmitBatch uploads the requests and creates a Batch api job for them.
+func (c *OpenAIBatchClient) SubmitBatch(ctx context.Context, requests []BatchJobRequest) (*BatchJob, error) {
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("batch requests cannot be empty")
+	}
+
+	var input bytes.Buffer
+	for _, r := range requests {
+		if len(r.Prompts) == 0 {
+			return nil, fmt.Errorf("prompts cannot be empty for batch request %s", r.CustomID)
+		}
+		line := openaiBatchLine{CustomID: r.CustomID, Method: http.MethodPost, URL: openaiBatchEndpoint}
+		line.Body.Model = r.Model
+		line.Body.MaxCompletionTokens = batchMaxTokens(r.Request)
+		line.Body.Temperature = r.Options.Temperature * c.temperatureScale
+		if r.System != "" {
+			line.Body.Messages = append(line.Body.Messages, chatMessage{Role: "system", Content: r.System})
+		}
+		for _, message := range r.History {
+			line.Body.Messages = append(line.Body.Messages, chatMessage{Role: message.Role, Content: message.Text})
+		}
+		for _, prompt := range r.Prompts {
+			line.Body.Messages = append(line.Body.Messages, chatMessage{Role: "user", Content: prompt})
+		}
+		data, err := json.Marshal(line)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode batch request %s: %w", r.CustomID, err)
+		}
+		input.Write(append(data, '\n'))
+	}
+
+	fileID, err := c.upload(ctx, input.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]string{
+		"input_file_id":     fileID,
+		"endpoint":          openaiBatchEndpoint,
+		"completion_window": "24h",
+	}
+	var batch openaiBatch
+	if err := c.http.do(ctx, http.MethodPost, "/batches", body, &batch); err != nil {
+		return nil, fmt.Errorf("failed to submit batch: %w", err)
+	}
+	return batch.job(), nil
+}
+
+// upload uploads a batch input file and returns its file id
+func (c *OpenAIBatchClient) upload(ctx context.Context, data []byte) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("purpose", "batch"); err != nil {
+		return "", fmt.Errorf("failed to encode batch file: %w", err)
+	}
+	part, err := form.CreateFormFile("file", "batch.jsonl")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode batch file: %w", err)
+	}
+	if _, err := part.Write(data); err != nil {
+		return "", fmt.Errorf("failed to encode batch file: %w", err)
+	}
+	if err := form.Close(); err != nil {
+		return "", fmt.Errorf("failed to encode batch file: %w", err)
+	}
+
+	resp, err := c.http.send(ctx, http.MethodPost, "/files", &body, http.Header{"Content-Type": {form.FormDataContentType()}})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload batch file: %w", err)
+	}
+	var file struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(resp, &file); err != nil || file.ID == "" {
+		return "", fmt.Errorf("failed to upload batch file: invalid response")
+	}
+	return file.ID, nil
+}
+
+// get returns the batch object
+func (c *OpenAIBatchClient) get(ctx context.Context, id string) (openaiBatch, error) {
+	var batch openaiBatch
+	if err := c.http.do(ctx, http.MethodGet, "/batches/"+id, nil, &batch); err != nil {
+		return batch, fmt.Errorf("failed to get batch %s: %w", id, err)
+	}
+	return batch, nil
+}
+
+// GetBatch returns the current state of a Batch api job.
+func (c *OpenAIBatchClient) GetBatch(ctx context.Context, id string) (*BatchJob, error) {
+	batch, err := c.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return batch.job(), nil
+}
+
+// CancelBatch requests cancellation of a Batch api job.
+func (c *OpenAIBatchClient) CancelBatch(ctx context.Context, id string) (*BatchJob, error) {
+	var batch openaiBatch
+	if err := c.http.do(ctx, http.MethodPost, "/batches/"+id+"/cancel", nil, &batch); err != nil {
+		return nil, fmt.Errorf("failed to cancel batch %s: %w", id, err)
+	}
+	return batch.job(), nil
+}
+
+// openaiBatchResult is one line of a Batch api output or error file
+type openaiBatchResult struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int `json:"status_code"`
+		Body       struct {
+			Model   string `json:"model"`
+			Choices []struct {
+				Message struct {
+					Content string `json:"content"`
+				} `json:"message"`
+				FinishReason string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage struct {
+				PromptTokens     int64 `json:"prompt_tokens"`
+				CompletionTokens int64 `json:"completion_tokens"`
+			} `json:"usage"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// BatchResults returns the results of a Batch api job that is done, read from
+// its output and error files.
+func (c *OpenAIBatchClient) BatchResults(ctx context.Context, id string) ([]BatchJobResult, error) {
+	batch, err := c.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if batch.OutputFileID == "" && batch.ErrorFileID == "" {
+		return nil, fmt.Errorf("batch %s has no results yet (status %s)", id, batch.Status)
+	}
+
+	var results []BatchJobResult
+	for _, fileID := range []string{batch.OutputFileID, batch.ErrorFileID} {
+		if fileID == "" {
+			continue
+		}
+		data, err := c.http.send(ctx, http.MethodGet, "/files/"+fileID+"/content", nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get results of batch %s: %w", id, err)
+		}
+		for _, line := range splitJSONLines(data) {
+			var r openaiBatchResult
+			if err := json.Unmarshal(line, &r); err != nil {
+				return nil, fmt.Errorf("invalid result in batch %s: %w", id, err)
+			}
+			results = append(results, r.result())
+		}
+	}
+	return results, nil
+}
+
+// result converts an output file line to a BatchJobResult
+func (r openaiBatchResult) result() BatchJobResult {
+	result := BatchJobResult{CustomID: r.CustomID}
+	switch {
+	case r.Error != nil:
+		result.Error = fmt.Sprintf("%s: %s", r.Error.Code, r.Error.Message)
+	case r.Response == nil:
+		result.Error = "missing response"
+	case r.Response.StatusCode != http.StatusOK:
+		result.Error = fmt.Sprintf("status code %d", r.Response.StatusCode)
+		if e := r.Response.Body.Error; e != nil {
+			result.Error += ": " + e.Message
+		}
+	default:
+		body := r.Response.Body
+		resp := &Response{
+			Provider: OpenAI,
+			Model:    body.Model,
+			Usage:    Usage{InputTokens: body.Usage.PromptTokens, OutputTokens: body.Usage.CompletionTokens},
+		}
+		var text strings.Builder
+		for _, choice := range body.Choices {
+			text.WriteString(choice.Message.Content)
+			resp.StopReason = choice.FinishReason
+		}
+		resp.Text = text.String()
+		result.Response = resp
+	}
+	return result
+}
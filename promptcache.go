@@ -0,0 +1,441 @@
+// Package sqirvy provides provider prompt caching.
+//
+// This file implements promptCacheTransport, an http transport installed in the
+// Anthropic, OpenAI, DeepSeek and Gemini clients. It rewrites requests to mark
+// the stable prefix selected with Options.PromptCache as cacheable, and reads the
+// prompt cache token counts from the responses, which langchaingo does not report.
+//
+//   - Anthropic: cache_control breakpoints are added to the marked system prompt
+//     and prompts, at most four per request.
+//   - OpenAI and DeepSeek: prompts are cached automatically, the marks are ignored.
+//   - Gemini: the marked prefix is stored as a cached content resource that is
+//     reused by later requests with the same prefix until it expires.
+package sqirvy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// anthropic accepts at most four cache breakpoints per request
+	anthropicMaxCacheBreakpoints = 4
+	// default lifetime of a gemini cached content
+	geminiCacheTTLDefault = 5 * time.Minute
+)
+
+// PromptCache marks the stable prefix of a request as cacheable by the provider,
+// so repeated requests with the same prefix are billed at the cached input price.
+// The zero value marks nothing.
+type PromptCache struct {
+	// System marks the system prompt as a cacheable prefix
+	System bool
+	// Prompts holds the indexes of prompts that end a cacheable prefix. The prefix
+	// includes the system prompt and all prompts up to and including the index.
+	Prompts []int
+	// TTL is how long the provider keeps the prefix, the provider default if zero.
+	// Anthropic supports 5 minutes and 1 hour, longer values use 1 hour.
+	TTL time.Duration
+}
+
+// enabled reports whether any part of the request is marked
+func (p PromptCache) enabled() bool {
+	return p.System || len(p.Prompts) > 0
+}
+
+// promptCacheKey is the context key of a promptCacheState
+type promptCacheKey struct{}
+
+// promptCacheState carries the prompt cache marks of a query to the transport
+// and the cache token counts back to the query
+type promptCacheState struct {
+	cache PromptCache
+
+	mu    sync.Mutex
+	usage Usage
+}
+
+// withPromptCache returns a context that carries the prompt cache marks to the transport
+func withPromptCache(ctx context.Context, cache PromptCache) (context.Context, *promptCacheState) {
+	state := &promptCacheState{cache: cache}
+	return context.WithValue(ctx, promptCacheKey{}, state), state
+}
+
+// cacheUsage returns the cache token counts reported by the responses of the query
+func (s *promptCacheState) cacheUsage() Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage
+}
+
+// record adds cache token counts of a response
+func (s *promptCacheState) record(usage Usage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usage.CacheReadTokens += usage.CacheReadTokens
+	s.usage.CacheWriteTokens += usage.CacheWriteTokens
+}
+
+// geminiCachedContent is a cached content resource created by the transport
+type geminiCachedContent struct {
+	name    string
+	expires time.Time
+}
+
+// promptCacheTransport applies prompt cache marks to the requests of a provider
+// and records the cache token counts of the responses
+type promptCacheTransport struct {
+	provider string
+	next     http.RoundTripper
+	now      func() time.Time
+
+	mu       sync.Mutex
+	contents map[string]geminiCachedContent // gemini cached contents by prefix hash
+}
+
+// providerHTTPClient returns a copy of client, or a new client if nil, whose
+// transport adds the request headers set with WithRequestHeader and applies
+// prompt caching for provider
+func providerHTTPClient(provider string, client *http.Client) *http.Client {
+	var c http.Client
+	if client != nil {
+		c = *client
+	}
+	c.Transport = &headerTransport{next: &promptCacheTransport{
+		provider: provider,
+		next:     transportOrDefault(c.Transport),
+		now:      time.Now,
+		contents: make(map[string]geminiCachedContent),
+	}}
+	return &c
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *promptCacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	state, _ := req.Context().Value(promptCacheKey{}).(*promptCacheState)
+	if state == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	if state.cache.enabled() && req.Method == http.MethodPost && req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		// a request that cannot be rewritten is sent unchanged
+		if rewritten, ok := t.rewrite(req, body, state); ok {
+			body = rewritten
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+		req.ContentLength = int64(len(body))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	resp.Body = &cacheUsageReader{body: resp.Body, state: state}
+	return resp, nil
+}
+
+// rewrite returns the request body with the prompt cache marks applied
+func (t *promptCacheTransport) rewrite(req *http.Request, body []byte, state *promptCacheState) ([]byte, bool) {
+	switch t.provider {
+	case Anthropic:
+		return anthropicPromptCache(body, state.cache)
+	case Gemini:
+		return t.geminiPromptCache(req, body, state)
+	}
+	return nil, false
+}
+
+// decodeJSONObject decodes a json object, keeping numbers as written
+func decodeJSONObject(data []byte) (map[string]any, bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var m map[string]any
+	if err := dec.Decode(&m); err != nil || m == nil {
+		return nil, false
+	}
+	return m, true
+}
+
+// anthropicPromptCache adds cache_control breakpoints to the marked system prompt
+// and messages of an anthropic messages request. When more than four parts are
+// marked, the system prompt and the last marked prompts are kept.
+func anthropicPromptCache(body []byte, cache PromptCache) ([]byte, bool) {
+	m, ok := decodeJSONObject(body)
+	if !ok {
+		return nil, false
+	}
+	control := map[string]any{"type": "ephemeral"}
+	if cache.TTL > 5*time.Minute {
+		control["ttl"] = "1h"
+	}
+	textBlock := func(text string) []any {
+		return []any{map[string]any{"type": "text", "text": text, "cache_control": control}}
+	}
+
+	breakpoints := anthropicMaxCacheBreakpoints
+	if system, ok := m["system"].(string); ok && cache.System && system != "" {
+		m["system"] = textBlock(system)
+		breakpoints--
+	}
+
+	messages, _ := m["messages"].([]any)
+	marked := slices.Clone(cache.Prompts)
+	slices.Sort(marked)
+	marked = slices.Compact(marked)
+	for i := len(marked) - 1; i >= 0 && breakpoints > 0; i-- {
+		index := marked[i]
+		if index < 0 || index >= len(messages) {
+			continue
+		}
+		message, _ := messages[index].(map[string]any)
+		if text, ok := message["content"].(string); ok {
+			message["content"] = textBlock(text)
+			breakpoints--
+		}
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// geminiPromptCache moves the marked prefix of a gemini generateContent request,
+// the system instruction and the contents up to the last marked prompt, to a
+// cached content resource and refers to it from the request. At least one
+// content is left in the request.
+func (t *promptCacheTransport) geminiPromptCache(req *http.Request, body []byte, state *promptCacheState) ([]byte, bool) {
+	base, _, found := strings.Cut(req.URL.Path, "/models/")
+	if !found {
+		return nil, false
+	}
+	m, ok := decodeJSONObject(body)
+	if !ok {
+		return nil, false
+	}
+	contents, _ := m["contents"].([]any)
+	prefix := 0
+	for _, index := range state.cache.Prompts {
+		prefix = max(prefix, index+1)
+	}
+	prefix = min(prefix, len(contents)-1)
+	system, hasSystem := m["systemInstruction"]
+	if prefix <= 0 && !(state.cache.System && hasSystem) {
+		return nil, false
+	}
+
+	cached := map[string]any{"model": m["model"], "contents": contents[:max(prefix, 0)]}
+	if hasSystem {
+		cached["systemInstruction"] = system
+	}
+	ttl := state.cache.TTL
+	if ttl <= 0 {
+		ttl = geminiCacheTTLDefault
+	}
+	cached["ttl"] = fmt.Sprintf("%.0fs", ttl.Seconds())
+	spec, err := json.Marshal(cached)
+	if err != nil {
+		return nil, false
+	}
+
+	name, err := t.geminiCachedContent(req, base, spec, ttl, state)
+	if err != nil {
+		return nil, false
+	}
+	delete(m, "systemInstruction")
+	m["contents"] = contents[max(prefix, 0):]
+	m["cachedContent"] = name
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// geminiCachedContent returns the name of the cached content holding spec,
+// creating it if there is no unexpired one
+func (t *promptCacheTransport) geminiCachedContent(req *http.Request, base string, spec []byte, ttl time.Duration, state *promptCacheState) (string, error) {
+	sum := sha256.Sum256(spec)
+	key := hex.EncodeToString(sum[:])
+	now := t.now()
+
+	t.mu.Lock()
+	content, ok := t.contents[key]
+	t.mu.Unlock()
+	if ok && now.Before(content.expires) {
+		return content.name, nil
+	}
+
+	url := *req.URL
+	url.Path = base + "/cachedContents"
+	create, err := http.NewRequestWithContext(req.Context(), http.MethodPost, url.String(), bytes.NewReader(spec))
+	if err != nil {
+		return "", err
+	}
+	create.Header = req.Header.Clone()
+	create.Header.Set("Content-Type", "application/json")
+	resp, err := t.next.RoundTrip(create)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to create cached content: %s", resp.Status)
+	}
+	var created struct {
+		Name          string `json:"name"`
+		UsageMetadata struct {
+			TotalTokenCount int64 `json:"totalTokenCount"`
+		} `json:"usageMetadata"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil || created.Name == "" {
+		return "", fmt.Errorf("failed to decode cached content: %v", err)
+	}
+	state.record(Usage{CacheWriteTokens: created.UsageMetadata.TotalTokenCount})
+
+	t.mu.Lock()
+	t.contents[key] = geminiCachedContent{name: created.Name, expires: now.Add(ttl)}
+	t.mu.Unlock()
+	return created.Name, nil
+}
+
+// cacheUsageReader passes a response body through and records the cache token
+// counts found in it when the body is read to the end or closed
+type cacheUsageReader struct {
+	body  io.ReadCloser
+	state *promptCacheState
+	buf   bytes.Buffer
+	done  bool
+}
+
+// Read implements io.Reader.
+func (r *cacheUsageReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.buf.Write(p[:n])
+	if err == io.EOF {
+		r.finish()
+	}
+	return n, err
+}
+
+// Close implements io.Closer.
+func (r *cacheUsageReader) Close() error {
+	r.finish()
+	return r.body.Close()
+}
+
+// finish records the cache token counts of the body once
+func (r *cacheUsageReader) finish() {
+	if r.done {
+		return
+	}
+	r.done = true
+	r.state.record(parseCacheUsage(r.buf.Bytes()))
+	r.buf = bytes.Buffer{}
+}
+
+// cacheUsageFields are the cache token counts of a provider usage object
+type cacheUsageFields struct {
+	// anthropic
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+	// openai
+	PromptTokensDetails struct {
+		CachedTokens int64 `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+	// deepseek
+	PromptCacheHitTokens int64 `json:"prompt_cache_hit_tokens"`
+}
+
+// cacheUsageDocument holds the usage objects of a response or stream event
+type cacheUsageDocument struct {
+	Usage   *cacheUsageFields `json:"usage"`
+	Message *struct {
+		Usage *cacheUsageFields `json:"usage"`
+	} `json:"message"`
+	UsageMetadata *struct {
+		CachedContentTokenCount int64 `json:"cachedContentTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+// usage returns the cache token counts of the document
+func (d cacheUsageDocument) usage() Usage {
+	var usage Usage
+	for _, u := range []*cacheUsageFields{d.Usage, messageUsage(d)} {
+		if u == nil {
+			continue
+		}
+		usage.CacheWriteTokens = max(usage.CacheWriteTokens, u.CacheCreationInputTokens)
+		usage.CacheReadTokens = max(usage.CacheReadTokens, u.CacheReadInputTokens,
+			u.PromptTokensDetails.CachedTokens, u.PromptCacheHitTokens)
+	}
+	if d.UsageMetadata != nil {
+		usage.CacheReadTokens = max(usage.CacheReadTokens, d.UsageMetadata.CachedContentTokenCount)
+	}
+	return usage
+}
+
+// messageUsage returns the usage of an anthropic message_start event
+func messageUsage(d cacheUsageDocument) *cacheUsageFields {
+	if d.Message == nil {
+		return nil
+	}
+	return d.Message.Usage
+}
+
+// parseCacheUsage returns the cache token counts of a response body, which is a
+// json object, a json array of objects or a stream of server-sent events. Counts
+// repeated in several events of a stream are counted once.
+func parseCacheUsage(body []byte) Usage {
+	var docs []cacheUsageDocument
+	trimmed := bytes.TrimSpace(body)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		var doc cacheUsageDocument
+		if json.Unmarshal(trimmed, &doc) == nil {
+			docs = append(docs, doc)
+		}
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		_ = json.Unmarshal(trimmed, &docs)
+	default:
+		scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+		scanner.Buffer(nil, len(trimmed)+1)
+		for scanner.Scan() {
+			data, ok := bytes.CutPrefix(scanner.Bytes(), []byte("data:"))
+			if !ok {
+				continue
+			}
+			var doc cacheUsageDocument
+			if json.Unmarshal(bytes.TrimSpace(data), &doc) == nil {
+				docs = append(docs, doc)
+			}
+		}
+	}
+
+	var usage Usage
+	for _, doc := range docs {
+		u := doc.usage()
+		usage.CacheReadTokens = max(usage.CacheReadTokens, u.CacheReadTokens)
+		usage.CacheWriteTokens = max(usage.CacheWriteTokens, u.CacheWriteTokens)
+	}
+	return usage
+}
@@ -0,0 +1,336 @@
+package sqirvy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmh2000/sqirvy-llmclient/sqirvytest"
+)
+
+func TestPromptCache_Anthropic(t *testing.T) {
+	srv := sqirvytest.NewAnthropicServer(t)
+	srv.Setenv(t)
+	client, err := NewAnthropicClient()
+	if err != nil {
+		t.Fatalf("NewAnthropicClient() error = %v", err)
+	}
+	defer client.Close()
+
+	srv.Enqueue(sqirvytest.Reply{Text: "ok", InputTokens: 5, OutputTokens: 1, CacheReadTokens: 100, CacheWriteTokens: 20})
+	req := Request{
+		System:  assistant,
+		Prompts: []string{"document", "question"},
+		Model:   "claude-sonnet-4-20250514",
+		Options: Options{PromptCache: PromptCache{System: true, Prompts: []int{0}, TTL: time.Hour}},
+	}
+	resp, err := client.Query(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	want := Usage{InputTokens: 125, OutputTokens: 1, CacheReadTokens: 100, CacheWriteTokens: 20}
+	if resp.Usage != want {
+		t.Errorf("Usage = %+v, want %+v", resp.Usage, want)
+	}
+
+	var body struct {
+		System   []map[string]any `json:"system"`
+		Messages []struct {
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(srv.LastRequest().Body, &body); err != nil {
+		t.Fatalf("request body: %v: %s", err, srv.LastRequest().Body)
+	}
+	if len(body.System) != 1 || body.System[0]["text"] != assistant || body.System[0]["cache_control"] == nil {
+		t.Errorf("system = %v, want a text block with cache_control", body.System)
+	}
+	if len(body.Messages) != 2 {
+		t.Fatalf("messages = %d, want 2", len(body.Messages))
+	}
+	if first := string(body.Messages[0].Content); !strings.Contains(first, `"cache_control":{"ttl":"1h","type":"ephemeral"}`) {
+		t.Errorf("first message content = %s, want a 1h cache_control", first)
+	}
+	if second := string(body.Messages[1].Content); second != `"question"` {
+		t.Errorf("second message content = %s, want unmarked", second)
+	}
+}
+
+func TestPromptCache_AnthropicUnmarked(t *testing.T) {
+	srv := sqirvytest.NewAnthropicServer(t)
+	srv.Setenv(t)
+	client, err := NewAnthropicClient()
+	if err != nil {
+		t.Fatalf("NewAnthropicClient() error = %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.QueryText(context.Background(), assistant, []string{"hello"}, "claude-sonnet-4-20250514", Options{}); err != nil {
+		t.Fatalf("QueryText() error = %v", err)
+	}
+	if body := string(srv.LastRequest().Body); strings.Contains(body, "cache_control") {
+		t.Errorf("unmarked request has cache_control: %s", body)
+	}
+}
+
+func TestPromptCache_AnthropicHistory(t *testing.T) {
+	srv := sqirvytest.NewAnthropicServer(t)
+	srv.Setenv(t)
+	client, err := NewAnthropicClient()
+	if err != nil {
+		t.Fatalf("NewAnthropicClient() error = %v", err)
+	}
+	defer client.Close()
+
+	req := Request{
+		System:  assistant,
+		History: []Message{{Role: RoleUser, Text: "earlier question"}, {Role: RoleAssistant, Text: "earlier answer"}},
+		Prompts: []string{"document", "question"},
+		Model:   "claude-sonnet-4-20250514",
+		Options: Options{PromptCache: PromptCache{Prompts: []int{0}}},
+	}
+	if _, err := client.Query(context.Background(), req); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+
+	var body struct {
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(srv.LastRequest().Body, &body); err != nil {
+		t.Fatalf("request body: %v: %s", err, srv.LastRequest().Body)
+	}
+	var roles []string
+	for _, m := range body.Messages {
+		roles = append(roles, m.Role)
+	}
+	if got := strings.Join(roles, ","); got != "user,assistant,user,user" {
+		t.Fatalf("message roles = %s, want user,assistant,user,user", got)
+	}
+	// the marked prompt follows the history
+	if !strings.Contains(string(body.Messages[2].Content), "cache_control") || strings.Contains(string(body.Messages[0].Content), "cache_control") {
+		t.Errorf("messages = %s, want the first prompt marked", srv.LastRequest().Body)
+	}
+}
+
+func TestAnthropicPromptCache_Breakpoints(t *testing.T) {
+	body := `{"system":"sys","messages":[{"role":"user","content":"a"},{"role":"user","content":"b"},{"role":"user","content":"c"},{"role":"user","content":"d"}],"max_tokens":64000}`
+	data, ok := anthropicPromptCache([]byte(body), PromptCache{System: true, Prompts: []int{3, 0, 1, 2, 2, 7}})
+	if !ok {
+		t.Fatalf("anthropicPromptCache() failed")
+	}
+	if n := strings.Count(string(data), "cache_control"); n != anthropicMaxCacheBreakpoints {
+		t.Errorf("breakpoints = %d, want %d: %s", n, anthropicMaxCacheBreakpoints, data)
+	}
+	// the earliest prompt loses its breakpoint
+	if !strings.Contains(string(data), `{"content":"a","role":"user"}`) {
+		t.Errorf("first message is marked: %s", data)
+	}
+	if !strings.Contains(string(data), `"max_tokens":64000`) {
+		t.Errorf("max_tokens changed: %s", data)
+	}
+}
+
+func TestPromptCache_OpenAI(t *testing.T) {
+	srv := sqirvytest.NewOpenAIServer(t)
+	srv.Setenv(t)
+	client, err := NewOpenAIClient()
+	if err != nil {
+		t.Fatalf("NewOpenAIClient() error = %v", err)
+	}
+	defer client.Close()
+
+	srv.Enqueue(sqirvytest.Reply{Text: "ok", InputTokens: 1200, OutputTokens: 1, CacheReadTokens: 1024})
+	resp, err := client.Query(context.Background(), Request{
+		System:  assistant,
+		Prompts: []string{"hello"},
+		Model:   "gpt-5",
+		Options: Options{PromptCache: PromptCache{System: true}},
+	})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	want := Usage{InputTokens: 1200, OutputTokens: 1, CacheReadTokens: 1024}
+	if resp.Usage != want {
+		t.Errorf("Usage = %+v, want %+v", resp.Usage, want)
+	}
+	// openai caches prompts automatically, the request is not changed
+	if body := string(srv.LastRequest().Body); strings.Contains(body, "cache") {
+		t.Errorf("request has cache fields: %s", body)
+	}
+}
+
+// geminiStreamSupported reports whether encoding/json continues decoding an array
+// after a failed Decode, which the Gemini REST stream reader relies on
+func geminiStreamSupported() bool {
+	d := json.NewDecoder(strings.NewReader(`[{}]`))
+	_, _ = d.Token()
+	var raw json.RawMessage
+	_ = d.Decode(&raw)
+	if d.Decode(&raw) == nil {
+		return false
+	}
+	t, _ := d.Token()
+	return t == json.Delim(']')
+}
+
+func TestPromptCache_Gemini(t *testing.T) {
+	if !geminiStreamSupported() {
+		t.Skip("gax stream reader is not supported by this encoding/json")
+	}
+	srv := sqirvytest.NewGeminiServer(t)
+	srv.Setenv(t)
+	client, err := NewGeminiClient()
+	if err != nil {
+		t.Fatalf("NewGeminiClient() error = %v", err)
+	}
+	defer client.Close()
+
+	req := Request{
+		System:  assistant,
+		Prompts: []string{"document", "question"},
+		Model:   "gemini-2.5-flash",
+		Options: Options{PromptCache: PromptCache{System: true, Prompts: []int{0}}},
+	}
+	srv.Enqueue(sqirvytest.Reply{Text: "one", InputTokens: 50, OutputTokens: 1, CacheReadTokens: 40})
+	first, err := client.Query(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if first.Usage.CacheReadTokens != 40 || first.Usage.CacheWriteTokens == 0 {
+		t.Errorf("first Usage = %+v, want cache reads and writes", first.Usage)
+	}
+	if first.Usage.InputTokens != 50+first.Usage.CacheWriteTokens {
+		t.Errorf("first InputTokens = %d, want input and cache write tokens", first.Usage.InputTokens)
+	}
+
+	srv.Enqueue(sqirvytest.Reply{Text: "two", InputTokens: 50, OutputTokens: 1, CacheReadTokens: 40})
+	req.Prompts = []string{"document", "another question"}
+	second, err := client.Query(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if second.Usage.CacheWriteTokens != 0 {
+		t.Errorf("second Usage = %+v, want the cached content reused", second.Usage)
+	}
+
+	var creates []sqirvytest.Request
+	for _, r := range srv.Requests() {
+		if strings.HasSuffix(r.Path, "/cachedContents") {
+			creates = append(creates, r)
+		}
+	}
+	if len(creates) != 1 {
+		t.Fatalf("cached content requests = %d, want 1", len(creates))
+	}
+	spec := creates[0].JSON()
+	if spec["systemInstruction"] == nil || len(spec["contents"].([]any)) != 1 || spec["ttl"] != "300s" {
+		t.Errorf("cached content = %s", creates[0].Body)
+	}
+
+	body := srv.LastRequest().JSON()
+	if !strings.HasPrefix(stringValue(body["cachedContent"]), "cachedContents/") {
+		t.Errorf("request cachedContent = %v", body["cachedContent"])
+	}
+	if _, ok := body["systemInstruction"]; ok {
+		t.Errorf("request has systemInstruction with cached content: %s", srv.LastRequest().Body)
+	}
+	if contents, _ := body["contents"].([]any); len(contents) != 1 {
+		t.Errorf("request contents = %v, want the last prompt only", body["contents"])
+	}
+}
+
+func TestPromptCacheTransport_Gemini(t *testing.T) {
+	srv := sqirvytest.NewGeminiServer(t)
+	client := providerHTTPClient(Gemini, nil)
+	body := `{"model":"models/gemini-2.5-flash","systemInstruction":{"parts":[{"text":"sys"}]},` +
+		`"contents":[{"role":"user","parts":[{"text":"a"}]},{"role":"user","parts":[{"text":"b"}]}]}`
+
+	send := func(cache PromptCache) Usage {
+		ctx, state := withPromptCache(context.Background(), cache)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/v1beta/models/gemini-2.5-flash:generateContent?key=k", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.Enqueue(sqirvytest.Reply{Text: "ok", CacheReadTokens: 8})
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return state.cacheUsage()
+	}
+
+	// only the system instruction is marked
+	if usage := send(PromptCache{System: true}); usage.CacheReadTokens != 8 || usage.CacheWriteTokens == 0 {
+		t.Errorf("Usage = %+v, want cache reads and writes", usage)
+	}
+	create := srv.Requests()[0]
+	if !strings.HasSuffix(create.Path, "/v1beta/cachedContents") || create.Query != "key=k" {
+		t.Errorf("cached content request = %s?%s", create.Path, create.Query)
+	}
+	if contents := create.JSON()["contents"].([]any); len(contents) != 0 {
+		t.Errorf("cached contents = %v, want none", contents)
+	}
+	if got := srv.LastRequest().JSON(); got["cachedContent"] == nil || len(got["contents"].([]any)) != 2 {
+		t.Errorf("request = %s", srv.LastRequest().Body)
+	}
+
+	// marking the first prompt caches a different prefix
+	send(PromptCache{Prompts: []int{0, 5}})
+	if got := srv.LastRequest().JSON(); len(got["contents"].([]any)) != 1 {
+		t.Errorf("request = %s, want the last prompt only", srv.LastRequest().Body)
+	}
+	// the same prefix reuses the cached content
+	if usage := send(PromptCache{Prompts: []int{0}}); usage.CacheWriteTokens != 0 {
+		t.Errorf("Usage = %+v, want no cache writes", usage)
+	}
+	if n := len(srv.Requests()); n != 5 {
+		t.Errorf("requests = %d, want 2 cached content and 3 generate requests", n)
+	}
+}
+
+// stringValue returns v if it is a string
+func stringValue(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+func TestParseCacheUsage(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want Usage
+	}{
+		{name: "Empty", body: "", want: Usage{}},
+		{name: "Anthropic", body: `{"usage":{"input_tokens":5,"cache_creation_input_tokens":20,"cache_read_input_tokens":100}}`, want: Usage{CacheReadTokens: 100, CacheWriteTokens: 20}},
+		{name: "Anthropic stream", body: "event: message_start\ndata: {\"message\":{\"usage\":{\"cache_read_input_tokens\":7}}}\n\nevent: message_delta\ndata: {\"usage\":{\"output_tokens\":3}}\n\n", want: Usage{CacheReadTokens: 7}},
+		{name: "OpenAI stream", body: "data: {\"choices\":[]}\n\ndata: {\"usage\":{\"prompt_tokens_details\":{\"cached_tokens\":1024}}}\n\ndata: [DONE]\n\n", want: Usage{CacheReadTokens: 1024}},
+		{name: "DeepSeek", body: `{"usage":{"prompt_cache_hit_tokens":64,"prompt_cache_miss_tokens":10}}`, want: Usage{CacheReadTokens: 64}},
+		{name: "Gemini array", body: `[{"usageMetadata":{"cachedContentTokenCount":40}},{"usageMetadata":{"cachedContentTokenCount":40}}]`, want: Usage{CacheReadTokens: 40}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCacheUsage([]byte(tt.body)); got != tt.want {
+				t.Errorf("parseCacheUsage() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEstimateCost_PromptCache(t *testing.T) {
+	// claude-sonnet-4: $3 input, cache reads at 10% and writes at 125%
+	usage := Usage{InputTokens: 1_000_000, CacheReadTokens: 500_000, CacheWriteTokens: 200_000}
+	want := (300_000*3.0 + 500_000*0.3 + 200_000*3.75) / 1e6
+	if got := EstimateCost("claude-sonnet-4-20250514", usage); math.Abs(got-want) > 1e-9 {
+		t.Errorf("EstimateCost() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,357 @@
+// Package sqirvy provides client-side rate limiting per provider and model.
+//
+// This file implements RateLimiter, a set of token buckets that limit requests
+// per minute and estimated tokens per minute for each provider and model, and
+// RateLimitedClient, a Client wrapper that waits for the limiter before each
+// query. Callers are served in the order they arrive, and waits end early when
+// the query context is cancelled. A limiter can keep its state in a file so that
+// several processes, such as concurrent sqirvy-cli runs, share the same limits.
+package sqirvy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RateLimit is the request and token rate allowed for a provider or model.
+// A zero field is not limited.
+type RateLimit struct {
+	RequestsPerMinute int   `json:"requests_per_minute"`
+	TokensPerMinute   int64 `json:"tokens_per_minute"`
+}
+
+// bucket is a token bucket that refills continuously at rate tokens per second
+// up to capacity. Reservations may drive the level negative; later callers
+// then wait until the bucket refills, so callers are served in arrival order.
+type bucket struct {
+	capacity float64
+	rate     float64 // tokens per second
+	level    float64
+	last     time.Time
+}
+
+// bucketState is the shared state of a bucket stored in a rate limiter state file
+type bucketState struct {
+	Level float64   `json:"level"`
+	Last  time.Time `json:"last"`
+}
+
+// newBucket returns a full bucket that allows perMinute tokens per minute
+func newBucket(perMinute float64, now time.Time) *bucket {
+	return &bucket{capacity: perMinute, rate: perMinute / 60, level: perMinute, last: now}
+}
+
+// refill adds the tokens accumulated since the last update
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.level = min(b.capacity, b.level+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+// reserve takes n tokens and returns how long the caller must wait for them
+func (b *bucket) reserve(n float64, now time.Time) time.Duration {
+	b.refill(now)
+	// a reservation larger than the bucket could never be satisfied
+	n = min(n, b.capacity)
+	b.level -= n
+	if b.level >= 0 {
+		return 0
+	}
+	return time.Duration(-b.level / b.rate * float64(time.Second))
+}
+
+// release returns n tokens, e.g. when a caller stops waiting
+func (b *bucket) release(n float64, now time.Time) {
+	b.refill(now)
+	b.level = min(b.capacity, b.level+min(n, b.capacity))
+}
+
+// limitBuckets are the buckets for one provider or model
+type limitBuckets struct {
+	requests *bucket // nil if not limited
+	tokens   *bucket // nil if not limited
+}
+
+// RateLimiter limits requests per minute and estimated tokens per minute for each
+// provider and model. A request must satisfy both the provider limit and the model
+// limit, if they are set. A RateLimiter is safe for concurrent use and is meant to
+// be shared by all clients in a process.
+type RateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*limitBuckets // keyed by provider or provider/model
+	now       func() time.Time
+	stateFile string // optional file shared with other processes
+}
+
+// NewRateLimiter creates a RateLimiter with no limits.
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{buckets: make(map[string]*limitBuckets), now: time.Now}
+}
+
+// NewSharedRateLimiter creates a RateLimiter with no limits that keeps its bucket
+// levels in stateFile, so that all processes using the same file share the limits.
+// The file is locked while it is updated. The limits themselves are not stored;
+// each process must set the same limits.
+func NewSharedRateLimiter(stateFile string) *RateLimiter {
+	l := NewRateLimiter()
+	l.stateFile = stateFile
+	return l
+}
+
+// rateLimitKey returns the bucket key for a provider and optional model
+func rateLimitKey(provider, model string) string {
+	if model == "" {
+		return provider
+	}
+	return provider + "/" + model
+}
+
+// SetLimit sets the limit for a provider, or for a single model of the provider
+// if model is not empty. Setting a zero RateLimit removes the limit.
+func (l *RateLimiter) SetLimit(provider, model string, limit RateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := rateLimitKey(provider, model)
+	if limit == (RateLimit{}) {
+		delete(l.buckets, key)
+		return
+	}
+	now := l.now()
+	b := &limitBuckets{}
+	if limit.RequestsPerMinute > 0 {
+		b.requests = newBucket(float64(limit.RequestsPerMinute), now)
+	}
+	if limit.TokensPerMinute > 0 {
+		b.tokens = newBucket(float64(limit.TokensPerMinute), now)
+	}
+	l.buckets[key] = b
+}
+
+// bucketsFor returns the provider and model buckets that apply to a request.
+// The caller must hold l.mu.
+func (l *RateLimiter) bucketsFor(provider, model string) []*limitBuckets {
+	var buckets []*limitBuckets
+	if b, ok := l.buckets[provider]; ok {
+		buckets = append(buckets, b)
+	}
+	if model != "" {
+		if b, ok := l.buckets[rateLimitKey(provider, model)]; ok {
+			buckets = append(buckets, b)
+		}
+	}
+	return buckets
+}
+
+// Wait blocks until a request with the estimated number of tokens is allowed for
+// the provider and model. It returns an error without using any capacity if the
+// context is done before the request is allowed, or at once if the context
+// deadline is earlier than the time the request would be allowed.
+func (l *RateLimiter) Wait(ctx context.Context, provider, model string, tokens int64) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("request context error %w", ctx.Err())
+	}
+
+	var delay time.Duration
+	var reserved []*limitBuckets
+	err := l.update(func(now time.Time) {
+		for _, b := range l.bucketsFor(provider, model) {
+			reserved = append(reserved, b)
+			if b.requests != nil {
+				delay = max(delay, b.requests.reserve(1, now))
+			}
+			if b.tokens != nil {
+				delay = max(delay, b.tokens.reserve(float64(tokens), now))
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if delay == 0 {
+		return nil
+	}
+
+	// give up at once if the wait would outlast the context deadline
+	if deadline, ok := ctx.Deadline(); ok && l.now().Add(delay).After(deadline) {
+		l.release(reserved, tokens)
+		return fmt.Errorf("rate limit wait of %s exceeds the request deadline: %w", delay.Round(time.Millisecond), context.DeadlineExceeded)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.release(reserved, tokens)
+		return fmt.Errorf("request context error %w", ctx.Err())
+	}
+}
+
+// release gives back a reservation that was not used, so later callers are not delayed
+func (l *RateLimiter) release(reserved []*limitBuckets, tokens int64) {
+	_ = l.update(func(now time.Time) {
+		for _, b := range reserved {
+			if b.requests != nil {
+				b.requests.release(1, now)
+			}
+			if b.tokens != nil {
+				b.tokens.release(float64(tokens), now)
+			}
+		}
+	})
+}
+
+// AddTokens charges additional tokens to the provider and model token buckets
+// without waiting, e.g. the output tokens reported after a response.
+func (l *RateLimiter) AddTokens(provider, model string, tokens int64) {
+	if tokens <= 0 {
+		return
+	}
+	_ = l.update(func(now time.Time) {
+		for _, b := range l.bucketsFor(provider, model) {
+			if b.tokens != nil {
+				b.tokens.reserve(float64(tokens), now)
+			}
+		}
+	})
+}
+
+// update runs f with the limiter locked. For a shared limiter, the bucket levels
+// are loaded from the state file before f runs and saved after it returns, with
+// the file locked against other processes.
+func (l *RateLimiter) update(f func(now time.Time)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.stateFile == "" {
+		f(l.now())
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.stateFile), 0o755); err != nil {
+		return fmt.Errorf("failed to create rate limit state directory: %w", err)
+	}
+	lock, err := os.OpenFile(l.stateFile+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open rate limit lock file: %w", err)
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return fmt.Errorf("failed to lock rate limit state: %w", err)
+	}
+	defer func() { _ = unlockFile(lock) }()
+
+	state := make(map[string]bucketState)
+	data, err := os.ReadFile(l.stateFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read rate limit state: %w", err)
+	}
+	if len(data) > 0 {
+		// a corrupt state file is replaced with the local state
+		_ = json.Unmarshal(data, &state)
+	}
+
+	// keys of the request and token buckets in the state file
+	each := func(fn func(key string, b *bucket)) {
+		for key, lb := range l.buckets {
+			if lb.requests != nil {
+				fn(key+"#requests", lb.requests)
+			}
+			if lb.tokens != nil {
+				fn(key+"#tokens", lb.tokens)
+			}
+		}
+	}
+
+	each(func(key string, b *bucket) {
+		if st, ok := state[key]; ok {
+			b.level = min(b.capacity, st.Level)
+			b.last = st.Last
+		}
+	})
+	f(l.now())
+	each(func(key string, b *bucket) {
+		state[key] = bucketState{Level: b.level, Last: b.last}
+	})
+
+	data, err = json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode rate limit state: %w", err)
+	}
+	if err := os.WriteFile(l.stateFile, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write rate limit state: %w", err)
+	}
+	return nil
+}
+
+// RateLimitedClient wraps a Client and waits for a RateLimiter before each query.
+// The input tokens of each request are estimated from its text before it is sent,
+// and the output tokens reported in the response are charged afterwards.
+type RateLimitedClient struct {
+	client   Client
+	provider string
+	limiter  *RateLimiter
+}
+
+// Ensure RateLimitedClient implements the Client and Querier interfaces
+var (
+	_ Client  = (*RateLimitedClient)(nil)
+	_ Querier = (*RateLimitedClient)(nil)
+)
+
+// NewRateLimitedClient wraps client with the limiter. provider selects the limits
+// that apply; if it is empty, the provider of each request's model is looked up
+// in the model registry.
+func NewRateLimitedClient(client Client, provider string, limiter *RateLimiter) *RateLimitedClient {
+	return &RateLimitedClient{client: client, provider: provider, limiter: limiter}
+}
+
+// QueryText waits for the rate limiter and sends the query to the wrapped client.
+func (c *RateLimitedClient) QueryText(ctx context.Context, system string, prompts []string, model string, options Options) (string, error) {
+	return queryText(ctx, c, system, prompts, model, options)
+}
+
+// Query implements the Querier interface.
+func (c *RateLimitedClient) Query(ctx context.Context, req Request) (*Response, error) {
+	return c.intercept(ctx, req, ClientHandler(c.client))
+}
+
+// intercept implements the middleware of the client, sending requests to next
+func (c *RateLimitedClient) intercept(ctx context.Context, req Request, next Handler) (*Response, error) {
+	provider := c.provider
+	if provider == "" {
+		provider, _ = GetProviderName(req.Model)
+	}
+
+	if err := c.limiter.Wait(ctx, provider, req.Model, estimateRequestTokens(req)); err != nil {
+		return nil, err
+	}
+	resp, err := next(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	c.limiter.AddTokens(provider, req.Model, resp.Usage.OutputTokens)
+	return resp, nil
+}
+
+// RateLimitMiddleware returns the middleware of a RateLimitedClient: it waits for the
+// limiter before each request.
+func RateLimitMiddleware(provider string, limiter *RateLimiter) Middleware {
+	return NewRateLimitedClient(nil, provider, limiter).intercept
+}
+
+// Close closes the wrapped client.
+func (c *RateLimitedClient) Close() error {
+	return c.client.Close()
+}
@@ -0,0 +1,121 @@
+package sqirvy
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Wait(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     RateLimit
+		model     string // model of the limit, empty for a provider limit
+		tokens    int64  // tokens per request
+		allowed   int    // requests allowed without waiting
+		wantDelay bool   // whether the next request waits
+	}{
+		{name: "Requests per minute", limit: RateLimit{RequestsPerMinute: 3}, allowed: 3, wantDelay: true},
+		{name: "Tokens per minute", limit: RateLimit{TokensPerMinute: 100}, tokens: 40, allowed: 2, wantDelay: true},
+		{name: "Model limit", limit: RateLimit{RequestsPerMinute: 2}, model: "mock", allowed: 2, wantDelay: true},
+		{name: "Other model is not limited", limit: RateLimit{RequestsPerMinute: 2}, model: "other", allowed: 2, wantDelay: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewRateLimiter()
+			limiter.SetLimit(Mock, tt.model, tt.limit)
+
+			for i := 0; i < tt.allowed; i++ {
+				if err := limiter.Wait(context.Background(), Mock, "mock", tt.tokens); err != nil {
+					t.Fatalf("Wait() error = %v", err)
+				}
+			}
+
+			// the next request waits for the bucket to refill, so a short deadline expires
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			err := limiter.Wait(ctx, Mock, "mock", tt.tokens)
+			if got := err != nil; got != tt.wantDelay {
+				t.Errorf("Wait() error = %v, want delay %v", err, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_CancelReleases(t *testing.T) {
+	limiter := NewRateLimiter()
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	limiter.SetLimit(Mock, "", RateLimit{RequestsPerMinute: 1})
+
+	if err := limiter.Wait(context.Background(), Mock, "mock", 0); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limiter.Wait(ctx, Mock, "mock", 0); err == nil {
+		t.Fatal("Wait() error = nil with a cancelled context")
+	}
+
+	// after a minute the bucket is full again; the cancelled request used no capacity
+	now = now.Add(time.Minute)
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx, Mock, "mock", 0); err != nil {
+		t.Errorf("Wait() error = %v after the bucket refilled", err)
+	}
+}
+
+func TestRateLimiter_Shared(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "ratelimit.json")
+	first := NewSharedRateLimiter(state)
+	second := NewSharedRateLimiter(state)
+	for _, l := range []*RateLimiter{first, second} {
+		l.SetLimit(Mock, "", RateLimit{RequestsPerMinute: 2})
+	}
+
+	for _, l := range []*RateLimiter{first, second} {
+		if err := l.Wait(context.Background(), Mock, "mock", 0); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+	}
+
+	// both limiters used the shared capacity
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := first.Wait(ctx, Mock, "mock", 0); err == nil {
+		t.Error("Wait() error = nil, want the shared limit to be exhausted")
+	}
+}
+
+func TestRateLimitedClient(t *testing.T) {
+	limiter := NewRateLimiter()
+	limiter.SetLimit(Mock, "", RateLimit{RequestsPerMinute: 1})
+	client := NewRateLimitedClient(NewMockClientWithResponses(MockResponse{Text: "ok"}), "", limiter)
+
+	got, err := client.QueryText(context.Background(), assistant, []string{"hello"}, "mock", Options{})
+	if err != nil || got != "ok" {
+		t.Fatalf("RateLimitedClient.QueryText() = %q, %v", got, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.QueryText(ctx, assistant, []string{"hello"}, "mock", Options{}); err == nil {
+		t.Error("RateLimitedClient.QueryText() error = nil, want rate limit wait to time out")
+	}
+}
+
+func TestNewClient_WithRateLimiter(t *testing.T) {
+	t.Setenv("MOCK_FIXTURE", "")
+	t.Setenv("MOCK_RECORD", "")
+
+	client, err := NewClient(Mock, WithRateLimiter(NewRateLimiter()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if _, ok := client.(*RateLimitedClient); !ok {
+		t.Errorf("NewClient() = %T, want *RateLimitedClient", client)
+	}
+}
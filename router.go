@@ -0,0 +1,282 @@
+// Package sqirvy provides cost- and size-aware model routing.
+//
+// This file implements RouterClient, a Client that chooses the model for each
+// request from a RoutingPolicy. By default the cheapest model whose context
+// window fits the request is used. Requests larger than a size threshold, or
+// marked as hard with a difficulty hint, are escalated to a stronger model.
+// The routing decision is reported in the response metadata.
+package sqirvy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+const (
+	// MetadataRouteModel is the Response.Metadata key holding the model chosen by a RouterClient
+	MetadataRouteModel = "route_model"
+
+	// MetadataRouteReason is the Response.Metadata key holding the reason for the choice:
+	// RouteCheapest, RouteSize or RouteDifficulty
+	MetadataRouteReason = "route_reason"
+
+	// MetadataRouteInputTokens is the Response.Metadata key holding the estimated
+	// input tokens used to choose the model
+	MetadataRouteInputTokens = "route_input_tokens"
+
+	// MetadataRouteEstimatedCost is the Response.Metadata key holding the estimated
+	// cost in USD of the request for the chosen model
+	MetadataRouteEstimatedCost = "route_estimated_cost"
+)
+
+// Routing reasons reported in MetadataRouteReason
+const (
+	RouteCheapest   = "cheapest"   // the cheapest model that fits the request
+	RouteSize       = "size"       // escalated because the request exceeds EscalateTokens
+	RouteDifficulty = "difficulty" // escalated because of a DifficultyHard hint
+)
+
+// Difficulty is a caller-supplied hint about how hard a request is.
+type Difficulty string
+
+const (
+	DifficultyNormal Difficulty = "normal" // route to the cheapest model that fits
+	DifficultyHard   Difficulty = "hard"   // escalate to a stronger model
+)
+
+// difficultyKey is the context key for the difficulty hint
+type difficultyKey struct{}
+
+// WithDifficulty returns a context carrying a difficulty hint for a RouterClient.
+func WithDifficulty(ctx context.Context, d Difficulty) context.Context {
+	return context.WithValue(ctx, difficultyKey{}, d)
+}
+
+// DifficultyFromContext returns the difficulty hint of a context, or DifficultyNormal if none is set.
+func DifficultyFromContext(ctx context.Context) Difficulty {
+	if d, ok := ctx.Value(difficultyKey{}).(Difficulty); ok {
+		return d
+	}
+	return DifficultyNormal
+}
+
+// RoutingPolicy selects a model for each request using the model registry's
+// context windows and prices.
+type RoutingPolicy struct {
+	// Models are the candidate models for normal requests.
+	// If empty, every registered model of a provider whose credentials are set in the
+	// environment is a candidate, except the mock model.
+	Models []string
+	// StrongModels are the candidate models for escalated requests.
+	// If empty, or if none fits, escalated requests use the most expensive candidate that fits.
+	StrongModels []string
+	// EscalateTokens escalates requests with more estimated input tokens than this.
+	// Zero disables size-based escalation.
+	EscalateTokens int64
+	// OutputTokens is the number of output tokens reserved when checking that a request
+	// fits a context window and when estimating cost. The default is MAX_TOKENS_DEFAULT.
+	OutputTokens int64
+	// Provider, if set, returns the provider that serves a model, e.g. Vertex for
+	// Anthropic models. The default is the provider of the model registry.
+	Provider func(model string) string
+}
+
+// provider returns the provider that serves a model
+func (p RoutingPolicy) provider(model string) string {
+	if p.Provider != nil {
+		return p.Provider(model)
+	}
+	return modelRegistry[model].Provider
+}
+
+// providerCredentials lists the environment variables that must be set to use a provider.
+// Each entry is a list of alternatives, one of which must be set.
+var providerCredentials = map[string][][]string{
+	Anthropic: {{"ANTHROPIC_API_KEY"}},
+	Gemini:    {{"GEMINI_API_KEY"}},
+	OpenAI:    {{"OPENAI_API_KEY"}},
+	Mistral:   {{"MISTRAL_API_KEY"}},
+	DeepSeek:  {{"DEEPSEEK_API_KEY"}},
+	Vertex: {{"VERTEX_PROJECT", "GOOGLE_CLOUD_PROJECT"}, {"VERTEX_LOCATION", "GOOGLE_CLOUD_LOCATION"}},
+}
+
+// hasCredentials reports whether the credentials of a provider are set in the environment
+func hasCredentials(provider string) bool {
+	required, ok := providerCredentials[provider]
+	if !ok {
+		return false
+	}
+	for _, alternatives := range required {
+		set := false
+		for _, name := range alternatives {
+			set = set || os.Getenv(name) != ""
+		}
+		if !set {
+			return false
+		}
+	}
+	return true
+}
+
+// RouteDecision describes the model chosen for a request.
+type RouteDecision struct {
+	Model         string
+	Provider      string
+	Reason        string  // RouteCheapest, RouteSize or RouteDifficulty
+	InputTokens   int64   // estimated input tokens
+	EstimatedCost float64 // estimated cost in USD, including the reserved output tokens
+}
+
+// Choose returns the model for a request with the given difficulty hint.
+// It returns an error if no candidate model has a context window large enough for the request.
+func (p RoutingPolicy) Choose(req Request, difficulty Difficulty) (RouteDecision, error) {
+	output := p.OutputTokens
+	if output <= 0 {
+		output = MAX_TOKENS_DEFAULT
+	}
+	decision := RouteDecision{Reason: RouteCheapest, InputTokens: estimateRequestTokens(req)}
+
+	switch {
+	case difficulty == DifficultyHard:
+		decision.Reason = RouteDifficulty
+	case p.EscalateTokens > 0 && decision.InputTokens > p.EscalateTokens:
+		decision.Reason = RouteSize
+	}
+
+	candidates := p.Models
+	if len(candidates) == 0 {
+		for model, info := range modelRegistry {
+			if info.Provider != Mock && hasCredentials(p.provider(model)) {
+				candidates = append(candidates, model)
+			}
+		}
+		if len(candidates) == 0 {
+			return RouteDecision{}, fmt.Errorf("no candidate models: set the policy models or the credentials of a provider")
+		}
+	}
+
+	// fitting models, cheapest first
+	fits := func(models []string) ([]string, error) {
+		var fit []string
+		for _, model := range models {
+			model = GetModelAlias(model)
+			info, err := GetModelInfo(model)
+			if err != nil {
+				return nil, err
+			}
+			if decision.InputTokens+output <= info.ContextWindow {
+				fit = append(fit, model)
+			}
+		}
+		cost := func(model string) float64 {
+			return EstimateCost(model, Usage{InputTokens: decision.InputTokens, OutputTokens: output})
+		}
+		sort.Slice(fit, func(i, j int) bool {
+			ci, cj := cost(fit[i]), cost(fit[j])
+			if ci != cj {
+				return ci < cj
+			}
+			return fit[i] < fit[j]
+		})
+		return fit, nil
+	}
+
+	fit, err := fits(candidates)
+	if err != nil {
+		return RouteDecision{}, err
+	}
+	var model string
+	if decision.Reason != RouteCheapest && len(p.StrongModels) > 0 {
+		strong, err := fits(p.StrongModels)
+		if err != nil {
+			return RouteDecision{}, err
+		}
+		if len(strong) > 0 {
+			model = strong[0]
+		}
+	}
+	// without a fitting strong model, an escalated request goes to the most
+	// expensive fitting model
+	if model == "" && len(fit) > 0 {
+		model = fit[0]
+		if decision.Reason != RouteCheapest {
+			model = fit[len(fit)-1]
+		}
+	}
+	if model == "" {
+		return RouteDecision{}, fmt.Errorf("no model has a context window for %d input tokens", decision.InputTokens)
+	}
+
+	decision.Model = model
+	decision.Provider = p.provider(model)
+	decision.EstimatedCost = EstimateCost(model, Usage{InputTokens: decision.InputTokens, OutputTokens: output})
+	return decision, nil
+}
+
+// RouterClient implements the Client interface by choosing a model for each
+// request from a RoutingPolicy. The model argument of QueryText and the Model of
+// a Request are ignored. RouterClient is safe for concurrent use.
+type RouterClient struct {
+	policy RoutingPolicy
+	pool   clientPool
+}
+
+// Ensure RouterClient implements the Client and Querier interfaces
+var (
+	_ Client  = (*RouterClient)(nil)
+	_ Querier = (*RouterClient)(nil)
+)
+
+// NewRouterClient creates a RouterClient for the policy. The options are used
+// when creating the provider clients. It returns an error if a policy model is
+// not in the model registry.
+func NewRouterClient(policy RoutingPolicy, opts ...ClientOption) (*RouterClient, error) {
+	for _, model := range append(append([]string(nil), policy.Models...), policy.StrongModels...) {
+		if _, err := GetModelInfo(GetModelAlias(model)); err != nil {
+			return nil, fmt.Errorf("invalid routing policy: %w", err)
+		}
+	}
+	return &RouterClient{policy: policy, pool: clientPool{opts: opts}}, nil
+}
+
+// QueryText sends the query to the model chosen by the policy and returns the response text.
+// The difficulty hint is read from the context, see WithDifficulty.
+func (c *RouterClient) QueryText(ctx context.Context, system string, prompts []string, model string, options Options) (string, error) {
+	return queryText(ctx, c, system, prompts, model, options)
+}
+
+// Query implements the Querier interface. The routing decision is reported in the
+// response metadata under the MetadataRoute keys.
+func (c *RouterClient) Query(ctx context.Context, req Request) (*Response, error) {
+	decision, err := c.policy.Choose(req, DifficultyFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := c.pool.get(decision.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Model = decision.Model
+	resp, err := Query(ctx, client, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Metadata == nil {
+		resp.Metadata = make(map[string]string)
+	}
+	resp.Metadata[MetadataRouteModel] = decision.Model
+	resp.Metadata[MetadataRouteReason] = decision.Reason
+	resp.Metadata[MetadataRouteInputTokens] = strconv.FormatInt(decision.InputTokens, 10)
+	resp.Metadata[MetadataRouteEstimatedCost] = strconv.FormatFloat(decision.EstimatedCost, 'f', 6, 64)
+	return resp, nil
+}
+
+// Close closes the provider clients created by the RouterClient.
+func (c *RouterClient) Close() error {
+	return c.pool.Close()
+}
@@ -0,0 +1,119 @@
+package sqirvy
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRoutingPolicy_Choose(t *testing.T) {
+	models := []string{"claude-sonnet-4", "gpt-5-mini", "gemini-2.5-flash"}
+	small := Request{Prompts: []string{"hello"}}
+	large := Request{Prompts: []string{strings.Repeat("x", 4*600000)}}
+	huge := Request{Prompts: []string{strings.Repeat("x", 4*2000000)}}
+	medium := Request{Prompts: []string{strings.Repeat("x", 4*300000)}}
+
+	tests := []struct {
+		name       string
+		policy     RoutingPolicy
+		req        Request
+		difficulty Difficulty
+		wantModel  string
+		wantReason string
+		wantErr    bool
+	}{
+		{name: "Cheapest", policy: RoutingPolicy{Models: models}, req: small, wantModel: "gpt-5-mini", wantReason: RouteCheapest},
+		{name: "Only large window fits", policy: RoutingPolicy{Models: models}, req: large, wantModel: "gemini-2.5-flash", wantReason: RouteCheapest},
+		{name: "Hard with strong models", policy: RoutingPolicy{Models: models, StrongModels: []string{"claude-opus-4-1", "gpt-5"}}, req: small, difficulty: DifficultyHard, wantModel: "gpt-5", wantReason: RouteDifficulty},
+		{name: "Hard without strong models", policy: RoutingPolicy{Models: models}, req: small, difficulty: DifficultyHard, wantModel: "claude-sonnet-4-20250514", wantReason: RouteDifficulty},
+		{name: "Size escalation", policy: RoutingPolicy{Models: models, StrongModels: []string{"gemini-2.5-pro"}, EscalateTokens: 1}, req: Request{Prompts: []string{"a longer prompt"}}, wantModel: "gemini-2.5-pro", wantReason: RouteSize},
+		{name: "No strong model fits", policy: RoutingPolicy{Models: []string{"gpt-5-mini", "gemini-2.5-flash", "gemini-2.5-pro"}, StrongModels: []string{"claude-opus-4-1"}}, req: medium, difficulty: DifficultyHard, wantModel: "gemini-2.5-pro", wantReason: RouteDifficulty},
+		{name: "Nothing fits", policy: RoutingPolicy{Models: models}, req: huge, wantErr: true},
+		{name: "Unknown model", policy: RoutingPolicy{Models: []string{"no-such-model"}}, req: small, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.Choose(tt.req, tt.difficulty)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("RoutingPolicy.Choose() error = nil, wantErr %v", tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RoutingPolicy.Choose() error = %v", err)
+			}
+			if got.Model != tt.wantModel || got.Reason != tt.wantReason {
+				t.Errorf("RoutingPolicy.Choose() = %s (%s), want %s (%s)", got.Model, got.Reason, tt.wantModel, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestRoutingPolicy_ChooseDefaultModels(t *testing.T) {
+	for _, name := range []string{"ANTHROPIC_API_KEY", "OPENAI_API_KEY", "MISTRAL_API_KEY", "DEEPSEEK_API_KEY",
+		"VERTEX_PROJECT", "GOOGLE_CLOUD_PROJECT", "VERTEX_LOCATION", "GOOGLE_CLOUD_LOCATION"} {
+		t.Setenv(name, "")
+	}
+	small := Request{Prompts: []string{"hello"}}
+
+	// only the models of providers with credentials are candidates
+	t.Setenv("GEMINI_API_KEY", "key")
+	got, err := RoutingPolicy{}.Choose(small, DifficultyNormal)
+	if err != nil {
+		t.Fatalf("RoutingPolicy.Choose() error = %v", err)
+	}
+	if got.Model != "gemini-2.5-flash" || got.Provider != Gemini {
+		t.Errorf("RoutingPolicy.Choose() = %s (%s), want gemini-2.5-flash (gemini)", got.Model, got.Provider)
+	}
+
+	// the provider hook serves the models through another provider
+	t.Setenv("GEMINI_API_KEY", "")
+	t.Setenv("VERTEX_PROJECT", "project")
+	t.Setenv("VERTEX_LOCATION", "us-east5")
+	vertex := func(model string) string {
+		if provider := modelRegistry[model].Provider; provider == Anthropic || provider == Gemini {
+			return Vertex
+		}
+		return modelRegistry[model].Provider
+	}
+	got, err = RoutingPolicy{Provider: vertex}.Choose(small, DifficultyNormal)
+	if err != nil {
+		t.Fatalf("RoutingPolicy.Choose() error = %v", err)
+	}
+	if got.Model != "gemini-2.5-flash" || got.Provider != Vertex {
+		t.Errorf("RoutingPolicy.Choose() = %s (%s), want gemini-2.5-flash (vertex)", got.Model, got.Provider)
+	}
+
+	// without credentials there is no candidate
+	if _, err := (RoutingPolicy{}).Choose(small, DifficultyNormal); err == nil {
+		t.Error("RoutingPolicy.Choose() error = nil without credentials")
+	}
+}
+
+func TestRouterClient_Query(t *testing.T) {
+	t.Setenv("MOCK_FIXTURE", "")
+	t.Setenv("MOCK_RECORD", "")
+
+	client, err := NewRouterClient(RoutingPolicy{Models: []string{"mock"}})
+	if err != nil {
+		t.Fatalf("NewRouterClient() error = %v", err)
+	}
+	defer client.Close()
+
+	resp, err := client.Query(WithDifficulty(context.Background(), DifficultyHard), Request{System: assistant, Prompts: []string{"hello"}})
+	if err != nil {
+		t.Fatalf("RouterClient.Query() error = %v", err)
+	}
+	if resp.Text != "hello" || resp.Model != "mock" {
+		t.Errorf("RouterClient.Query() = %q from %s", resp.Text, resp.Model)
+	}
+	if resp.Metadata[MetadataRouteModel] != "mock" || resp.Metadata[MetadataRouteReason] != RouteDifficulty {
+		t.Errorf("RouterClient.Query() metadata = %v", resp.Metadata)
+	}
+
+	if _, err := NewRouterClient(RoutingPolicy{StrongModels: []string{"no-such-model"}}); err == nil {
+		t.Error("NewRouterClient() error = nil for unknown model")
+	}
+}
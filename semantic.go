@@ -0,0 +1,252 @@
+// Package sqirvy provides a semantic response cache.
+//
+// This file implements SemanticCache, an in-process index of prompt embeddings,
+// and SemanticCacheClient, a Client wrapper that answers a request with the
+// response of an earlier request whose prompts are similar enough. Entries are
+// only compared within the same scope: the same provider, model and system
+// prompt. Unlike CachedClient, a hit may answer a differently worded question,
+// so semantic hits are marked in the response metadata.
+package sqirvy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CacheHitSemantic is the MetadataCache value of a semantic cache hit
+	CacheHitSemantic = "semantic"
+	// MetadataCacheSimilarity is the response metadata key holding the cosine
+	// similarity of a semantic cache hit
+	MetadataCacheSimilarity = "cache_similarity"
+)
+
+// default minimum cosine similarity of a semantic cache hit
+const semanticThresholdDefault = 0.95
+
+// SemanticCacheConfig configures a SemanticCache. Zero fields use the defaults.
+type SemanticCacheConfig struct {
+	// Threshold is the minimum cosine similarity of a hit (default 0.95)
+	Threshold float64
+	// TTL is how long an entry is valid (default: no expiry)
+	TTL time.Duration
+	// MaxEntries is the maximum number of entries, least recently used are evicted first
+	// (default: no limit)
+	MaxEntries int
+}
+
+// semanticEntry is an entry of a SemanticCache
+type semanticEntry struct {
+	scope    string
+	vector   []float32
+	resp     *Response
+	expires  time.Time // zero if the entry does not expire
+	lastUsed time.Time
+}
+
+// SemanticCache is an in-process index of prompt embeddings and their responses.
+type SemanticCache struct {
+	embedder Embedder
+	config   SemanticCacheConfig
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries []*semanticEntry
+	hits    int64
+	misses  int64
+}
+
+// NewSemanticCache creates an empty semantic cache that embeds prompts with embedder.
+func NewSemanticCache(embedder Embedder, config SemanticCacheConfig) *SemanticCache {
+	if config.Threshold <= 0 {
+		config.Threshold = semanticThresholdDefault
+	}
+	return &SemanticCache{embedder: embedder, config: config, now: time.Now}
+}
+
+// SemanticScope returns the scope of a request sent to provider. Only entries of
+// the same scope, with the same provider, model, system prompt and conversation
+// history, can match.
+func SemanticScope(provider string, req Request) string {
+	scope := provider + "\x00" + req.Model + "\x00" + req.System
+	if len(req.History) > 0 {
+		history, _ := json.Marshal(req.History)
+		scope += "\x00" + string(history)
+	}
+	sum := sha256.Sum256([]byte(scope))
+	return hex.EncodeToString(sum[:])
+}
+
+// semanticText returns the text of a request that is embedded
+func semanticText(req Request) string {
+	return strings.Join(req.Prompts, "\n\n")
+}
+
+// Embed returns the embedding of a request's prompts.
+func (c *SemanticCache) Embed(ctx context.Context, req Request) ([]float32, error) {
+	vectors, err := c.embedder.Embed(ctx, []string{semanticText(req)})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("embedder returned %d vectors for 1 text", len(vectors))
+	}
+	return vectors[0], nil
+}
+
+// Lookup returns the response of the most similar unexpired entry in scope whose
+// similarity to vector is at least the threshold, and its similarity.
+func (c *SemanticCache) Lookup(scope string, vector []float32) (*Response, float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+
+	var best *semanticEntry
+	bestSim := 0.0
+	live := c.entries[:0]
+	for _, e := range c.entries {
+		if !e.expires.IsZero() && !now.Before(e.expires) {
+			continue
+		}
+		live = append(live, e)
+		if e.scope != scope {
+			continue
+		}
+		if sim := CosineSimilarity(vector, e.vector); sim >= c.config.Threshold && sim > bestSim {
+			best, bestSim = e, sim
+		}
+	}
+	clear(c.entries[len(live):])
+	c.entries = live
+
+	if best == nil {
+		c.misses++
+		return nil, 0, false
+	}
+	best.lastUsed = now
+	c.hits++
+	return best.resp, bestSim, true
+}
+
+// Store adds the response of a request in scope with the embedding vector,
+// evicting the least recently used entry if the cache is full.
+func (c *SemanticCache) Store(scope string, vector []float32, resp *Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	entry := &semanticEntry{scope: scope, vector: vector, resp: resp, lastUsed: now}
+	if c.config.TTL > 0 {
+		entry.expires = now.Add(c.config.TTL)
+	}
+	if c.config.MaxEntries > 0 && len(c.entries) >= c.config.MaxEntries {
+		oldest := 0
+		for i, e := range c.entries {
+			if e.lastUsed.Before(c.entries[oldest].lastUsed) {
+				oldest = i
+			}
+		}
+		c.entries = append(c.entries[:oldest], c.entries[oldest+1:]...)
+	}
+	c.entries = append(c.entries, entry)
+}
+
+// Clear removes all entries and resets the statistics.
+func (c *SemanticCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+	c.hits, c.misses = 0, 0
+}
+
+// Stats returns the number of entries and the hit and miss counts. Bytes is not reported.
+func (c *SemanticCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Entries: len(c.entries), Hits: c.hits, Misses: c.misses}
+}
+
+// SemanticCacheClient wraps a Client and answers requests from a SemanticCache
+// when an earlier request in the same scope had similar prompts.
+type SemanticCacheClient struct {
+	client   Client
+	provider string
+	cache    *SemanticCache
+}
+
+// Ensure SemanticCacheClient implements the Client and Querier interfaces
+var (
+	_ Client  = (*SemanticCacheClient)(nil)
+	_ Querier = (*SemanticCacheClient)(nil)
+)
+
+// NewSemanticCacheClient wraps client with the semantic cache. provider is part of
+// the scope, so the same model served by different providers is cached separately.
+func NewSemanticCacheClient(client Client, provider string, cache *SemanticCache) *SemanticCacheClient {
+	return &SemanticCacheClient{client: client, provider: provider, cache: cache}
+}
+
+// QueryText returns a cached response or sends the query to the wrapped client.
+func (c *SemanticCacheClient) QueryText(ctx context.Context, system string, prompts []string, model string, options Options) (string, error) {
+	return queryText(ctx, c, system, prompts, model, options)
+}
+
+// Query implements the Querier interface. A semantic hit has the MetadataCache
+// metadata set to "semantic" and MetadataCacheSimilarity to the similarity. If
+// the prompts cannot be embedded, the request is sent without the cache. If the
+// request has a StreamFunc, a cached response is passed to it as a single chunk.
+func (c *SemanticCacheClient) Query(ctx context.Context, req Request) (*Response, error) {
+	return c.intercept(ctx, req, ClientHandler(c.client))
+}
+
+// intercept implements the middleware of the client, sending requests to next
+func (c *SemanticCacheClient) intercept(ctx context.Context, req Request, next Handler) (*Response, error) {
+	scope := SemanticScope(c.provider, req)
+	vector, err := c.cache.Embed(ctx, req)
+	if err != nil {
+		return next(ctx, req)
+	}
+
+	if cached, sim, ok := c.cache.Lookup(scope, vector); ok {
+		if req.Options.StreamFunc != nil {
+			if err := req.Options.StreamFunc(ctx, []byte(cached.Text)); err != nil {
+				return nil, err
+			}
+		}
+		resp := *cached
+		resp.Metadata = maps.Clone(cached.Metadata)
+		if resp.Metadata == nil {
+			resp.Metadata = make(map[string]string)
+		}
+		resp.Metadata[MetadataCache] = CacheHitSemantic
+		resp.Metadata[MetadataCacheSimilarity] = strconv.FormatFloat(sim, 'f', 4, 64)
+		return &resp, nil
+	}
+
+	resp, err := next(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	stored := *resp
+	stored.Metadata = maps.Clone(resp.Metadata)
+	c.cache.Store(scope, vector, &stored)
+	return resp, nil
+}
+
+// SemanticCacheMiddleware returns the middleware of a SemanticCacheClient: it answers
+// requests similar to earlier ones from the cache.
+func SemanticCacheMiddleware(provider string, cache *SemanticCache) Middleware {
+	return NewSemanticCacheClient(nil, provider, cache).intercept
+}
+
+// Close closes the wrapped client.
+func (c *SemanticCacheClient) Close() error {
+	return c.client.Close()
+}
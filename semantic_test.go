@@ -0,0 +1,151 @@
+package sqirvy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float32
+		want float64
+	}{
+		{"Identical", []float32{1, 2, 3}, []float32{1, 2, 3}, 1},
+		{"Scaled", []float32{1, 2, 3}, []float32{2, 4, 6}, 1},
+		{"Orthogonal", []float32{1, 0}, []float32{0, 1}, 0},
+		{"Opposite", []float32{1, 0}, []float32{-1, 0}, -1},
+		{"Zero", []float32{0, 0}, []float32{1, 0}, 0},
+		{"Length mismatch", []float32{1}, []float32{1, 0}, 0},
+	}
+	for _, tt := range tests {
+		if got := CosineSimilarity(tt.a, tt.b); got < tt.want-1e-9 || got > tt.want+1e-9 {
+			t.Errorf("%s: CosineSimilarity() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// failingEmbedder is an Embedder that always fails
+type failingEmbedder struct{}
+
+func (failingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return nil, errors.New("embeddings unavailable")
+}
+
+func TestSemanticCacheClient(t *testing.T) {
+	mock := NewMockClientWithResponses(MockResponse{Text: "Paris"})
+	cache := NewSemanticCache(MockEmbedder{}, SemanticCacheConfig{Threshold: 0.8})
+	client := NewSemanticCacheClient(mock, Mock, cache)
+	ctx := context.Background()
+
+	query := func(system, prompt, model string) *Response {
+		t.Helper()
+		resp, err := Query(ctx, client, Request{System: system, Prompts: []string{prompt}, Model: model})
+		if err != nil {
+			t.Fatalf("Query(%q) error = %v", prompt, err)
+		}
+		return resp
+	}
+
+	first := query(assistant, "What is the capital city of France?", "mock")
+	if first.Metadata[MetadataCache] != "" {
+		t.Errorf("first response cache metadata = %q, want none", first.Metadata[MetadataCache])
+	}
+
+	reworded := query(assistant, "what is the capital city of france", "mock")
+	if reworded.Metadata[MetadataCache] != CacheHitSemantic || reworded.Metadata[MetadataCacheSimilarity] == "" {
+		t.Errorf("reworded response metadata = %v, want semantic hit", reworded.Metadata)
+	}
+	if reworded.Text != first.Text {
+		t.Errorf("reworded response = %q, want %q", reworded.Text, first.Text)
+	}
+
+	// unrelated prompts, other system prompts and other models miss
+	query(assistant, "How do I bake sourdough bread?", "mock")
+	query("You are a pirate.", "What is the capital city of France?", "mock")
+	query(assistant, "What is the capital city of France?", "mock-2")
+
+	if n := len(mock.Requests()); n != 4 {
+		t.Errorf("mock received %d requests, want 4", n)
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 4 || stats.Entries != 4 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestSemanticCache_Expiry(t *testing.T) {
+	cache := NewSemanticCache(MockEmbedder{}, SemanticCacheConfig{TTL: time.Minute, MaxEntries: 2})
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	store := func(prompt string) []float32 {
+		req := Request{Prompts: []string{prompt}}
+		v, err := cache.Embed(ctx, req)
+		if err != nil {
+			t.Fatalf("Embed() error = %v", err)
+		}
+		cache.Store("scope", v, &Response{Text: prompt})
+		return v
+	}
+	a := store("alpha")
+	now = now.Add(time.Second)
+	b := store("beta")
+	now = now.Add(time.Second)
+	if _, _, ok := cache.Lookup("scope", a); !ok {
+		t.Errorf("Lookup(alpha) = miss")
+	}
+	// beta is the least recently used entry and is evicted
+	store("gamma")
+	if _, _, ok := cache.Lookup("scope", b); ok {
+		t.Errorf("Lookup(beta) = hit after eviction")
+	}
+	if _, _, ok := cache.Lookup("other", a); ok {
+		t.Errorf("Lookup() in another scope = hit")
+	}
+
+	now = now.Add(time.Hour)
+	if _, _, ok := cache.Lookup("scope", a); ok {
+		t.Errorf("Lookup() of expired entry = hit")
+	}
+	if n := cache.Stats().Entries; n != 0 {
+		t.Errorf("Stats().Entries = %d after expiry, want 0", n)
+	}
+}
+
+func TestSemanticCacheClient_EmbedderFailure(t *testing.T) {
+	mock := NewMockClientWithResponses(MockResponse{Text: "ok"})
+	client := NewSemanticCacheClient(mock, Mock, NewSemanticCache(failingEmbedder{}, SemanticCacheConfig{}))
+	for i := 0; i < 2; i++ {
+		if _, err := Query(context.Background(), client, Request{Prompts: []string{"hi"}, Model: "mock"}); err != nil {
+			t.Fatalf("Query() error = %v", err)
+		}
+	}
+	if n := len(mock.Requests()); n != 2 {
+		t.Errorf("mock received %d requests, want 2", n)
+	}
+}
+
+func TestNewClient_SemanticInsideExactCache(t *testing.T) {
+	t.Setenv("MOCK_FIXTURE", "")
+	t.Setenv("MOCK_RECORD", "")
+	exact := NewMemoryCache(CacheConfig{})
+	client, err := NewClient(Mock,
+		WithCache(exact),
+		WithSemanticCache(NewSemanticCache(MockEmbedder{}, SemanticCacheConfig{Threshold: 0.8})))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	ctx := context.Background()
+	Query(ctx, client, Request{Prompts: []string{"the capital of France?"}, Model: "mock"})
+	resp, _ := Query(ctx, client, Request{Prompts: []string{"The capital of France"}, Model: "mock"})
+	if resp.Metadata[MetadataCache] != CacheHitSemantic {
+		t.Errorf("reworded response cache = %q, want semantic", resp.Metadata[MetadataCache])
+	}
+	// the semantic hit is not stored as an exact match
+	if stats, _ := exact.Stats(); stats.Entries != 1 {
+		t.Errorf("exact cache entries = %d, want 1", stats.Entries)
+	}
+}
@@ -0,0 +1,120 @@
+package sqirvytest
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// anthropicFormat implements the Anthropic Messages wire format
+type anthropicFormat struct{}
+
+// NewAnthropicServer starts a fake Anthropic Messages API server.
+// The server is closed when the test ends.
+func NewAnthropicServer(t testing.TB) *Server {
+	return newServer(t, anthropicFormat{})
+}
+
+func (anthropicFormat) route(r *http.Request, body map[string]any) (bool, bool) {
+	stream, _ := body["stream"].(bool)
+	return strings.HasSuffix(r.URL.Path, "/messages"), stream
+}
+
+func (anthropicFormat) env(url string) map[string]string {
+	return map[string]string{
+		"ANTHROPIC_API_KEY":  TestAPIKey,
+		"ANTHROPIC_BASE_URL": url,
+	}
+}
+
+func (anthropicFormat) usage(reply Reply) map[string]any {
+	return map[string]any{
+		"input_tokens":                reply.InputTokens,
+		"output_tokens":               reply.OutputTokens,
+		"cache_creation_input_tokens": reply.CacheWriteTokens,
+		"cache_read_input_tokens":     reply.CacheReadTokens,
+	}
+}
+
+func (anthropicFormat) stopReason(reply Reply) string {
+	if reply.StopReason != "" {
+		return reply.StopReason
+	}
+	return "end_turn"
+}
+
+func (f anthropicFormat) writeText(w http.ResponseWriter, reply Reply, body map[string]any) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":            "msg_sqirvytest",
+		"type":          "message",
+		"role":          "assistant",
+		"model":         stringField(body, "model"),
+		"content":       []any{map[string]any{"type": "text", "text": reply.Text}},
+		"stop_reason":   f.stopReason(reply),
+		"stop_sequence": nil,
+		"usage":         f.usage(reply),
+	})
+}
+
+func (f anthropicFormat) writeStream(w http.ResponseWriter, reply Reply, body map[string]any) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+
+	writeEvent(w, "message_start", map[string]any{
+		"type": "message_start",
+		"message": map[string]any{
+			"id":      "msg_sqirvytest",
+			"type":    "message",
+			"role":    "assistant",
+			"model":   stringField(body, "model"),
+			"content": []any{},
+			"usage": map[string]any{
+				"input_tokens":                reply.InputTokens,
+				"output_tokens":               0,
+				"cache_creation_input_tokens": reply.CacheWriteTokens,
+				"cache_read_input_tokens":     reply.CacheReadTokens,
+			},
+		},
+	})
+	writeEvent(w, "content_block_start", map[string]any{
+		"type":          "content_block_start",
+		"index":         0,
+		"content_block": map[string]any{"type": "text", "text": ""},
+	})
+	for _, chunk := range chunks(reply.Text) {
+		writeEvent(w, "content_block_delta", map[string]any{
+			"type":  "content_block_delta",
+			"index": 0,
+			"delta": map[string]any{"type": "text_delta", "text": chunk},
+		})
+	}
+	writeEvent(w, "content_block_stop", map[string]any{"type": "content_block_stop", "index": 0})
+	writeEvent(w, "message_delta", map[string]any{
+		"type":  "message_delta",
+		"delta": map[string]any{"stop_reason": f.stopReason(reply)},
+		"usage": map[string]any{"output_tokens": reply.OutputTokens},
+	})
+	writeEvent(w, "message_stop", map[string]any{"type": "message_stop"})
+}
+
+func (anthropicFormat) writeError(w http.ResponseWriter, reply Reply) {
+	errorType := reply.ErrorType
+	if errorType == "" {
+		switch reply.Status {
+		case http.StatusTooManyRequests:
+			errorType = "rate_limit_error"
+		case 529:
+			errorType = "overloaded_error"
+		case http.StatusBadRequest:
+			errorType = "invalid_request_error"
+		case http.StatusUnauthorized:
+			errorType = "authentication_error"
+		default:
+			errorType = "api_error"
+		}
+	}
+	writeJSON(w, reply.Status, map[string]any{
+		"type":  "error",
+		"error": map[string]any{"type": errorType, "message": reply.Text},
+	})
+}
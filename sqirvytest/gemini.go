@@ -0,0 +1,117 @@
+package sqirvytest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// geminiFormat implements the Gemini generateContent wire format
+type geminiFormat struct{}
+
+// NewGeminiServer starts a fake Gemini generateContent API server.
+// The server is closed when the test ends.
+func NewGeminiServer(t testing.TB) *Server {
+	return newServer(t, geminiFormat{})
+}
+
+func (geminiFormat) route(r *http.Request, body map[string]any) (bool, bool) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, ":generateContent"):
+		return true, false
+	case strings.HasSuffix(r.URL.Path, ":streamGenerateContent"):
+		return true, true
+	}
+	return false, false
+}
+
+func (geminiFormat) env(url string) map[string]string {
+	return map[string]string{
+		"GEMINI_API_KEY":  TestAPIKey,
+		"GEMINI_BASE_URL": url,
+	}
+}
+
+// handleResource creates cached contents (POST .../cachedContents). The name of a
+// cached content is derived from the request body, and its token count is the body
+// size divided by four.
+func (geminiFormat) handleResource(w http.ResponseWriter, r *http.Request, body []byte) bool {
+	if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/cachedContents") {
+		return false
+	}
+	sum := sha256.Sum256(body)
+	var req map[string]any
+	_ = json.Unmarshal(body, &req)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"name":          "cachedContents/sqirvytest-" + hex.EncodeToString(sum[:8]),
+		"model":         stringField(req, "model"),
+		"usageMetadata": map[string]any{"totalTokenCount": len(body) / 4},
+	})
+	return true
+}
+
+func (geminiFormat) response(text string, reply Reply, final bool) map[string]any {
+	candidate := map[string]any{
+		"content": map[string]any{"role": "model", "parts": []any{map[string]any{"text": text}}},
+		"index":   0,
+	}
+	if final {
+		stop := reply.StopReason
+		if stop == "" {
+			stop = "STOP"
+		}
+		candidate["finishReason"] = stop
+	}
+	return map[string]any{
+		"candidates": []any{candidate},
+		"usageMetadata": map[string]any{
+			"promptTokenCount":        reply.InputTokens,
+			"candidatesTokenCount":    reply.OutputTokens,
+			"totalTokenCount":         reply.InputTokens + reply.OutputTokens,
+			"cachedContentTokenCount": reply.CacheReadTokens,
+		},
+	}
+}
+
+func (f geminiFormat) writeText(w http.ResponseWriter, reply Reply, body map[string]any) {
+	writeJSON(w, http.StatusOK, f.response(reply.Text, reply, true))
+}
+
+// writeStream writes the streamed response as a json array, which is what the
+// Gemini REST api returns for streamGenerateContent without alt=sse
+func (f geminiFormat) writeStream(w http.ResponseWriter, reply Reply, body map[string]any) {
+	parts := chunks(reply.Text)
+	if len(parts) == 0 {
+		parts = []string{""}
+	}
+	var responses []any
+	for i, text := range parts {
+		responses = append(responses, f.response(text, reply, i == len(parts)-1))
+	}
+	data, _ := json.Marshal(responses)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func (geminiFormat) writeError(w http.ResponseWriter, reply Reply) {
+	status := reply.ErrorType
+	if status == "" {
+		switch reply.Status {
+		case http.StatusTooManyRequests:
+			status = "RESOURCE_EXHAUSTED"
+		case http.StatusServiceUnavailable:
+			status = "UNAVAILABLE"
+		case http.StatusBadRequest:
+			status = "INVALID_ARGUMENT"
+		default:
+			status = "INTERNAL"
+		}
+	}
+	writeJSON(w, reply.Status, map[string]any{
+		"error": map[string]any{"code": reply.Status, "message": reply.Text, "status": status},
+	})
+}
@@ -0,0 +1,105 @@
+package sqirvytest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// openaiFormat implements the OpenAI Chat Completions wire format
+type openaiFormat struct{}
+
+// NewOpenAIServer starts a fake OpenAI Chat Completions API server.
+// The server is closed when the test ends.
+func NewOpenAIServer(t testing.TB) *Server {
+	return newServer(t, openaiFormat{})
+}
+
+func (openaiFormat) route(r *http.Request, body map[string]any) (bool, bool) {
+	stream, _ := body["stream"].(bool)
+	return strings.HasSuffix(r.URL.Path, "/chat/completions"), stream
+}
+
+func (openaiFormat) env(url string) map[string]string {
+	return map[string]string{
+		"OPENAI_API_KEY":  TestAPIKey,
+		"OPENAI_BASE_URL": url + "/v1",
+	}
+}
+
+func (openaiFormat) stopReason(reply Reply) string {
+	if reply.StopReason != "" {
+		return reply.StopReason
+	}
+	return "stop"
+}
+
+func (openaiFormat) usage(reply Reply) map[string]any {
+	return map[string]any{
+		"prompt_tokens":     reply.InputTokens,
+		"completion_tokens": reply.OutputTokens,
+		"total_tokens":      reply.InputTokens + reply.OutputTokens,
+		"prompt_tokens_details": map[string]any{
+			"cached_tokens": reply.CacheReadTokens,
+		},
+	}
+}
+
+func (f openaiFormat) writeText(w http.ResponseWriter, reply Reply, body map[string]any) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":      "chatcmpl-sqirvytest",
+		"object":  "chat.completion",
+		"created": 0,
+		"model":   stringField(body, "model"),
+		"choices": []any{map[string]any{
+			"index":         0,
+			"message":       map[string]any{"role": "assistant", "content": reply.Text},
+			"finish_reason": f.stopReason(reply),
+		}},
+		"usage": f.usage(reply),
+	})
+}
+
+func (f openaiFormat) writeStream(w http.ResponseWriter, reply Reply, body map[string]any) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+
+	chunk := func(delta map[string]any, finish any) map[string]any {
+		return map[string]any{
+			"id":      "chatcmpl-sqirvytest",
+			"object":  "chat.completion.chunk",
+			"created": 0,
+			"model":   stringField(body, "model"),
+			"choices": []any{map[string]any{"index": 0, "delta": delta, "finish_reason": finish}},
+		}
+	}
+
+	writeEvent(w, "", chunk(map[string]any{"role": "assistant", "content": ""}, nil))
+	for _, text := range chunks(reply.Text) {
+		writeEvent(w, "", chunk(map[string]any{"content": text}, nil))
+	}
+	final := chunk(map[string]any{}, f.stopReason(reply))
+	final["usage"] = f.usage(reply)
+	writeEvent(w, "", final)
+	_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func (openaiFormat) writeError(w http.ResponseWriter, reply Reply) {
+	errorType := reply.ErrorType
+	if errorType == "" {
+		switch reply.Status {
+		case http.StatusTooManyRequests:
+			errorType = "rate_limit_exceeded"
+		case http.StatusBadRequest:
+			errorType = "invalid_request_error"
+		case http.StatusUnauthorized:
+			errorType = "invalid_api_key"
+		default:
+			errorType = "server_error"
+		}
+	}
+	writeJSON(w, reply.Status, map[string]any{
+		"error": map[string]any{"message": reply.Text, "type": errorType, "code": errorType},
+	})
+}
@@ -0,0 +1,266 @@
+// Package sqirvytest provides in-process fake provider HTTP servers for integration tests.
+//
+// Each server speaks the wire format of one provider API:
+//   - Anthropic Messages (POST .../messages)
+//   - OpenAI Chat Completions (POST .../chat/completions)
+//   - Gemini generateContent (POST .../models/{model}:generateContent) and
+//     cached contents (POST .../cachedContents)
+//
+// Tests point the real sqirvy clients at a server with Setenv, queue replies,
+// and then assert on the exact JSON requests that went over the wire.
+//
+//	srv := sqirvytest.NewAnthropicServer(t)
+//	srv.Setenv(t)
+//	srv.Reply("Hello, World!")
+//	client, _ := sqirvy.NewAnthropicClient()
+//	client.QueryText(ctx, system, prompts, model, sqirvy.Options{})
+//	body := srv.LastRequest().JSON()
+package sqirvytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestAPIKey is the api key set by Setenv. It satisfies the key format checks of the clients.
+const TestAPIKey = "sk-sqirvytest-0123456789abcdef"
+
+// DefaultReplyText is returned when no replies are queued.
+const DefaultReplyText = "ok"
+
+// Request is a request received by a Server.
+type Request struct {
+	Method string
+	Path   string
+	Query  string
+	Header http.Header
+	Body   []byte
+}
+
+// JSON decodes the request body into a map.
+// It returns nil if the body is not a JSON object.
+func (r Request) JSON() map[string]any {
+	var m map[string]any
+	if err := json.Unmarshal(r.Body, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+// Reply is a scripted response returned by a Server.
+type Reply struct {
+	// Status is the http status code, 200 if zero
+	Status int
+	// Text is the response text for successful replies, or the error message otherwise
+	Text string
+	// ErrorType is the provider error type for error replies, e.g. "overloaded_error".
+	// If empty, the provider error type matching Status is used.
+	ErrorType string
+	// Header holds extra response headers, e.g. rate limit headers
+	Header map[string]string
+	// InputTokens and OutputTokens are reported in the response usage
+	InputTokens  int
+	OutputTokens int
+	// CacheReadTokens and CacheWriteTokens are reported in the response usage as the
+	// prompt tokens read from and written to the provider prompt cache
+	CacheReadTokens  int
+	CacheWriteTokens int
+	// StopReason is the provider stop reason, the provider default if empty
+	StopReason string
+	// Delay holds the response for this duration, or until the request is canceled
+	Delay time.Duration
+}
+
+// wireFormat writes responses in the format of one provider api
+type wireFormat interface {
+	// route reports whether the request path is handled and whether it is a streaming request
+	route(r *http.Request, body map[string]any) (ok bool, stream bool)
+	writeText(w http.ResponseWriter, reply Reply, body map[string]any)
+	writeStream(w http.ResponseWriter, reply Reply, body map[string]any)
+	writeError(w http.ResponseWriter, reply Reply)
+	// env returns the environment variables that point a client at the server
+	env(url string) map[string]string
+}
+
+// resourceHandler is implemented by wire formats that serve requests other than
+// queries. Those requests are recorded but do not consume queued replies.
+type resourceHandler interface {
+	// handleResource writes the response and reports whether the request was handled
+	handleResource(w http.ResponseWriter, r *http.Request, body []byte) bool
+}
+
+// Server is a fake provider api server backed by httptest.
+// It is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	format   wireFormat
+	mu       sync.Mutex
+	replies  []Reply
+	requests []Request
+}
+
+// newServer starts a server for the wire format and closes it when the test ends
+func newServer(t testing.TB, format wireFormat) *Server {
+	t.Helper()
+	s := &Server{format: format}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Setenv sets the environment variables that point the matching sqirvy client at the server,
+// including a test api key. The variables are restored when the test ends.
+func (s *Server) Setenv(t testing.TB) {
+	t.Helper()
+	for k, v := range s.format.env(s.URL) {
+		t.Setenv(k, v)
+	}
+}
+
+// Enqueue adds replies that are returned in order, one per request.
+// When the queue is empty, a DefaultReplyText reply is returned.
+func (s *Server) Enqueue(replies ...Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = append(s.replies, replies...)
+}
+
+// Reply queues a successful reply with the given text.
+func (s *Server) Reply(text string) {
+	s.Enqueue(Reply{Text: text, InputTokens: 10, OutputTokens: len(text)})
+}
+
+// ReplyError queues an error reply in the provider error format.
+// An empty errorType uses the provider error type matching the status.
+func (s *Server) ReplyError(status int, errorType string, message string) {
+	s.Enqueue(Reply{Status: status, ErrorType: errorType, Text: message})
+}
+
+// ReplyRateLimit queues a 429 reply with a retry-after header.
+func (s *Server) ReplyRateLimit(retryAfter time.Duration) {
+	s.Enqueue(Reply{
+		Status: http.StatusTooManyRequests,
+		Text:   "rate limit exceeded",
+		Header: map[string]string{"Retry-After": strconv.Itoa(int(retryAfter.Seconds()))},
+	})
+}
+
+// Requests returns a copy of the requests received so far, in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// LastRequest returns the most recent request received, or the zero Request if none.
+func (s *Server) LastRequest() Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.requests) == 0 {
+		return Request{}
+	}
+	return s.requests[len(s.requests)-1]
+}
+
+// handle records the request and writes the next reply
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.RawQuery,
+		Header: r.Header.Clone(),
+		Body:   data,
+	}
+	body := req.JSON()
+
+	if h, ok := s.format.(resourceHandler); ok && h.handleResource(w, r, data) {
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		s.mu.Unlock()
+		return
+	}
+
+	ok, stream := s.format.route(r, body)
+	if !ok || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	reply := Reply{Text: DefaultReplyText, InputTokens: 10, OutputTokens: 1}
+	if len(s.replies) > 0 {
+		reply = s.replies[0]
+		s.replies = s.replies[1:]
+	}
+	s.mu.Unlock()
+
+	if reply.Delay > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(reply.Delay):
+		}
+	}
+
+	for k, v := range reply.Header {
+		w.Header().Set(k, v)
+	}
+
+	switch {
+	case reply.Status != 0 && reply.Status != http.StatusOK:
+		s.format.writeError(w, reply)
+	case stream:
+		s.format.writeStream(w, reply, body)
+	default:
+		s.format.writeText(w, reply, body)
+	}
+}
+
+// writeJSON writes v as a json response with the given status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeEvent writes one server-sent event and flushes it
+func writeEvent(w http.ResponseWriter, event string, v any) {
+	data, _ := json.Marshal(v)
+	if event != "" {
+		_, _ = fmt.Fprintf(w, "event: %s\n", event)
+	}
+	_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// chunks splits text into pieces for streaming replies
+func chunks(text string) []string {
+	const size = 8
+	var out []string
+	for i := 0; i < len(text); i += size {
+		out = append(out, text[i:min(i+size, len(text))])
+	}
+	return out
+}
+
+// stringField returns a string field of a decoded json body
+func stringField(body map[string]any, key string) string {
+	s, _ := body[key].(string)
+	return s
+}
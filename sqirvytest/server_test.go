@@ -0,0 +1,180 @@
+package sqirvytest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-llmclient"
+)
+
+const system = "you are a helpful assistant"
+
+func TestAnthropicServer(t *testing.T) {
+	srv := NewAnthropicServer(t)
+	srv.Setenv(t)
+
+	client, err := sqirvy.NewAnthropicClient()
+	if err != nil {
+		t.Fatalf("new client failed: %v", err)
+	}
+
+	srv.Reply("Hello, World!")
+	got, err := client.QueryText(context.Background(), system, []string{"Say hello"}, "claude-3-5-haiku-20241022", sqirvy.Options{Temperature: 0.5})
+	if err != nil {
+		t.Fatalf("QueryText() error = %v", err)
+	}
+	if got != "Hello, World!" {
+		t.Errorf("QueryText() = %q, want %q", got, "Hello, World!")
+	}
+
+	req := srv.LastRequest()
+	if req.Path != "/v1/messages" {
+		t.Errorf("request path = %s, want /v1/messages", req.Path)
+	}
+	if req.Header.Get("x-api-key") != TestAPIKey {
+		t.Errorf("x-api-key header = %s", req.Header.Get("x-api-key"))
+	}
+	body := req.JSON()
+	if body["model"] != "claude-3-5-haiku-20241022" {
+		t.Errorf("model = %v", body["model"])
+	}
+	if body["system"] != system {
+		t.Errorf("system = %v, want %s", body["system"], system)
+	}
+	if body["max_tokens"] != float64(sqirvy.GetMaxTokens("claude-3-5-haiku-20241022")) {
+		t.Errorf("max_tokens = %v", body["max_tokens"])
+	}
+
+	srv.ReplyError(529, "", "overloaded")
+	_, err = client.QueryText(context.Background(), system, []string{"Say hello"}, "claude-3-5-haiku-20241022", sqirvy.Options{})
+	if err == nil || !strings.Contains(err.Error(), "overloaded") {
+		t.Errorf("QueryText() error = %v, want overloaded error", err)
+	}
+}
+
+func TestAnthropicServer_Stream(t *testing.T) {
+	srv := NewAnthropicServer(t)
+	srv.Setenv(t)
+
+	client, err := sqirvy.NewAnthropicClient()
+	if err != nil {
+		t.Fatalf("new client failed: %v", err)
+	}
+
+	srv.Reply("a streamed response")
+	var streamed strings.Builder
+	options := sqirvy.Options{StreamFunc: func(ctx context.Context, chunk []byte) error {
+		streamed.Write(chunk)
+		return nil
+	}}
+	got, err := client.QueryText(context.Background(), system, []string{"Say hello"}, "claude-3-5-haiku-20241022", options)
+	if err != nil {
+		t.Fatalf("QueryText() error = %v", err)
+	}
+	if got != "a streamed response" || streamed.String() != got {
+		t.Errorf("QueryText() = %q, streamed %q", got, streamed.String())
+	}
+	if stream, _ := srv.LastRequest().JSON()["stream"].(bool); !stream {
+		t.Error("request did not ask for a stream")
+	}
+}
+
+func TestOpenAIServer(t *testing.T) {
+	srv := NewOpenAIServer(t)
+	srv.Setenv(t)
+
+	client, err := sqirvy.NewOpenAIClient()
+	if err != nil {
+		t.Fatalf("new client failed: %v", err)
+	}
+
+	srv.Reply("Hello, World!")
+	got, err := client.QueryText(context.Background(), system, []string{"Say hello"}, "gpt-5-mini", sqirvy.Options{Temperature: 0.5})
+	if err != nil {
+		t.Fatalf("QueryText() error = %v", err)
+	}
+	if got != "Hello, World!" {
+		t.Errorf("QueryText() = %q, want %q", got, "Hello, World!")
+	}
+
+	req := srv.LastRequest()
+	if req.Path != "/v1/chat/completions" {
+		t.Errorf("request path = %s, want /v1/chat/completions", req.Path)
+	}
+	if req.Header.Get("Authorization") != "Bearer "+TestAPIKey {
+		t.Errorf("Authorization header = %s", req.Header.Get("Authorization"))
+	}
+	body := req.JSON()
+	messages, _ := body["messages"].([]any)
+	if len(messages) != 2 {
+		t.Fatalf("messages = %v, want system and user messages", body["messages"])
+	}
+	first, _ := messages[0].(map[string]any)
+	if first["role"] != "system" || first["content"] != system {
+		t.Errorf("first message = %v", first)
+	}
+
+	srv.ReplyRateLimit(time.Second)
+	_, err = client.QueryText(context.Background(), system, []string{"Say hello"}, "gpt-5-mini", sqirvy.Options{})
+	if err == nil {
+		t.Error("QueryText() error = nil, want rate limit error")
+	}
+}
+
+// streamArraySupported reports whether encoding/json returns the closing ']' token
+// after a failed Decode. The Gemini REST stream reader in gax relies on it, and
+// some toolchains using the json v2 implementation do not.
+func streamArraySupported() bool {
+	d := json.NewDecoder(strings.NewReader(`[{}]`))
+	_, _ = d.Token()
+	var raw json.RawMessage
+	_ = d.Decode(&raw)
+	if d.Decode(&raw) == nil {
+		return false
+	}
+	t, _ := d.Token()
+	return t == json.Delim(']')
+}
+
+func TestGeminiServer(t *testing.T) {
+	if !streamArraySupported() {
+		t.Skip("gax stream reader is not supported by this encoding/json")
+	}
+
+	srv := NewGeminiServer(t)
+	srv.Setenv(t)
+
+	client, err := sqirvy.NewGeminiClient()
+	if err != nil {
+		t.Fatalf("new client failed: %v", err)
+	}
+
+	srv.Reply("Hello, World!")
+	got, err := client.QueryText(context.Background(), system, []string{"Say hello"}, "gemini-2.5-flash", sqirvy.Options{Temperature: 0.5})
+	if err != nil {
+		t.Fatalf("QueryText() error = %v", err)
+	}
+	if got != "Hello, World!" {
+		t.Errorf("QueryText() = %q, want %q", got, "Hello, World!")
+	}
+
+	req := srv.LastRequest()
+	// langchaingo sends chat requests as streaming requests
+	if !strings.HasSuffix(req.Path, "/models/gemini-2.5-flash:streamGenerateContent") {
+		t.Errorf("request path = %s", req.Path)
+	}
+	body := req.JSON()
+	if _, ok := body["systemInstruction"]; !ok {
+		t.Errorf("request body has no systemInstruction: %s", req.Body)
+	}
+
+	srv.ReplyError(http.StatusServiceUnavailable, "", "unavailable")
+	_, err = client.QueryText(context.Background(), system, []string{"Say hello"}, "gemini-2.5-flash", sqirvy.Options{})
+	if err == nil {
+		t.Error("QueryText() error = nil, want unavailable error")
+	}
+}
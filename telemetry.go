@@ -0,0 +1,201 @@
+// Package sqirvy provides OpenTelemetry instrumentation of queries.
+//
+// This file implements TelemetryClient, a Client wrapper that records a span and
+// metrics for each query following the OpenTelemetry GenAI semantic conventions:
+// a "chat {model}" client span with the gen_ai.* request, response and usage
+// attributes, and the gen_ai.client.operation.duration and gen_ai.client.token.usage
+// histograms, plus a sqirvy.client.requests counter. Telemetry is only recorded
+// with the tracer and meter providers passed to the client; the global providers
+// are not used.
+package sqirvy
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/semconv/v1.37.0/genaiconv"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+// instrumentationName is the name of the tracer and meter of this package
+const instrumentationName = "github.com/dmh2000/sqirvy-llmclient"
+
+// errorTypeOther is the error.type of errors that cannot be classified
+const errorTypeOther = "_OTHER"
+
+// TelemetryConfig configures a TelemetryClient. A nil provider disables that signal.
+type TelemetryConfig struct {
+	TracerProvider trace.TracerProvider
+	MeterProvider  metric.MeterProvider
+}
+
+// TelemetryClient wraps a Client and records OpenTelemetry spans and metrics for each query.
+type TelemetryClient struct {
+	client   Client
+	provider string
+	tracer   trace.Tracer
+
+	duration genaiconv.ClientOperationDuration
+	tokens   genaiconv.ClientTokenUsage
+	requests metric.Int64Counter
+}
+
+// Ensure TelemetryClient implements the Client and Querier interfaces
+var (
+	_ Client  = (*TelemetryClient)(nil)
+	_ Querier = (*TelemetryClient)(nil)
+)
+
+// NewTelemetryClient wraps client so that its queries are traced and measured
+// with the providers in config. Errors creating the instruments are reported to
+// the otel error handler and the instrument is not recorded.
+func NewTelemetryClient(client Client, provider string, config TelemetryConfig) *TelemetryClient {
+	tracerProvider := config.TracerProvider
+	if tracerProvider == nil {
+		tracerProvider = tracenoop.NewTracerProvider()
+	}
+	meterProvider := config.MeterProvider
+	if meterProvider == nil {
+		meterProvider = metricnoop.NewMeterProvider()
+	}
+	meter := meterProvider.Meter(instrumentationName)
+
+	c := &TelemetryClient{
+		client:   client,
+		provider: provider,
+		tracer:   tracerProvider.Tracer(instrumentationName),
+	}
+	var err error
+	if c.duration, err = genaiconv.NewClientOperationDuration(meter); err != nil {
+		otel.Handle(err)
+	}
+	if c.tokens, err = genaiconv.NewClientTokenUsage(meter); err != nil {
+		otel.Handle(err)
+	}
+	c.requests, err = meter.Int64Counter("sqirvy.client.requests",
+		metric.WithDescription("Number of GenAI queries."),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		otel.Handle(err)
+		c.requests = metricnoop.Int64Counter{}
+	}
+	return c
+}
+
+// genAIProviderName returns the gen_ai.provider.name of a provider
+func genAIProviderName(provider string) genaiconv.ProviderNameAttr {
+	switch provider {
+	case Anthropic:
+		return genaiconv.ProviderNameAnthropic
+	case Gemini:
+		return genaiconv.ProviderNameGCPGemini
+	case Vertex:
+		return genaiconv.ProviderNameGCPVertexAI
+	case OpenAI:
+		return genaiconv.ProviderNameOpenAI
+	case Mistral:
+		return genaiconv.ProviderNameMistralAI
+	case DeepSeek:
+		return genaiconv.ProviderNameDeepseek
+	}
+	return genaiconv.ProviderNameAttr(provider)
+}
+
+// errorType returns the error.type of an error returned by a client
+func errorType(err error) string {
+	if class := ClassifyError(err); class != ErrorUnknown {
+		return string(class)
+	}
+	return errorTypeOther
+}
+
+// QueryText sends the query to the wrapped client and records its telemetry.
+func (c *TelemetryClient) QueryText(ctx context.Context, system string, prompts []string, model string, options Options) (string, error) {
+	return queryText(ctx, c, system, prompts, model, options)
+}
+
+// Query implements the Querier interface. The span is the parent of any spans
+// started by the wrapped client, such as those of an instrumented http client.
+func (c *TelemetryClient) Query(ctx context.Context, req Request) (*Response, error) {
+	return c.intercept(ctx, req, ClientHandler(c.client))
+}
+
+// intercept implements the middleware of the client, sending requests to next
+func (c *TelemetryClient) intercept(ctx context.Context, req Request, next Handler) (*Response, error) {
+	operation := genaiconv.OperationNameChat
+	provider := genAIProviderName(c.provider)
+	ctx, span := c.tracer.Start(ctx, string(operation)+" "+req.Model,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.GenAIOperationNameKey.String(string(operation)),
+			semconv.GenAIProviderNameKey.String(string(provider)),
+			semconv.GenAIRequestModel(req.Model),
+			semconv.GenAIRequestTemperature(float64(req.Options.Temperature)),
+			semconv.GenAIRequestMaxTokens(int(req.Options.MaxTokens)),
+		),
+	)
+	defer span.End()
+
+	start := time.Now()
+	resp, err := next(ctx, req)
+	elapsed := time.Since(start).Seconds()
+
+	attrs := []attribute.KeyValue{semconv.GenAIRequestModel(req.Model)}
+	if err != nil {
+		errType := semconv.ErrorTypeKey.String(errorType(err))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(errType)
+		attrs = append(attrs, errType)
+	} else {
+		span.SetAttributes(responseAttributes(resp)...)
+		attrs = append(attrs, semconv.GenAIResponseModel(resp.Model))
+		c.tokens.Record(ctx, resp.Usage.InputTokens, operation, provider, genaiconv.TokenTypeInput, attrs...)
+		c.tokens.Record(ctx, resp.Usage.OutputTokens, operation, provider, genaiconv.TokenTypeOutput, attrs...)
+	}
+	c.duration.Record(ctx, elapsed, operation, provider, attrs...)
+	c.requests.Add(ctx, 1, metric.WithAttributes(append(attrs,
+		semconv.GenAIOperationNameKey.String(string(operation)),
+		semconv.GenAIProviderNameKey.String(string(provider)))...))
+	return resp, err
+}
+
+// responseAttributes returns the span attributes of a response
+func responseAttributes(resp *Response) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		semconv.GenAIResponseModel(resp.Model),
+		semconv.GenAIUsageInputTokens(int(resp.Usage.InputTokens)),
+		semconv.GenAIUsageOutputTokens(int(resp.Usage.OutputTokens)),
+	}
+	if resp.StopReason != "" {
+		attrs = append(attrs, semconv.GenAIResponseFinishReasons(resp.StopReason))
+	}
+	if resp.Usage.CacheReadTokens > 0 || resp.Usage.CacheWriteTokens > 0 {
+		attrs = append(attrs,
+			attribute.Int64("sqirvy.usage.cache_read_tokens", resp.Usage.CacheReadTokens),
+			attribute.Int64("sqirvy.usage.cache_write_tokens", resp.Usage.CacheWriteTokens),
+		)
+	}
+	if hit := resp.Metadata[MetadataCache]; hit != "" {
+		attrs = append(attrs, attribute.String("sqirvy.cache", hit))
+	}
+	return attrs
+}
+
+// TelemetryMiddleware returns the middleware of a TelemetryClient: it records a span
+// and metrics for each query.
+func TelemetryMiddleware(provider string, config TelemetryConfig) Middleware {
+	return NewTelemetryClient(nil, provider, config).intercept
+}
+
+// Close closes the wrapped client.
+func (c *TelemetryClient) Close() error {
+	return c.client.Close()
+}
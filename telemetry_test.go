@@ -0,0 +1,157 @@
+package sqirvy
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// testTelemetry returns tracer and meter providers that record in memory
+func testTelemetry() (*tracetest.SpanRecorder, *sdktrace.TracerProvider, *sdkmetric.ManualReader, *sdkmetric.MeterProvider) {
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	return spans, sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)),
+		reader, sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+}
+
+// spanAttributes returns the attributes of a span by key
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+// collectMetrics returns the metrics recorded by the reader by name
+func collectMetrics(t *testing.T, reader *sdkmetric.ManualReader) map[string]metricdata.Metrics {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	metrics := make(map[string]metricdata.Metrics)
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+	return metrics
+}
+
+func TestTelemetryClient(t *testing.T) {
+	spans, tracerProvider, reader, meterProvider := testTelemetry()
+	mock := NewMockClientWithResponses(MockResponse{Text: "hello"})
+	client := NewTelemetryClient(mock, Anthropic, TelemetryConfig{TracerProvider: tracerProvider, MeterProvider: meterProvider})
+
+	resp, err := client.Query(context.Background(), Request{System: assistant, Prompts: []string{"hi"}, Model: "claude-sonnet-4-20250514", Options: Options{Temperature: 0.5, MaxTokens: 100}})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+
+	ended := spans.Ended()
+	if len(ended) != 1 {
+		t.Fatalf("spans = %d, want 1", len(ended))
+	}
+	span := ended[0]
+	if span.Name() != "chat claude-sonnet-4-20250514" || span.SpanKind() != trace.SpanKindClient {
+		t.Errorf("span = %s (%v), want chat client span", span.Name(), span.SpanKind())
+	}
+	attrs := spanAttributes(span)
+	want := map[attribute.Key]attribute.Value{
+		"gen_ai.operation.name":      attribute.StringValue("chat"),
+		"gen_ai.provider.name":       attribute.StringValue("anthropic"),
+		"gen_ai.request.model":       attribute.StringValue("claude-sonnet-4-20250514"),
+		"gen_ai.request.max_tokens":  attribute.IntValue(100),
+		"gen_ai.usage.input_tokens":  attribute.IntValue(int(resp.Usage.InputTokens)),
+		"gen_ai.usage.output_tokens": attribute.IntValue(int(resp.Usage.OutputTokens)),
+		"gen_ai.response.model":      attribute.StringValue(resp.Model),
+	}
+	for key, value := range want {
+		if attrs[key] != value {
+			t.Errorf("span attribute %s = %v, want %v", key, attrs[key].Emit(), value.Emit())
+		}
+	}
+	if reasons := attrs["gen_ai.response.finish_reasons"].AsStringSlice(); len(reasons) != 1 || reasons[0] != resp.StopReason {
+		t.Errorf("finish_reasons = %v, want [%s]", reasons, resp.StopReason)
+	}
+
+	metrics := collectMetrics(t, reader)
+	for _, name := range []string{"gen_ai.client.operation.duration", "gen_ai.client.token.usage", "sqirvy.client.requests"} {
+		if _, ok := metrics[name]; !ok {
+			t.Errorf("metric %s not recorded", name)
+		}
+	}
+	usage := metrics["gen_ai.client.token.usage"].Data.(metricdata.Histogram[int64])
+	var total int64
+	for _, point := range usage.DataPoints {
+		total += point.Sum
+	}
+	if total != resp.Usage.InputTokens+resp.Usage.OutputTokens {
+		t.Errorf("token usage sum = %d, want %d", total, resp.Usage.InputTokens+resp.Usage.OutputTokens)
+	}
+}
+
+func TestTelemetryClient_Error(t *testing.T) {
+	spans, tracerProvider, reader, meterProvider := testTelemetry()
+	mock := NewMockClientWithResponses(MockResponse{Error: "overloaded"})
+	client := NewTelemetryClient(mock, OpenAI, TelemetryConfig{TracerProvider: tracerProvider, MeterProvider: meterProvider})
+
+	_, err := client.QueryText(context.Background(), assistant, []string{"hi"}, "gpt-5", Options{})
+	if err == nil {
+		t.Fatalf("QueryText() error = nil, want error")
+	}
+
+	span := spans.Ended()[0]
+	if span.Status().Code != codes.Error || len(span.Events()) == 0 {
+		t.Errorf("span status = %v, events = %d, want error status and event", span.Status(), len(span.Events()))
+	}
+	if got, want := spanAttributes(span)["error.type"].AsString(), errorType(err); got != want || got == "" {
+		t.Errorf("error.type = %q, want %q", got, want)
+	}
+
+	requests := collectMetrics(t, reader)["sqirvy.client.requests"].Data.(metricdata.Sum[int64])
+	if len(requests.DataPoints) != 1 || requests.DataPoints[0].Value != 1 {
+		t.Fatalf("requests = %+v, want 1", requests.DataPoints)
+	}
+	if v, ok := requests.DataPoints[0].Attributes.Value("error.type"); !ok || v.AsString() != errorType(err) {
+		t.Errorf("requests error.type = %v, want %s", v.Emit(), errorType(err))
+	}
+}
+
+func TestNewClient_WithTracerProvider(t *testing.T) {
+	t.Setenv("MOCK_FIXTURE", "")
+	t.Setenv("MOCK_RECORD", "")
+	spans, tracerProvider, _, _ := testTelemetry()
+	client, err := NewClient(Mock, WithTracerProvider(tracerProvider))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close()
+	if _, ok := client.(*TelemetryClient); !ok {
+		t.Fatalf("NewClient() = %T, want *TelemetryClient", client)
+	}
+	if _, err := client.QueryText(context.Background(), assistant, []string{"hi"}, "mock", Options{}); err != nil {
+		t.Fatalf("QueryText() error = %v", err)
+	}
+	if n := len(spans.Ended()); n != 1 {
+		t.Errorf("spans = %d, want 1", n)
+	}
+
+	// without providers there is no telemetry wrapper
+	plain, err := NewClient(Mock)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer plain.Close()
+	if _, ok := plain.(*TelemetryClient); ok {
+		t.Errorf("NewClient() without providers = *TelemetryClient")
+	}
+}
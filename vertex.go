@@ -0,0 +1,292 @@
+// Package sqirvy provides integration with Google Cloud Vertex AI.
+//
+// This file implements the Client interface for models served through Vertex AI.
+// Gemini models are queried with langchaingo's vertex provider and Anthropic
+// Claude models are queried with langchaingo's anthropic provider, with each
+// request rewritten to the Vertex rawPredict endpoint. Authentication uses a
+// service account credentials file or Application Default Credentials.
+package sqirvy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/anthropic"
+	"github.com/tmc/langchaingo/llms/googleai"
+	"github.com/tmc/langchaingo/llms/googleai/vertex"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+)
+
+const (
+	// vertexAnthropicVersion is the Anthropic API version required by Vertex AI
+	vertexAnthropicVersion = "vertex-2023-10-16"
+
+	// vertexScope is the OAuth2 scope used for Vertex AI requests
+	vertexScope = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+// VertexClient implements the Client interface for Google Cloud Vertex AI.
+// It serves both Gemini and Anthropic models that are registered in the
+// model registry, routing each request to the matching publisher endpoint.
+type VertexClient struct {
+	gemini                 llms.Model // langchaingo vertex client for Gemini models
+	anthropic              llms.Model // langchaingo anthropic client for Claude models
+	geminiTemperatureScale float32
+	claudeTemperatureScale float32
+}
+
+// Ensure VertexClient implements the Client interface
+var _ Client = (*VertexClient)(nil)
+
+// NewVertexClient creates a new instance of VertexClient using langchaingo.
+// It returns an error if the required VERTEX_PROJECT or VERTEX_LOCATION
+// environment variables are not set.
+//
+// The following environment variables are used:
+//   - VERTEX_PROJECT: the GCP project id (falls back to GOOGLE_CLOUD_PROJECT)
+//   - VERTEX_LOCATION: the GCP region, e.g. us-east5 (falls back to GOOGLE_CLOUD_LOCATION)
+//   - GOOGLE_APPLICATION_CREDENTIALS: optional service account credentials file.
+//     If not set, Application Default Credentials are used.
+//   - VERTEX_BASE_URL: optional endpoint override, e.g. a local test server.
+//     If set and no credentials file is given, requests are sent unauthenticated.
+func NewVertexClient(opts ...ClientOption) (*VertexClient, error) {
+	config := newClientConfig(opts)
+
+	project := os.Getenv("VERTEX_PROJECT")
+	if project == "" {
+		project = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	}
+	if project == "" {
+		return nil, fmt.Errorf("VERTEX_PROJECT environment variable not set")
+	}
+
+	location := os.Getenv("VERTEX_LOCATION")
+	if location == "" {
+		location = os.Getenv("GOOGLE_CLOUD_LOCATION")
+	}
+	if location == "" {
+		return nil, fmt.Errorf("VERTEX_LOCATION environment variable not set")
+	}
+
+	credentialsFile := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	baseURL := strings.TrimSuffix(os.Getenv("VERTEX_BASE_URL"), "/")
+
+	ctx := context.Background()
+
+	// http client used for the anthropic publisher endpoint
+	httpClient, err := vertexHTTPClient(ctx, config.httpClient, credentialsFile, baseURL != "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Vertex credentials: %w", err)
+	}
+
+	// gemini models
+	geminiOptions := []googleai.Option{
+		googleai.WithCloudProject(project),
+		googleai.WithCloudLocation(location),
+		googleai.WithCredentialsFile(credentialsFile),
+	}
+	if baseURL != "" {
+		geminiOptions = append(geminiOptions, googleai.WithRest(), withClientOption(option.WithEndpoint(baseURL)))
+		if credentialsFile == "" && config.httpClient == nil {
+			geminiOptions = append(geminiOptions, withClientOption(option.WithoutAuthentication()))
+		}
+	}
+	// a custom http client is only used by the REST transport, and it replaces the
+	// credentials options, so the authenticated client is used instead
+	if config.httpClient != nil {
+		geminiOptions = append(geminiOptions, googleai.WithRest(), googleai.WithHTTPClient(httpClient))
+	}
+	gemini, err := vertex.New(ctx, geminiOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Vertex Gemini client: %w", err)
+	}
+
+	// anthropic models
+	if baseURL == "" {
+		baseURL = vertexEndpoint(location)
+	}
+	claude, err := anthropic.New(
+		// vertex authenticates with oauth2, the token is stripped by vertexDoer
+		anthropic.WithToken("vertex"),
+		anthropic.WithHTTPClient(&vertexDoer{
+			client:  httpClient,
+			baseURL: fmt.Sprintf("%s/v1/projects/%s/locations/%s/publishers/anthropic/models", baseURL, project, location),
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Vertex Anthropic client: %w", err)
+	}
+
+	return &VertexClient{
+		gemini:                 gemini,
+		anthropic:              claude,
+		geminiTemperatureScale: gemini_temperature_scale,
+		claudeTemperatureScale: 1.0,
+	}, nil
+}
+
+// QueryText sends a text query to the specified Gemini or Anthropic model on Vertex AI
+// and returns the response.
+//
+// It takes a context, system prompt, a list of prompts, the model name, and options as input.
+// Anthropic model names from the registry are converted to Vertex model ids
+// (claude-sonnet-4-20250514 becomes claude-sonnet-4@20250514).
+// Request timeouts are handled by the input context.
+func (c *VertexClient) QueryText(ctx context.Context, system string, prompts []string, model string, options Options) (string, error) {
+	return queryText(ctx, c, system, prompts, model, options)
+}
+
+// Query implements the Querier interface. It works like QueryText and also
+// returns the stop reason and token usage reported by Vertex AI.
+func (c *VertexClient) Query(ctx context.Context, req Request) (*Response, error) {
+	provider, err := GetProviderName(req.Model)
+	if err != nil {
+		return nil, fmt.Errorf("invalid or unsupported Vertex model: %s", req.Model)
+	}
+
+	options := req.Options
+	options.MaxTokens = GetMaxTokens(req.Model)
+	var resp *Response
+	switch provider {
+	case Gemini:
+		options.Temperature = options.Temperature * c.geminiTemperatureScale
+		resp, err = queryLangChain(ctx, c.gemini, Vertex, req.System, req.History, req.Prompts, req.Model, options)
+	case Anthropic:
+		options.Temperature = options.Temperature * c.claudeTemperatureScale
+		resp, err = queryLangChain(ctx, c.anthropic, Vertex, req.System, req.History, req.Prompts, vertexModelID(req.Model), options)
+	default:
+		return nil, fmt.Errorf("invalid or unsupported Vertex model: %s", req.Model)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp.Model = req.Model
+	return resp, nil
+}
+
+// Close implements the Close method for the Client interface.
+//
+// For the Vertex client, this method does not require any action as the
+// underlying langchaingo clients do not need to be explicitly closed.
+func (c *VertexClient) Close() error {
+	// the langchaingo llm does not require explicit close
+	return nil
+}
+
+// vertexEndpoint returns the regional Vertex AI endpoint for a location.
+func vertexEndpoint(location string) string {
+	if location == "global" {
+		return "https://aiplatform.googleapis.com"
+	}
+	return fmt.Sprintf("https://%s-aiplatform.googleapis.com", location)
+}
+
+// vertexModelID converts a registry Anthropic model name to the Vertex model id
+// by replacing the dash before a trailing date version with '@'.
+func vertexModelID(model string) string {
+	i := strings.LastIndex(model, "-")
+	if i < 0 || len(model)-i-1 != 8 {
+		return model
+	}
+	for _, r := range model[i+1:] {
+		if r < '0' || r > '9' {
+			return model
+		}
+	}
+	return model[:i] + "@" + model[i+1:]
+}
+
+// vertexHTTPClient returns an http client that authenticates requests with the
+// credentials file, or with Application Default Credentials if no file is given.
+// If unauthenticated is true and no credentials file is given, requests are not authenticated.
+// Requests are sent with base, or http.DefaultClient if base is nil.
+func vertexHTTPClient(ctx context.Context, base *http.Client, credentialsFile string, unauthenticated bool) (*http.Client, error) {
+	if base == nil {
+		base = http.DefaultClient
+	}
+	if credentialsFile == "" && unauthenticated {
+		return base, nil
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, base)
+
+	var creds *google.Credentials
+	if credentialsFile != "" {
+		data, err := os.ReadFile(credentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read credentials file %s: %w", credentialsFile, err)
+		}
+		creds, err = google.CredentialsFromJSON(ctx, data, vertexScope)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credentials file %s: %w", credentialsFile, err)
+		}
+	} else {
+		var err error
+		creds, err = google.FindDefaultCredentials(ctx, vertexScope)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return oauth2.NewClient(ctx, creds.TokenSource), nil
+}
+
+// withClientOption adds a raw google api client option to the googleai options.
+func withClientOption(opt option.ClientOption) googleai.Option {
+	return func(o *googleai.Options) {
+		o.ClientOptions = append(o.ClientOptions, opt)
+	}
+}
+
+// vertexDoer rewrites Anthropic Messages API requests made by langchaingo
+// into Vertex AI rawPredict requests. The model moves from the request body
+// into the url and the anthropic_version is added to the body.
+type vertexDoer struct {
+	client  *http.Client
+	baseURL string // .../publishers/anthropic/models
+}
+
+// Do implements the langchaingo anthropic Doer interface.
+func (d *vertexDoer) Do(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	_ = req.Body.Close()
+
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("failed to decode request body: %w", err)
+	}
+	model, _ := payload["model"].(string)
+	if model == "" {
+		return nil, fmt.Errorf("request is missing a model")
+	}
+	delete(payload, "model")
+	payload["anthropic_version"] = vertexAnthropicVersion
+
+	method := "rawPredict"
+	if stream, _ := payload["stream"].(bool); stream {
+		method = "streamRawPredict"
+	}
+
+	body, err = json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request body: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/%s:%s", d.baseURL, model, method)
+	vreq, err := http.NewRequestWithContext(req.Context(), http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	vreq.Header.Set("Content-Type", "application/json")
+	return d.client.Do(vreq)
+}
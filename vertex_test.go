@@ -0,0 +1,137 @@
+package sqirvy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVertexModelID(t *testing.T) {
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"claude-sonnet-4-20250514", "claude-sonnet-4@20250514"},
+		{"claude-3-5-haiku-20241022", "claude-3-5-haiku@20241022"},
+		{"claude-sonnet-4", "claude-sonnet-4"},
+		{"gemini-2.5-flash", "gemini-2.5-flash"},
+	}
+
+	for _, tt := range tests {
+		if got := vertexModelID(tt.model); got != tt.want {
+			t.Errorf("vertexModelID(%s) = %s, want %s", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestVertexClient_QueryText_Anthropic(t *testing.T) {
+	var gotPath string
+	var gotBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+			t.Errorf("decode request body: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4","content":[{"type":"text","text":"Hello, World!"}],"stop_reason":"end_turn","usage":{"input_tokens":5,"output_tokens":4}}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("VERTEX_PROJECT", "test-project")
+	t.Setenv("VERTEX_LOCATION", "us-east5")
+	t.Setenv("VERTEX_BASE_URL", server.URL)
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+
+	client, err := NewClient(Vertex)
+	if err != nil {
+		t.Fatalf("new client failed: %v", err)
+	}
+	defer client.Close()
+
+	got, err := client.QueryText(context.Background(), assistant, []string{"Say 'Hello, World!'"}, "claude-sonnet-4-20250514", Options{Temperature: 0.5})
+	if err != nil {
+		t.Fatalf("VertexClient.QueryText() error = %v", err)
+	}
+	if got != "Hello, World!" {
+		t.Errorf("VertexClient.QueryText() = %q, want %q", got, "Hello, World!")
+	}
+
+	wantPath := "/v1/projects/test-project/locations/us-east5/publishers/anthropic/models/claude-sonnet-4@20250514:rawPredict"
+	if gotPath != wantPath {
+		t.Errorf("request path = %s, want %s", gotPath, wantPath)
+	}
+	if gotBody["anthropic_version"] != vertexAnthropicVersion {
+		t.Errorf("anthropic_version = %v, want %s", gotBody["anthropic_version"], vertexAnthropicVersion)
+	}
+	if _, ok := gotBody["model"]; ok {
+		t.Error("request body should not contain a model")
+	}
+}
+
+func TestVertexClient_QueryText_Gemini(t *testing.T) {
+	var gotPath string
+	var gotBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+			t.Errorf("decode request body: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hello, World!"}]},"finishReason":"STOP","index":0}],"usageMetadata":{"promptTokenCount":5,"candidatesTokenCount":4,"totalTokenCount":9}}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("VERTEX_PROJECT", "test-project")
+	t.Setenv("VERTEX_LOCATION", "us-east5")
+	t.Setenv("VERTEX_BASE_URL", server.URL)
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+
+	client, err := NewClient(Vertex)
+	if err != nil {
+		t.Fatalf("new client failed: %v", err)
+	}
+	defer client.Close()
+
+	got, err := client.QueryText(context.Background(), assistant, []string{"Say 'Hello, World!'"}, "gemini-2.5-flash", Options{Temperature: 0.5})
+	if err != nil {
+		t.Fatalf("VertexClient.QueryText() error = %v", err)
+	}
+	if got != "Hello, World!" {
+		t.Errorf("VertexClient.QueryText() = %q, want %q", got, "Hello, World!")
+	}
+
+	wantPath := "/v1beta1/projects/test-project/locations/us-east5/publishers/google/models/gemini-2.5-flash:generateContent"
+	if gotPath != wantPath {
+		t.Errorf("request path = %s, want %s", gotPath, wantPath)
+	}
+	contents, _ := gotBody["contents"].([]any)
+	if len(contents) == 0 {
+		t.Fatalf("request body has no contents: %v", gotBody)
+	}
+	if data, _ := json.Marshal(contents); !strings.Contains(string(data), "Say 'Hello, World!'") {
+		t.Errorf("request contents = %s, want the prompt", data)
+	}
+	if _, ok := gotBody["systemInstruction"]; !ok {
+		t.Errorf("request body has no systemInstruction: %v", gotBody)
+	}
+}
+
+func TestVertexClient_QueryText_InvalidModel(t *testing.T) {
+	t.Setenv("VERTEX_PROJECT", "test-project")
+	t.Setenv("VERTEX_LOCATION", "us-east5")
+	t.Setenv("VERTEX_BASE_URL", "http://127.0.0.1:0")
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+
+	client, err := NewVertexClient()
+	if err != nil {
+		t.Fatalf("new client failed: %v", err)
+	}
+
+	_, err = client.QueryText(context.Background(), assistant, []string{"hello"}, "gpt-5", Options{})
+	if err == nil {
+		t.Error("VertexClient.QueryText() error = nil, want error for openai model")
+	}
+}